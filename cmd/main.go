@@ -26,6 +26,10 @@ var (
 			Value: "tmp",
 			Usage: "Set the output dirname",
 		},
+		&cli.StringFlag{
+			Name:  "pipelines",
+			Usage: "Set the path to a pipelines file, overrides PIPELINES_FILE",
+		},
 	}
 )
 
@@ -43,6 +47,7 @@ func main() {
 		"blockchains to be continuously assessed for real-time txs"
 	app.Action = RunMagicChain
 	app.Flags = cliFlags
+	app.Commands = []*cli.Command{reportCommand, replayCommand, rebroadcastCommand}
 
 	err := app.Run(os.Args)
 	if err != nil {
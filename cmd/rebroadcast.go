@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/denzelpenzel/magic-chain/internal/rebroadcast"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/urfave/cli/v2"
+)
+
+var rebroadcastCommand = &cli.Command{
+	Name:  "rebroadcast",
+	Usage: "Submit recorded txs to a node with eth_sendRawTransaction",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:     "endpoint",
+			Usage:    "RPC endpoint of the target node, e.g. a local dev node",
+			Required: true,
+		},
+		&cli.StringSliceFlag{
+			Name:  "senders",
+			Usage: "Only submit txs of these senders",
+		},
+		&cli.StringSliceFlag{
+			Name:  "hashes",
+			Usage: "Only submit these txs",
+		},
+		&cli.StringFlag{
+			Name:  "hashes-file",
+			Usage: "Only submit the txs listed in this file, one hash per line",
+		},
+		&cli.Float64Flag{
+			Name:  "rate",
+			Value: 10,
+			Usage: "Maximum txs submitted per second, 0 disables the limit",
+		},
+		&cli.StringFlag{
+			Name:  "report",
+			Value: "rebroadcast.csv",
+			Usage: "Set the path of the per tx results file",
+		},
+	}, windowFlags...),
+	Action: RunRebroadcast,
+}
+
+// RunRebroadcast rebroadcast entry point
+func RunRebroadcast(c *cli.Context) error {
+	from, to, err := parseWindow(c)
+	if err != nil {
+		return err
+	}
+
+	filter, err := parseRebroadcastFilter(c)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rpcClient, err := rpc.DialContext(ctx, c.String("endpoint"))
+	if err != nil {
+		return err
+	}
+	defer rpcClient.Close()
+
+	report, err := os.Create(filepath.Clean(c.String("report")))
+	if err != nil {
+		return err
+	}
+
+	summary, runErr := rebroadcast.New(rpcClient, c.Float64("rate"), report).
+		Run(ctx, c.String("data-dir"), from, to, filter)
+	if err := report.Close(); err != nil {
+		runErr = errors.Join(runErr, err)
+	}
+
+	if summary != nil {
+		results := make([]string, 0, len(summary.Results))
+		for res, n := range summary.Results {
+			results = append(results, fmt.Sprintf("%s=%d", res, n))
+		}
+		sort.Strings(results)
+
+		if len(results) == 0 {
+			results = append(results, "no txs")
+		}
+
+		fmt.Fprintf(os.Stdout, "submitted %s (%d skipped), report written to %s\n",
+			strings.Join(results, " "), summary.Skipped, c.String("report"))
+	}
+
+	return runErr
+}
+
+func parseRebroadcastFilter(c *cli.Context) (*rebroadcast.Filter, error) {
+	f := &rebroadcast.Filter{
+		Senders: make(map[common.Address]struct{}),
+		Hashes:  make(map[common.Hash]struct{}),
+	}
+
+	for _, val := range c.StringSlice("senders") {
+		if !common.IsHexAddress(val) {
+			return nil, fmt.Errorf("invalid sender %s", val)
+		}
+		f.Senders[common.HexToAddress(val)] = struct{}{}
+	}
+
+	hashes := c.StringSlice("hashes")
+	if path := c.String("hashes-file"); path != "" {
+		fromFile, err := readLines(path)
+		if err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, fromFile...)
+	}
+
+	for _, val := range hashes {
+		raw, err := hexutil.Decode(val)
+		if err != nil || len(raw) != common.HashLength {
+			return nil, fmt.Errorf("invalid tx hash %s", val)
+		}
+		f.Hashes[common.BytesToHash(raw)] = struct{}{}
+	}
+
+	return f, nil
+}
+
+// readLines ... Returns the non empty lines of a file
+func readLines(path string) ([]string, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
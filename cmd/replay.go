@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/process"
+	"github.com/denzelpenzel/magic-chain/internal/replay"
+	"github.com/denzelpenzel/magic-chain/internal/sink"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"github.com/urfave/cli/v2"
+)
+
+var replayCommand = &cli.Command{
+	Name:  "replay",
+	Usage: "Feed the recorded txs of a time window through the processing pipeline again",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  "speed",
+			Value: "max",
+			Usage: "Replay speed (max|realtime|<factor>, e.g. 10x)",
+		},
+		&cli.StringFlag{
+			Name:  "out-dir",
+			Value: "replay",
+			Usage: "Set the output dirname of the replayed records, must be outside of --data-dir",
+		},
+		&cli.StringSliceFlag{
+			Name:  "sinks",
+			Value: cli.NewStringSlice(sink.CSV),
+			Usage: "Sinks receiving the replayed records",
+		},
+		&cli.IntFlag{
+			Name:  "workers",
+			Value: 1,
+			Usage: "Number of workers, a single worker keeps runs deterministic",
+		},
+	}, windowFlags...),
+	Action: RunReplay,
+}
+
+// RunReplay replay entry point
+func RunReplay(c *cli.Context) error {
+	from, to, err := parseWindow(c)
+	if err != nil {
+		return err
+	}
+
+	speed, err := replay.ParseSpeed(c.String("speed"))
+	if err != nil {
+		return err
+	}
+
+	dataDir, outDir := c.String("data-dir"), c.String("out-dir")
+	if err := checkOutDir(dataDir, outDir); err != nil {
+		return err
+	}
+
+	cfg := &config.Config{
+		DataDir:      outDir,
+		ClientConfig: &core.ClientConfig{},
+		SystemConfig: &config.SystemConfig{
+			Sinks:   c.StringSlice("sinks"),
+			Workers: c.Int("workers"),
+			DropTTL: core.TXCacheTime,
+		},
+	}
+
+	// the replayed rows carry their recorded timestamps and may arrive out of
+	// order, the store runs without a cleaner so no bucket is closed early.
+	// Close seals every bucket once the replay is done
+	store := state.NewFileStore(outDir, state.WithEventTime())
+
+	out, err := sink.New(context.Background(), cfg, store)
+	if err != nil {
+		return errors.Join(err, store.Close())
+	}
+
+	// the reader outlives an interrupted replay so the pushed txs are drained
+	reader := process.NewReplayReader(context.Background(), cfg, store, out)
+	go func() {
+		_ = reader.EventLoop()
+	}()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	stats, runErr := replay.New(dataDir, from, to, speed).Run(ctx, reader)
+
+	reader.Drain()
+	if err := reader.Close(); err != nil {
+		return errors.Join(runErr, err)
+	}
+
+	if stats != nil {
+		fmt.Fprintf(os.Stdout, "replayed %d txs (%d skipped) first seen %s - %s in %s at %s speed\n",
+			stats.Txs, stats.Skipped, stats.First.Format(timeLayouts[0]), stats.Last.Format(timeLayouts[0]),
+			stats.Elapsed, speed)
+	}
+
+	return runErr
+}
+
+// checkOutDir ... Refuses output dirs inside the recorded data, later runs
+// would replay the replayed txs again
+func checkOutDir(dataDir, outDir string) error {
+	dataAbs, err := filepath.Abs(dataDir)
+	if err != nil {
+		return err
+	}
+
+	outAbs, err := filepath.Abs(outDir)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(dataAbs, outAbs)
+	if err != nil {
+		return err
+	}
+
+	if rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))) {
+		return fmt.Errorf("--out-dir %s must be outside of --data-dir %s", outDir, dataDir)
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/report"
+	"github.com/urfave/cli/v2"
+)
+
+var (
+	timeLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02 15:04", time.DateOnly}
+
+	windowFlags = []cli.Flag{
+		&cli.StringFlag{
+			Name:  "from",
+			Usage: "Start of the time window (RFC3339 or YYYY-MM-DD[ HH:MM[:SS]], UTC), defaults to one hour before --to",
+		},
+		&cli.StringFlag{
+			Name:  "to",
+			Usage: "End of the time window (RFC3339 or YYYY-MM-DD[ HH:MM[:SS]], UTC), defaults to now",
+		},
+	}
+
+	reportCommand = &cli.Command{
+		Name:  "report",
+		Usage: "Build reports from the recorded data",
+		Subcommands: []*cli.Command{
+			{
+				Name:  "latency",
+				Usage: "Compare first-seen latency and coverage across sources",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Value: report.FormatTable,
+						Usage: "Output format (table|json)",
+					},
+				}, windowFlags...),
+				Action: RunLatencyReport,
+			},
+		},
+	}
+)
+
+// RunLatencyReport report latency entry point
+func RunLatencyReport(c *cli.Context) error {
+	from, to, err := parseWindow(c)
+	if err != nil {
+		return err
+	}
+
+	r, err := report.Latency(c.String("data-dir"), from, to)
+	if err != nil {
+		return err
+	}
+
+	return r.Write(os.Stdout, c.String("format"))
+}
+
+// parseWindow ... Reads the --from/--to flags, defaulting to the last hour
+func parseWindow(c *cli.Context) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if c.IsSet("to") {
+		t, err := parseTime(c.String("to"))
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		to = t
+	}
+
+	from := to.Add(-time.Hour)
+	if c.IsSet("from") {
+		t, err := parseTime(c.String("from"))
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		from = t
+	}
+
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("--from %s is after --to %s", from, to)
+	}
+
+	return from, to, nil
+}
+
+func parseTime(val string) (time.Time, error) {
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, val); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("could not parse time %q", val)
+}
@@ -0,0 +1,183 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const (
+	// defaultLookback is the bucket window searched for a hash missing from the index
+	defaultLookback = 24 * time.Hour
+	defaultWindow   = time.Hour
+	maxWindow       = 24 * time.Hour
+
+	defaultLimit = 100
+	maxLimit     = 1000
+)
+
+type listResponse struct {
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+	Count int       `json:"count"`
+	Txs   []*TxView `json:"txs"`
+}
+
+// getTx ... GET /v1/txs/{hash}?from=&to=
+func (s *Server) getTx(w http.ResponseWriter, r *http.Request) {
+	hashHex := r.PathValue("hash")
+	if !isHash(hashHex) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("invalid tx hash %s", hashHex))
+		return
+	}
+
+	from, to, err := parseWindow(r.URL.Query(), defaultLookback)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	v, err := s.txs.Lookup(common.HexToHash(hashHex), from, to)
+	if errors.Is(err, ErrTxNotFound) {
+		writeError(w, http.StatusNotFound, err)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, v)
+}
+
+// listTxs ... GET /v1/txs?from=&to=&sender=&recipient=&min_fee=&limit=
+func (s *Server) listTxs(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilter(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	txs, err := s.txs.List(f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &listResponse{
+		From:  f.From,
+		To:    f.To,
+		Count: len(txs),
+		Txs:   txs,
+	})
+}
+
+func parseFilter(q url.Values) (*TxFilter, error) {
+	from, to, err := parseWindow(q, defaultWindow)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &TxFilter{From: from, To: to, Limit: defaultLimit}
+
+	if val := q.Get("sender"); val != "" {
+		if !common.IsHexAddress(val) {
+			return nil, fmt.Errorf("invalid sender %s", val)
+		}
+		addr := common.HexToAddress(val)
+		f.Sender = &addr
+	}
+
+	if val := q.Get("recipient"); val != "" {
+		if !common.IsHexAddress(val) {
+			return nil, fmt.Errorf("invalid recipient %s", val)
+		}
+		addr := common.HexToAddress(val)
+		f.Recipient = &addr
+	}
+
+	if val := q.Get("min_fee"); val != "" {
+		fee, ok := new(big.Int).SetString(val, 10)
+		if !ok || fee.Sign() < 0 {
+			return nil, fmt.Errorf("invalid min_fee %s, expected an amount in wei", val)
+		}
+		f.MinFee = fee
+	}
+
+	if val := q.Get("limit"); val != "" {
+		limit, err := strconv.Atoi(val)
+		if err != nil || limit <= 0 {
+			return nil, fmt.Errorf("invalid limit %s", val)
+		}
+		f.Limit = min(limit, maxLimit)
+	}
+
+	return f, nil
+}
+
+// parseWindow ... Reads the from and to query params, to defaults to now and
+// from to the given duration before to
+func parseWindow(q url.Values, def time.Duration) (time.Time, time.Time, error) {
+	to := time.Now().UTC()
+	if val := q.Get("to"); val != "" {
+		t, err := parseTime(val)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		to = t
+	}
+
+	from := to.Add(-def)
+	if val := q.Get("from"); val != "" {
+		t, err := parseTime(val)
+		if err != nil {
+			return time.Time{}, time.Time{}, err
+		}
+		from = t
+	}
+
+	if from.After(to) {
+		return time.Time{}, time.Time{}, fmt.Errorf("from %s is after to %s",
+			from.Format(time.RFC3339), to.Format(time.RFC3339))
+	}
+
+	if to.Sub(from) > maxWindow {
+		return time.Time{}, time.Time{}, fmt.Errorf("window exceeds the maximum of %s", maxWindow)
+	}
+
+	return from, to, nil
+}
+
+// parseTime ... Accepts RFC3339 or unix milliseconds
+func parseTime(val string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(val, 10, 64); err == nil {
+		return time.UnixMilli(ms).UTC(), nil
+	}
+
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %s, expected RFC3339 or unix milliseconds", val)
+	}
+	return t.UTC(), nil
+}
+
+func isHash(val string) bool {
+	if len(val) != 2*common.HashLength+2 || (val[:2] != "0x" && val[:2] != "0X") {
+		return false
+	}
+
+	for _, c := range val[2:] {
+		isDigit := c >= '0' && c <= '9'
+		isHexLetter := (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+		if !isDigit && !isHexLetter {
+			return false
+		}
+	}
+	return true
+}
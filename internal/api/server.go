@@ -0,0 +1,94 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/logging"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"github.com/denzelpenzel/magic-chain/internal/stream"
+	"go.uber.org/zap"
+)
+
+const (
+	readHeaderTimeout = 5 * time.Second
+	writeTimeout      = 30 * time.Second
+)
+
+// Server ... HTTP server answering queries about the recorded pending txs
+type Server struct {
+	srv *http.Server
+	txs *TxService
+	hub *stream.Hub
+
+	bufferSize int
+	dropPolicy stream.DropPolicy
+}
+
+func NewServer(cfg *config.APIConfig, dataDir string, index *state.TxIndex, hub *stream.Hub) (*Server, error) {
+	policy, err := stream.ParseDropPolicy(cfg.StreamDropPolicy)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		txs:        NewTxService(dataDir, index),
+		hub:        hub,
+		bufferSize: cfg.StreamBufferSize,
+		dropPolicy: policy,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/txs/{hash}", s.getTx)
+	mux.HandleFunc("GET /v1/txs", s.listTxs)
+	mux.HandleFunc("GET /v1/stream", s.streamSSE)
+	mux.HandleFunc("GET /v1/ws", s.streamWS)
+
+	s.srv = &http.Server{
+		Addr:              net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		Handler:           mux,
+		ReadHeaderTimeout: readHeaderTimeout,
+		WriteTimeout:      writeTimeout,
+	}
+
+	return s, nil
+}
+
+// Start ... Serves the api in the background
+func (s *Server) Start() {
+	logger := logging.NoContext()
+	logger.Info("Starting api server", zap.String("addr", s.srv.Addr))
+
+	go func() {
+		if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Api server failed", zap.Error(err))
+		}
+	}()
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.NoContext().Debug("Failed to write api response", zap.Error(err))
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, &errorResponse{Error: err.Error()})
+}
@@ -0,0 +1,297 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/logging"
+	"github.com/denzelpenzel/magic-chain/internal/stream"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/gorilla/websocket"
+	"go.uber.org/zap"
+)
+
+const (
+	keepAliveInterval = 15 * time.Second
+	wsWriteTimeout    = 10 * time.Second
+	wsMaxMessageSize  = 64 * 1024
+
+	eventTx      = "tx"
+	eventDropped = "dropped"
+)
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// the api is meant for backend consumers, browsers are not restricted
+	CheckOrigin: func(_ *http.Request) bool { return true },
+}
+
+// FilterRequest ... Stream filter as sent by clients, in query params lists
+// are comma separated
+type FilterRequest struct {
+	From      []string `json:"from"`
+	To        []string `json:"to"`
+	Selectors []string `json:"selectors"`
+	MinValue  string   `json:"min_value"`
+	Types     []string `json:"types"`
+}
+
+// droppedMessage ... Tells a client how many txs it lost since the last message
+type droppedMessage struct {
+	Dropped uint64 `json:"dropped"`
+}
+
+// wsMessage ... Envelope of the websocket messages, Data holds a TxView or droppedMessage
+type wsMessage struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data"`
+}
+
+// streamSSE ... GET /v1/stream, server-sent events
+func (s *Server) streamSSE(w http.ResponseWriter, r *http.Request) {
+	sub, err := s.subscribe(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	// the stream outlives the server write timeout
+	if err := rc.SetWriteDeadline(time.Time{}); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	send := func(event string, v interface{}) error {
+		data, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	err = s.pump(r, sub, send, func() error {
+		if _, err := fmt.Fprint(w, ": keep-alive\n\n"); err != nil {
+			return err
+		}
+		return rc.Flush()
+	})
+	if err != nil {
+		logging.NoContext().Debug("Stream client disconnected", zap.Error(err))
+	}
+}
+
+// streamWS ... GET /v1/ws, websocket. Clients may replace their filter at any
+// time by sending a FilterRequest
+func (s *Server) streamWS(w http.ResponseWriter, r *http.Request) {
+	sub, err := s.subscribe(r.URL.Query())
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	defer sub.Close()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader already replied to the client
+		return
+	}
+	defer conn.Close()
+
+	go s.readFilters(conn, sub)
+
+	send := func(event string, v interface{}) error {
+		if err := conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout)); err != nil {
+			return err
+		}
+		return conn.WriteJSON(&wsMessage{Type: event, Data: v})
+	}
+
+	err = s.pump(r, sub, send, func() error {
+		return conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteTimeout))
+	})
+	if err != nil {
+		logging.NoContext().Debug("Stream client disconnected", zap.Error(err))
+	}
+}
+
+// readFilters ... Applies filter updates until the connection fails, which
+// also ends the subscription
+func (s *Server) readFilters(conn *websocket.Conn, sub *stream.Subscription) {
+	defer sub.Close()
+
+	conn.SetReadLimit(wsMaxMessageSize)
+	for {
+		req := new(FilterRequest)
+		if err := conn.ReadJSON(req); err != nil {
+			return
+		}
+
+		f, err := parseStreamFilter(req)
+		if err != nil {
+			_ = conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseUnsupportedData, err.Error()),
+				time.Now().Add(wsWriteTimeout))
+			return
+		}
+		sub.SetFilter(f)
+	}
+}
+
+// pump ... Delivers the subscription to the client until either side ends it
+func (s *Server) pump(r *http.Request, sub *stream.Subscription,
+	send func(event string, v interface{}) error, keepAlive func() error) error {
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	var reported uint64
+	for {
+		select {
+		case rec := <-sub.C():
+			if dropped := sub.Dropped(); dropped > reported {
+				if err := send(eventDropped, &droppedMessage{Dropped: dropped - reported}); err != nil {
+					return err
+				}
+				reported = dropped
+			}
+
+			v, err := fromRecord(rec)
+			if err != nil {
+				continue
+			}
+			if err := send(eventTx, v); err != nil {
+				return err
+			}
+
+		case <-ticker.C:
+			if err := keepAlive(); err != nil {
+				return err
+			}
+
+		case <-sub.Done():
+			return fmt.Errorf("subscription closed, %d txs dropped", sub.Dropped())
+
+		case <-r.Context().Done():
+			return r.Context().Err()
+		}
+	}
+}
+
+func (s *Server) subscribe(q url.Values) (*stream.Subscription, error) {
+	if s.hub == nil {
+		return nil, fmt.Errorf("live stream is not available")
+	}
+
+	f, err := parseStreamFilter(&FilterRequest{
+		From:      splitList(q.Get("from")),
+		To:        splitList(q.Get("to")),
+		Selectors: splitList(q.Get("selectors")),
+		MinValue:  q.Get("min_value"),
+		Types:     splitList(q.Get("types")),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	policy := s.dropPolicy
+	if val := q.Get("drop_policy"); val != "" {
+		if policy, err = stream.ParseDropPolicy(val); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.hub.Subscribe(f, s.bufferSize, policy), nil
+}
+
+func parseStreamFilter(req *FilterRequest) (*stream.Filter, error) {
+	f := &stream.Filter{}
+
+	for _, val := range req.From {
+		if !common.IsHexAddress(val) {
+			return nil, fmt.Errorf("invalid from address %s", val)
+		}
+		f.From = append(f.From, common.HexToAddress(val))
+	}
+
+	for _, val := range req.To {
+		if !common.IsHexAddress(val) {
+			return nil, fmt.Errorf("invalid to address %s", val)
+		}
+		f.To = append(f.To, common.HexToAddress(val))
+	}
+
+	for _, val := range req.Selectors {
+		raw, err := hexutil.Decode(val)
+		if err != nil || len(raw) != core.SelectorLength {
+			return nil, fmt.Errorf("invalid method selector %s, expected 4 hex encoded bytes", val)
+		}
+		f.Selectors = append(f.Selectors, [core.SelectorLength]byte(raw))
+	}
+
+	if req.MinValue != "" {
+		v, ok := new(big.Int).SetString(req.MinValue, 10)
+		if !ok || v.Sign() < 0 {
+			return nil, fmt.Errorf("invalid min_value %s, expected an amount in wei", req.MinValue)
+		}
+		f.MinValue = v
+	}
+
+	for _, val := range req.Types {
+		t, err := strconv.ParseUint(val, 10, 8)
+		if err != nil {
+			return nil, fmt.Errorf("invalid tx type %s", val)
+		}
+		f.Types = append(f.Types, uint8(t))
+	}
+
+	return f, nil
+}
+
+func splitList(val string) []string {
+	if val == "" {
+		return nil
+	}
+
+	var res []string
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// fromRecord ... Builds the view of a tx as it is recorded
+func fromRecord(r *core.TxRecord) (*TxView, error) {
+	v := &TxView{
+		Hash:      strings.ToLower(r.Tx.Hash().Hex()),
+		FirstSeen: r.Timestamp,
+		Sources:   []SourceView{{Source: r.Source, SeenAt: r.Timestamp}},
+	}
+	if err := v.decode(r.Tx, r.Sender); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
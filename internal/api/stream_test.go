@@ -0,0 +1,65 @@
+package api
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/stream"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStreamFilter(t *testing.T) {
+	addr := "0x1000000000000000000000000000000000000001"
+
+	tests := []struct {
+		name    string
+		req     *FilterRequest
+		want    *stream.Filter
+		wantErr bool
+	}{
+		{name: "empty request", req: &FilterRequest{}, want: &stream.Filter{}},
+		{
+			name: "every field",
+			req: &FilterRequest{
+				From:      []string{addr},
+				To:        []string{addr},
+				Selectors: []string{"0xa9059cbb"},
+				MinValue:  "1000",
+				Types:     []string{"0", "2"},
+			},
+			want: &stream.Filter{
+				From:      []common.Address{common.HexToAddress(addr)},
+				To:        []common.Address{common.HexToAddress(addr)},
+				Selectors: [][core.SelectorLength]byte{{0xa9, 0x05, 0x9c, 0xbb}},
+				MinValue:  big.NewInt(1000),
+				Types:     []uint8{0, 2},
+			},
+		},
+		{name: "invalid from", req: &FilterRequest{From: []string{"0x12"}}, wantErr: true},
+		{name: "invalid to", req: &FilterRequest{To: []string{"nope"}}, wantErr: true},
+		{name: "selector too long", req: &FilterRequest{Selectors: []string{"0xa9059cbb00"}}, wantErr: true},
+		{name: "selector without prefix", req: &FilterRequest{Selectors: []string{"a9059cbb"}}, wantErr: true},
+		{name: "negative min value", req: &FilterRequest{MinValue: "-1"}, wantErr: true},
+		{name: "min value in ether", req: &FilterRequest{MinValue: "1.5"}, wantErr: true},
+		{name: "tx type out of range", req: &FilterRequest{Types: []string{"256"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f, err := parseStreamFilter(tt.req)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, f)
+		})
+	}
+}
+
+func TestSplitList(t *testing.T) {
+	require.Nil(t, splitList(""))
+	require.Equal(t, []string{"a", "b"}, splitList(" a, ,b ,"))
+}
@@ -0,0 +1,355 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	sourcelogHashCol   = 1
+	sourcelogSourceCol = 2
+)
+
+var (
+	ErrTxNotFound = errors.New("tx not found")
+)
+
+// SourceView ... First sighting of a tx by a single source
+type SourceView struct {
+	// Pipeline is only known for txs served from the in-memory index
+	Pipeline string    `json:"pipeline,omitempty"`
+	Source   string    `json:"source"`
+	SeenAt   time.Time `json:"seen_at"`
+}
+
+// TxView ... Recorded pending tx as returned by the api
+type TxView struct {
+	Hash      string       `json:"hash"`
+	FirstSeen time.Time    `json:"first_seen"`
+	Sources   []SourceView `json:"sources"`
+
+	// decoded fields, empty until the tx itself has been recorded
+	From      string  `json:"from,omitempty"`
+	To        *string `json:"to,omitempty"`
+	Nonce     uint64  `json:"nonce"`
+	Value     string  `json:"value,omitempty"`
+	Gas       uint64  `json:"gas"`
+	GasPrice  string  `json:"gas_price,omitempty"`
+	GasFeeCap string  `json:"gas_fee_cap,omitempty"`
+	GasTipCap string  `json:"gas_tip_cap,omitempty"`
+	Type      uint8   `json:"type"`
+	ChainID   string  `json:"chain_id,omitempty"`
+	Selector  string  `json:"selector,omitempty"`
+	// AccessListSize is the number of addresses in the access list
+	AccessListSize int    `json:"access_list_size"`
+	BlobCount      int    `json:"blob_count"`
+	Input          string `json:"input,omitempty"`
+	RLP            string `json:"rlp,omitempty"`
+
+	sender common.Address
+	tx     *types.Transaction
+}
+
+// TxFilter ... Criteria of a tx listing. Zero values match every tx
+type TxFilter struct {
+	From   time.Time
+	To     time.Time
+	Sender *common.Address
+	// Recipient does not match contract creations
+	Recipient *common.Address
+	// MinFee is compared against the fee cap, which equals the gas price of legacy txs
+	MinFee *big.Int
+	Limit  int
+}
+
+func (f *TxFilter) match(v *TxView) bool {
+	if v.tx == nil {
+		return false
+	}
+
+	if f.Sender != nil && v.sender != *f.Sender {
+		return false
+	}
+
+	if f.Recipient != nil && (v.tx.To() == nil || *v.tx.To() != *f.Recipient) {
+		return false
+	}
+
+	if f.MinFee != nil && v.tx.GasFeeCap().Cmp(f.MinFee) < 0 {
+		return false
+	}
+
+	return true
+}
+
+// TxService ... Answers tx queries from the in-memory index first and falls
+// back to the csv buckets stored under the data dir
+type TxService struct {
+	dataDir string
+	index   *state.TxIndex
+}
+
+func NewTxService(dataDir string, index *state.TxIndex) *TxService {
+	return &TxService{
+		dataDir: dataDir,
+		index:   index,
+	}
+}
+
+// Lookup ... Returns the tx with the given hash, searching the buckets within [from, to]
+// when the index does not know it
+func (s *TxService) Lookup(hash common.Hash, from, to time.Time) (*TxView, error) {
+	if s.index != nil {
+		if e, ok := s.index.Get(hash); ok && e.Tx != nil {
+			return fromIndexed(e)
+		}
+	}
+
+	hashLower := strings.ToLower(hash.Hex())
+	views := map[string]*TxView{}
+
+	err := state.WalkRows(s.dataDir, state.TxsPrefix, from, to, func(ts time.Time, cols []string) error {
+		if len(cols) <= state.TxsRLPCol || cols[state.TxsHashCol] != hashLower {
+			return nil
+		}
+		if _, ok := views[hashLower]; ok {
+			return nil
+		}
+
+		if v, err := fromRow(ts, cols); err == nil {
+			views[hashLower] = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(views) == 0 {
+		return nil, ErrTxNotFound
+	}
+
+	if err := s.addSources(from, to, views); err != nil {
+		return nil, err
+	}
+
+	return views[hashLower], nil
+}
+
+// List ... Returns the txs first seen within the filter window, oldest first
+func (s *TxService) List(f *TxFilter) ([]*TxView, error) {
+	views := map[string]*TxView{}
+
+	if s.index != nil {
+		for _, e := range s.index.Range(f.From, f.To) {
+			v, err := fromIndexed(e)
+			if err != nil {
+				continue
+			}
+			if f.match(v) {
+				views[v.Hash] = v
+			}
+		}
+	}
+
+	// txs that already left the index are read back from the buckets
+	fromDisk := map[string]*TxView{}
+	err := state.WalkRows(s.dataDir, state.TxsPrefix, f.From, f.To, func(ts time.Time, cols []string) error {
+		if len(cols) <= state.TxsRLPCol {
+			return nil
+		}
+
+		hash := cols[state.TxsHashCol]
+		if _, ok := views[hash]; ok {
+			return nil
+		}
+		if _, ok := fromDisk[hash]; ok {
+			return nil
+		}
+
+		// rows that can not be decoded are skipped like partially written ones
+		v, err := fromRow(ts, cols)
+		if err == nil && f.match(v) {
+			fromDisk[hash] = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.addSources(f.From, f.To, fromDisk); err != nil {
+		return nil, err
+	}
+
+	res := make([]*TxView, 0, len(views)+len(fromDisk))
+	for _, v := range views {
+		res = append(res, v)
+	}
+	for _, v := range fromDisk {
+		res = append(res, v)
+	}
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].FirstSeen.Equal(res[j].FirstSeen) {
+			return res[i].Hash < res[j].Hash
+		}
+		return res[i].FirstSeen.Before(res[j].FirstSeen)
+	})
+
+	if f.Limit > 0 && len(res) > f.Limit {
+		res = res[:f.Limit]
+	}
+	return res, nil
+}
+
+// addSources ... Fills the sources of the views from the sourcelog buckets within [from, to]
+func (s *TxService) addSources(from, to time.Time, views map[string]*TxView) error {
+	if len(views) == 0 {
+		return nil
+	}
+
+	err := state.WalkRows(s.dataDir, state.SourcelogPrefix, from, to, func(ts time.Time, cols []string) error {
+		if len(cols) <= sourcelogSourceCol {
+			return nil
+		}
+
+		v, ok := views[cols[sourcelogHashCol]]
+		if !ok {
+			return nil
+		}
+
+		v.addSource(cols[sourcelogSourceCol], ts)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, v := range views {
+		sort.Slice(v.Sources, func(i, j int) bool {
+			return v.Sources[i].SeenAt.Before(v.Sources[j].SeenAt)
+		})
+	}
+	return nil
+}
+
+func (v *TxView) addSource(source string, ts time.Time) {
+	if ts.Before(v.FirstSeen) {
+		v.FirstSeen = ts
+	}
+
+	for i, s := range v.Sources {
+		if s.Source != source {
+			continue
+		}
+		if ts.Before(s.SeenAt) {
+			v.Sources[i].SeenAt = ts
+		}
+		return
+	}
+
+	v.Sources = append(v.Sources, SourceView{Source: source, SeenAt: ts})
+}
+
+func fromIndexed(e *state.IndexedTx) (*TxView, error) {
+	v := &TxView{
+		Hash:      strings.ToLower(e.Hash.Hex()),
+		FirstSeen: e.FirstSeen,
+		Sources:   make([]SourceView, 0, len(e.Sources)),
+	}
+
+	for _, s := range e.Sources {
+		v.Sources = append(v.Sources, SourceView{Pipeline: s.Pipeline, Source: s.Source, SeenAt: s.SeenAt})
+	}
+	sort.Slice(v.Sources, func(i, j int) bool {
+		return v.Sources[i].SeenAt.Before(v.Sources[j].SeenAt)
+	})
+
+	if e.Tx == nil {
+		return v, nil
+	}
+
+	if err := v.decode(e.Tx, e.Sender); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// fromRow ... Builds a view from a transactions bucket row. The sender is read
+// from the row and only recovered from the signature for schema v1 rows
+func fromRow(ts time.Time, cols []string) (*TxView, error) {
+	raw, err := hexutil.Decode(cols[state.TxsRLPCol])
+	if err != nil {
+		return nil, err
+	}
+
+	tx := new(types.Transaction)
+	if err := tx.UnmarshalBinary(raw); err != nil {
+		return nil, err
+	}
+
+	var sender common.Address
+	if len(cols) > state.TxsSenderCol && common.IsHexAddress(cols[state.TxsSenderCol]) {
+		sender = common.HexToAddress(cols[state.TxsSenderCol])
+	} else if sender, err = types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx); err != nil {
+		return nil, fmt.Errorf("failed to recover sender of %s: %w", tx.Hash().Hex(), err)
+	}
+
+	v := &TxView{
+		Hash:      strings.ToLower(tx.Hash().Hex()),
+		FirstSeen: ts,
+		Sources:   []SourceView{},
+	}
+	if err := v.decode(tx, sender); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+func (v *TxView) decode(tx *types.Transaction, sender common.Address) error {
+	raw, err := tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	v.tx = tx
+	v.sender = sender
+
+	f := core.NewTxFields(tx, sender)
+
+	v.From = strings.ToLower(f.Sender.Hex())
+	if f.To != nil {
+		toHex := strings.ToLower(f.To.Hex())
+		v.To = &toHex
+	}
+	v.Nonce = f.Nonce
+	v.Value = f.Value.String()
+	v.Gas = f.Gas
+	v.GasPrice = f.GasPrice.String()
+	v.GasFeeCap = f.GasFeeCap.String()
+	v.GasTipCap = f.GasTipCap.String()
+	v.Type = f.Type
+	if f.ChainID != nil {
+		v.ChainID = f.ChainID.String()
+	}
+	if f.Selector != nil {
+		v.Selector = hexutil.Encode(f.Selector)
+	}
+	v.AccessListSize = f.AccessListSize
+	v.BlobCount = f.BlobCount
+	v.Input = hexutil.Encode(tx.Data())
+	v.RLP = hexutil.Encode(raw)
+
+	return nil
+}
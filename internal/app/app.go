@@ -6,27 +6,42 @@ import (
 	"os/signal"
 	"syscall"
 
+	"github.com/denzelpenzel/magic-chain/internal/api"
 	"github.com/denzelpenzel/magic-chain/internal/config"
 	"github.com/denzelpenzel/magic-chain/internal/logging"
 	"github.com/denzelpenzel/magic-chain/internal/manager"
+	"github.com/denzelpenzel/magic-chain/internal/metrics"
 	"go.uber.org/zap"
 )
 
 type Application struct {
-	cfg *config.Config
-	ctx context.Context
-	m   *manager.Manager
+	cfg     *config.Config
+	ctx     context.Context
+	m       *manager.Manager
+	api     *api.Server
+	metrics *metrics.Server
 }
 
-func New(ctx context.Context, cfg *config.Config, m *manager.Manager) *Application {
+func New(ctx context.Context, cfg *config.Config, m *manager.Manager, as *api.Server,
+	ms *metrics.Server) *Application {
 	return &Application{
-		ctx: ctx,
-		cfg: cfg,
-		m:   m,
+		ctx:     ctx,
+		cfg:     cfg,
+		m:       m,
+		api:     as,
+		metrics: ms,
 	}
 }
 
 func (a *Application) Start() error {
+	if a.metrics != nil {
+		a.metrics.Start()
+	}
+
+	if a.api != nil {
+		a.api.Start()
+	}
+
 	a.m.StartEventRoutines(a.ctx)
 
 	if err := a.m.Run(); err != nil {
@@ -3,13 +3,20 @@ package app
 import (
 	"context"
 
+	"github.com/denzelpenzel/magic-chain/internal/api"
+	"github.com/denzelpenzel/magic-chain/internal/chain"
 	"github.com/denzelpenzel/magic-chain/internal/client"
 	"github.com/denzelpenzel/magic-chain/internal/config"
 	"github.com/denzelpenzel/magic-chain/internal/core"
 	"github.com/denzelpenzel/magic-chain/internal/etl"
 	"github.com/denzelpenzel/magic-chain/internal/logging"
 	"github.com/denzelpenzel/magic-chain/internal/manager"
+	"github.com/denzelpenzel/magic-chain/internal/metrics"
 	"github.com/denzelpenzel/magic-chain/internal/registry"
+	"github.com/denzelpenzel/magic-chain/internal/sink"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"github.com/denzelpenzel/magic-chain/internal/stream"
+	"github.com/denzelpenzel/magic-chain/internal/upload"
 	"go.uber.org/zap"
 )
 
@@ -18,15 +25,103 @@ func InitContext(ctx context.Context, cb *client.Bundle) context.Context {
 }
 
 func NewMagicChainApp(ctx context.Context, cfg *config.Config) (*Application, func(), error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	// recently recorded txs shared between the processes and the api
+	index := state.NewTxIndex(core.TXCacheTime)
+	ctx = state.WithIndex(ctx, index)
+	go index.Cleaner(ctx)
+
+	// live feed of the recorded txs for the api stream clients
+	hub := stream.NewHub()
+	ctx = stream.WithHub(ctx, hub)
+
+	// reorgs detected by a block_header pipeline, retracting the inclusions of the others
+	ctx = chain.WithFeed(ctx, chain.NewFeed())
+
+	// a single connection pool for the pipelines writing to postgres, closed
+	// once they stopped
+	var pg *sink.PostgresSink
+	if cfg.UsesSink(sink.Postgres) {
+		var err error
+		if pg, err = sink.NewPostgres(cfg.PostgresConfig); err != nil {
+			cancel()
+			return nil, nil, err
+		}
+		ctx = sink.WithPostgres(ctx, pg)
+	}
+
+	closePostgres := func() {
+		if pg == nil {
+			return
+		}
+		if err := pg.Close(); err != nil {
+			logging.WithContext(ctx).Error("error closing postgres sink", zap.Error(err))
+		}
+	}
+
 	r := registry.New()
 	e := etl.New(ctx, r)
 	m := manager.NewManager(ctx, cfg, e)
 
+	var as *api.Server
+	if cfg.APIConfig.Enabled {
+		var err error
+		if as, err = api.NewServer(cfg.APIConfig, cfg.DataDir, index, hub); err != nil {
+			closePostgres()
+			cancel()
+			return nil, nil, err
+		}
+	}
+
+	if cfg.UploadConfig.Enabled {
+		store, err := upload.NewObjectStore(cfg.UploadConfig)
+		if err != nil {
+			closePostgres()
+			cancel()
+			return nil, nil, err
+		}
+
+		uploader, err := upload.New(cfg.UploadConfig, store, cfg.DataDirs()...)
+		if err != nil {
+			closePostgres()
+			cancel()
+			return nil, nil, err
+		}
+
+		// stopped by the app context, an interrupted upload resumes on the next start
+		go uploader.Run(ctx)
+	}
+
+	var ms *metrics.Server
+	if cfg.MetricsConfig.Enabled {
+		ms = metrics.NewServer(cfg.MetricsConfig.Host, cfg.MetricsConfig.Port)
+	}
+
 	appShutDown := func() {
+		defer cancel()
+
 		if err := m.Shutdown(); err != nil {
 			logging.WithContext(ctx).Error("error shutting down subsystems", zap.Error(err))
 		}
+
+		closePostgres()
+
+		// stream clients hold their connections open until the hub ends them
+		hub.Close()
+
+		if as != nil {
+			if err := as.Shutdown(ctx); err != nil {
+				logging.WithContext(ctx).Error("error shutting down api server", zap.Error(err))
+			}
+		}
+
+		if ms != nil {
+			if err := ms.Shutdown(ctx); err != nil {
+				logging.WithContext(ctx).Error("error shutting down metrics server", zap.Error(err))
+			}
+		}
 	}
 
-	return New(ctx, cfg, m), appShutDown, nil
+	return New(ctx, cfg, m, as, ms), appShutDown, nil
 }
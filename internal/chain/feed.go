@@ -0,0 +1,96 @@
+package chain
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/logging"
+	"go.uber.org/zap"
+)
+
+const (
+	reorgBufferSize = 16
+)
+
+// Feed ... Fans the reorgs detected by the header follower out to the
+// processes holding chain derived records, e.g. the inclusion tracker
+type Feed struct {
+	subs map[*subscriber]struct{}
+	lock sync.RWMutex
+}
+
+type subscriber struct {
+	ch  chan *core.Reorg
+	ctx context.Context
+	// gone is closed when the subscription ends
+	gone chan struct{}
+}
+
+func NewFeed() *Feed {
+	return &Feed{
+		subs: make(map[*subscriber]struct{}),
+	}
+}
+
+// WithFeed ... Returns a copy of ctx carrying the reorg feed
+func WithFeed(ctx context.Context, f *Feed) context.Context {
+	return context.WithValue(ctx, core.Chain, f)
+}
+
+func FeedFromContext(ctx context.Context) (*Feed, error) {
+	f, ok := ctx.Value(core.Chain).(*Feed)
+	if !ok {
+		return nil, fmt.Errorf("failed to retrieve reorg feed from context")
+	}
+	return f, nil
+}
+
+// Subscribe ... Returns a channel receiving the published reorgs and the
+// function ending the subscription. The subscription also ends with ctx
+func (f *Feed) Subscribe(ctx context.Context) (<-chan *core.Reorg, func()) {
+	sub := &subscriber{
+		ch:   make(chan *core.Reorg, reorgBufferSize),
+		ctx:  ctx,
+		gone: make(chan struct{}),
+	}
+
+	f.lock.Lock()
+	f.subs[sub] = struct{}{}
+	f.lock.Unlock()
+
+	var once sync.Once
+	return sub.ch, func() {
+		once.Do(func() {
+			f.lock.Lock()
+			delete(f.subs, sub)
+			f.lock.Unlock()
+			close(sub.gone)
+		})
+	}
+}
+
+// Publish ... Delivers the reorg to every subscriber. Blocks while the buffer
+// of a subscriber is full, until it catches up or its subscription ends.
+// Returns early once ctx is done
+func (f *Feed) Publish(ctx context.Context, r *core.Reorg) {
+	f.lock.RLock()
+	subs := make([]*subscriber, 0, len(f.subs))
+	for sub := range f.subs {
+		subs = append(subs, sub)
+	}
+	f.lock.RUnlock()
+
+	for _, sub := range subs {
+		select {
+		case sub.ch <- r:
+		case <-sub.gone:
+		case <-sub.ctx.Done():
+		case <-ctx.Done():
+			logging.WithContext(ctx).Warn("Stopped publishing reorg",
+				zap.Uint64("ancestor", r.AncestorNumber), zap.Int("depth", r.Depth))
+			return
+		}
+	}
+}
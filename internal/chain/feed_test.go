@@ -0,0 +1,69 @@
+package chain
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFeedPublish(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("waits for a full subscriber", func(t *testing.T) {
+		f := NewFeed()
+		ch, unsubscribe := f.Subscribe(ctx)
+		defer unsubscribe()
+
+		for i := 0; i < reorgBufferSize; i++ {
+			f.Publish(ctx, &core.Reorg{Depth: i})
+		}
+
+		published := make(chan struct{})
+		go func() {
+			f.Publish(ctx, &core.Reorg{Depth: reorgBufferSize})
+			close(published)
+		}()
+
+		select {
+		case <-published:
+			t.Fatal("reorg published past a full buffer")
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		for i := 0; i <= reorgBufferSize; i++ {
+			require.Equal(t, i, (<-ch).Depth)
+		}
+		<-published
+	})
+
+	t.Run("skips an ended subscription", func(t *testing.T) {
+		f := NewFeed()
+		subCtx, cancel := context.WithCancel(ctx)
+		_, unsubscribe := f.Subscribe(subCtx)
+		defer unsubscribe()
+
+		for i := 0; i < reorgBufferSize; i++ {
+			f.Publish(ctx, &core.Reorg{Depth: i})
+		}
+
+		cancel()
+		f.Publish(ctx, &core.Reorg{Depth: reorgBufferSize})
+	})
+
+	t.Run("stops with the publisher ctx", func(t *testing.T) {
+		f := NewFeed()
+		_, unsubscribe := f.Subscribe(ctx)
+		defer unsubscribe()
+
+		for i := 0; i < reorgBufferSize; i++ {
+			f.Publish(ctx, &core.Reorg{Depth: i})
+		}
+
+		pubCtx, cancel := context.WithCancel(ctx)
+		cancel()
+		f.Publish(pubCtx, &core.Reorg{Depth: reorgBufferSize})
+	})
+}
@@ -0,0 +1,138 @@
+package chain
+
+import (
+	"context"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// HeaderFetcher ... Looks up a header by hash, used to fill gaps and walk
+// back to the common ancestor of a reorg
+type HeaderFetcher = func(ctx context.Context, hash common.Hash) (*types.Header, error)
+
+// Window ... Recent canonical headers, contiguous and ordered by ascending
+// block number
+type Window struct {
+	size    int
+	headers []*types.Header
+}
+
+func NewWindow(size int) *Window {
+	if size < 1 {
+		size = 1
+	}
+	return &Window{size: size, headers: make([]*types.Header, 0, size)}
+}
+
+// Tip ... Returns the head of the canonical chain, nil while the window is empty
+func (w *Window) Tip() *types.Header {
+	if len(w.headers) == 0 {
+		return nil
+	}
+	return w.headers[len(w.headers)-1]
+}
+
+// Get ... Returns the canonical header at number, nil when it is outside the window
+func (w *Window) Get(number uint64) *types.Header {
+	if len(w.headers) == 0 {
+		return nil
+	}
+
+	first := w.headers[0].Number.Uint64()
+	if number < first || number-first >= uint64(len(w.headers)) {
+		return nil
+	}
+	return w.headers[number-first]
+}
+
+// Apply ... Makes head the new tip. Missing parents are fetched until the
+// branch connects to the window, the canonical headers it replaces are
+// reported as a reorg. Returns the headers that joined the canonical chain,
+// ordered by ascending block number
+func (w *Window) Apply(ctx context.Context, head *types.Header, fetch HeaderFetcher) ([]*types.Header, *core.Reorg, error) {
+	if known := w.Get(head.Number.Uint64()); known != nil && known.Hash() == head.Hash() {
+		return nil, nil, nil
+	}
+
+	// too far ahead to connect, e.g. after a long disconnect
+	if tip := w.Tip(); tip == nil || head.Number.Uint64() > tip.Number.Uint64()+uint64(w.size) {
+		w.headers = w.headers[:0]
+		w.push(head)
+		return []*types.Header{head}, nil, nil
+	}
+
+	first := w.headers[0].Number.Uint64()
+	if head.Number.Uint64() < first {
+		// stale head below the window
+		return nil, nil, nil
+	}
+
+	branch := []*types.Header{head}
+
+	connected := false
+	for cur := head; cur.Number.Uint64() > first; {
+		parentNum := cur.Number.Uint64() - 1
+		if known := w.Get(parentNum); known != nil && known.Hash() == cur.ParentHash {
+			connected = true
+			break
+		}
+
+		parent, err := fetch(ctx, cur.ParentHash)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		branch = append([]*types.Header{parent}, branch...)
+		cur = parent
+	}
+
+	// the branch replaces every canonical header from its first block on
+	start := branch[0].Number.Uint64()
+
+	var orphaned []*types.Header
+	for len(w.headers) > 0 && w.Tip().Number.Uint64() >= start {
+		orphaned = append([]*types.Header{w.Tip()}, orphaned...)
+		w.headers = w.headers[:len(w.headers)-1]
+	}
+
+	if !connected {
+		// the branch does not connect within the window, it starts over
+		orphaned = append(append([]*types.Header{}, w.headers...), orphaned...)
+		w.headers = w.headers[:0]
+	}
+
+	for _, h := range branch {
+		w.push(h)
+	}
+
+	if len(orphaned) == 0 {
+		return branch, nil, nil
+	}
+
+	reorg := &core.Reorg{
+		Timestamp:      time.Now().UTC(),
+		Depth:          len(orphaned),
+		AncestorNumber: start - 1,
+		AncestorHash:   branch[0].ParentHash,
+		OldHashes:      make([]common.Hash, 0, len(orphaned)),
+		NewHashes:      make([]common.Hash, 0, len(branch)),
+	}
+	for _, h := range orphaned {
+		reorg.OldHashes = append(reorg.OldHashes, h.Hash())
+	}
+	for _, h := range branch {
+		reorg.NewHashes = append(reorg.NewHashes, h.Hash())
+	}
+
+	return branch, reorg, nil
+}
+
+func (w *Window) push(h *types.Header) {
+	w.headers = append(w.headers, h)
+	if len(w.headers) > w.size {
+		w.headers = append(w.headers[:0], w.headers[len(w.headers)-w.size:]...)
+	}
+}
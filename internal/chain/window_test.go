@@ -0,0 +1,195 @@
+package chain
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+// testChain ... Headers by hash, served to the window as its fetcher
+type testChain map[common.Hash]*types.Header
+
+// extend ... Appends count headers to parent, fork tells apart the branches
+// built on the same parent
+func (c testChain) extend(parent *types.Header, count int, fork byte) []*types.Header {
+	headers := make([]*types.Header, 0, count)
+	for i := 0; i < count; i++ {
+		h := &types.Header{
+			Number:     new(big.Int).Add(parent.Number, big.NewInt(1)),
+			ParentHash: parent.Hash(),
+			Extra:      []byte{fork},
+		}
+		c[h.Hash()] = h
+		headers = append(headers, h)
+		parent = h
+	}
+	return headers
+}
+
+func (c testChain) fetch(_ context.Context, hash common.Hash) (*types.Header, error) {
+	h, ok := c[hash]
+	if !ok {
+		return nil, errors.New("unknown header")
+	}
+	return h, nil
+}
+
+func hashes(headers []*types.Header) []common.Hash {
+	res := make([]common.Hash, 0, len(headers))
+	for _, h := range headers {
+		res = append(res, h.Hash())
+	}
+	return res
+}
+
+// apply ... Applies the headers one by one, failing on a reorg
+func apply(t *testing.T, w *Window, c testChain, headers ...*types.Header) {
+	for _, h := range headers {
+		_, reorg, err := w.Apply(context.Background(), h, c.fetch)
+		require.NoError(t, err)
+		require.Nil(t, reorg)
+	}
+}
+
+func TestWindowApply(t *testing.T) {
+	ctx := context.Background()
+
+	newChain := func() (testChain, *types.Header) {
+		genesis := &types.Header{Number: big.NewInt(100)}
+		return testChain{genesis.Hash(): genesis}, genesis
+	}
+
+	t.Run("extends the tip", func(t *testing.T) {
+		c, genesis := newChain()
+		canonical := c.extend(genesis, 2, 0)
+		w := NewWindow(8)
+
+		apply(t, w, c, genesis)
+
+		added, reorg, err := w.Apply(ctx, canonical[0], c.fetch)
+		require.NoError(t, err)
+		require.Nil(t, reorg)
+		require.Equal(t, hashes(canonical[:1]), hashes(added))
+		require.Equal(t, canonical[0].Hash(), w.Tip().Hash())
+	})
+
+	t.Run("ignores a known head", func(t *testing.T) {
+		c, genesis := newChain()
+		canonical := c.extend(genesis, 2, 0)
+		w := NewWindow(8)
+
+		apply(t, w, c, append([]*types.Header{genesis}, canonical...)...)
+
+		added, reorg, err := w.Apply(ctx, canonical[0], c.fetch)
+		require.NoError(t, err)
+		require.Nil(t, reorg)
+		require.Empty(t, added)
+		require.Equal(t, canonical[1].Hash(), w.Tip().Hash())
+	})
+
+	t.Run("fills a gap", func(t *testing.T) {
+		c, genesis := newChain()
+		canonical := c.extend(genesis, 3, 0)
+		w := NewWindow(8)
+
+		apply(t, w, c, genesis)
+
+		added, reorg, err := w.Apply(ctx, canonical[2], c.fetch)
+		require.NoError(t, err)
+		require.Nil(t, reorg)
+		require.Equal(t, hashes(canonical), hashes(added))
+
+		for _, h := range canonical {
+			require.Equal(t, h.Hash(), w.Get(h.Number.Uint64()).Hash())
+		}
+	})
+
+	t.Run("reports a reorg", func(t *testing.T) {
+		c, genesis := newChain()
+		canonical := c.extend(genesis, 2, 0)
+		fork := c.extend(genesis, 3, 1)
+		w := NewWindow(8)
+
+		apply(t, w, c, append([]*types.Header{genesis}, canonical...)...)
+
+		added, reorg, err := w.Apply(ctx, fork[2], c.fetch)
+		require.NoError(t, err)
+		require.Equal(t, hashes(fork), hashes(added))
+
+		require.NotNil(t, reorg)
+		require.Equal(t, 2, reorg.Depth)
+		require.Equal(t, genesis.Number.Uint64(), reorg.AncestorNumber)
+		require.Equal(t, genesis.Hash(), reorg.AncestorHash)
+		require.Equal(t, hashes(canonical), reorg.OldHashes)
+		require.Equal(t, hashes(fork), reorg.NewHashes)
+
+		require.Equal(t, genesis.Hash(), w.Get(genesis.Number.Uint64()).Hash())
+		require.Equal(t, fork[2].Hash(), w.Tip().Hash())
+	})
+
+	t.Run("reports a reorg of the tip", func(t *testing.T) {
+		c, genesis := newChain()
+		canonical := c.extend(genesis, 2, 0)
+		sibling := c.extend(canonical[0], 1, 1)
+		w := NewWindow(8)
+
+		apply(t, w, c, append([]*types.Header{genesis}, canonical...)...)
+
+		added, reorg, err := w.Apply(ctx, sibling[0], c.fetch)
+		require.NoError(t, err)
+		require.Equal(t, hashes(sibling), hashes(added))
+
+		require.NotNil(t, reorg)
+		require.Equal(t, 1, reorg.Depth)
+		require.Equal(t, canonical[0].Number.Uint64(), reorg.AncestorNumber)
+		require.Equal(t, hashes(canonical[1:]), reorg.OldHashes)
+	})
+
+	t.Run("ignores a stale head", func(t *testing.T) {
+		c, genesis := newChain()
+		canonical := c.extend(genesis, 4, 0)
+		stale := c.extend(genesis, 1, 1)
+		w := NewWindow(3)
+
+		apply(t, w, c, append([]*types.Header{genesis}, canonical...)...)
+		require.Nil(t, w.Get(genesis.Number.Uint64()+1))
+
+		added, reorg, err := w.Apply(ctx, stale[0], c.fetch)
+		require.NoError(t, err)
+		require.Nil(t, reorg)
+		require.Empty(t, added)
+		require.Equal(t, canonical[3].Hash(), w.Tip().Hash())
+	})
+
+	t.Run("starts over far ahead of the tip", func(t *testing.T) {
+		c, genesis := newChain()
+		canonical := c.extend(genesis, 5, 0)
+		w := NewWindow(3)
+
+		apply(t, w, c, genesis)
+
+		added, reorg, err := w.Apply(ctx, canonical[4], c.fetch)
+		require.NoError(t, err)
+		require.Nil(t, reorg)
+		require.Equal(t, hashes(canonical[4:]), hashes(added))
+		require.Nil(t, w.Get(genesis.Number.Uint64()))
+	})
+
+	t.Run("keeps the window when a parent is missing", func(t *testing.T) {
+		c, genesis := newChain()
+		canonical := c.extend(genesis, 3, 0)
+		w := NewWindow(8)
+
+		apply(t, w, c, genesis)
+		delete(c, canonical[1].Hash())
+
+		_, _, err := w.Apply(ctx, canonical[2], c.fetch)
+		require.Error(t, err)
+		require.Equal(t, genesis.Hash(), w.Tip().Hash())
+	})
+}
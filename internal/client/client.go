@@ -12,22 +12,32 @@ import (
 	"go.uber.org/zap"
 )
 
+// Source ... Named node client delivering pending txs
+type Source struct {
+	Name       string
+	URL        string
+	NodeClient *gethclient.Client
+}
+
 type Bundle struct {
 	L1Client     *ethclient.Client
 	L1NodeClient *gethclient.Client
+	Sources      []*Source
 }
 
 type Config struct {
 	L1RpcEndpoint string
 }
 
-func NewNodeClient(rawURL string) (*gethclient.Client, error) {
-	rpcClient, err := rpc.Dial(rawURL)
+// NewNodeClient ... Dials the node. The rpc client owns the connection,
+// closing it is left to the caller
+func NewNodeClient(ctx context.Context, rawURL string) (*gethclient.Client, *rpc.Client, error) {
+	rpcClient, err := rpc.DialContext(ctx, rawURL)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
-	logging.NoContext().Debug("Successfully connected to node", zap.String("URL", rawURL))
-	return gethclient.New(rpcClient), nil
+	logging.WithContext(ctx).Debug("Successfully connected to node", zap.String("URL", rawURL))
+	return gethclient.New(rpcClient), rpcClient, nil
 }
 
 func NewBundle(ctx context.Context, cfg *core.ClientConfig) (*Bundle, error) {
@@ -39,15 +49,35 @@ func NewBundle(ctx context.Context, cfg *core.ClientConfig) (*Bundle, error) {
 		return nil, err
 	}
 
-	l1NodeClient, err := NewNodeClient(cfg.L1RpcEndpoint)
+	l1NodeClient, _, err := NewNodeClient(ctx, cfg.L1RpcEndpoint)
 	if err != nil {
 		logger.Fatal("Error creating L1 node client", zap.Error(err))
 		return nil, err
 	}
 
+	sources := make([]*Source, 0, len(cfg.Endpoints))
+	for _, endpoint := range cfg.Endpoints {
+		nodeClient := l1NodeClient
+		if endpoint.URL != cfg.L1RpcEndpoint {
+			nodeClient, _, err = NewNodeClient(ctx, endpoint.URL)
+			if err != nil {
+				logger.Fatal("Error creating source node client",
+					zap.String("source", endpoint.Name), zap.Error(err))
+				return nil, err
+			}
+		}
+
+		sources = append(sources, &Source{
+			Name:       endpoint.Name,
+			URL:        endpoint.URL,
+			NodeClient: nodeClient,
+		})
+	}
+
 	return &Bundle{
 		L1Client:     l1Client,
 		L1NodeClient: l1NodeClient,
+		Sources:      sources,
 	}, nil
 }
 
@@ -2,26 +2,149 @@ package config
 
 import (
 	"log"
+	"math/big"
 	"os"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/denzelpenzel/magic-chain/internal/core"
 	"github.com/denzelpenzel/magic-chain/internal/logging"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/joho/godotenv"
 	"github.com/urfave/cli/v2"
 	"go.uber.org/zap"
 )
 
+const (
+	defaultEndpointName = "default"
+	defaultSink         = "csv"
+	defaultWorkers      = 4
+	defaultHost         = "0.0.0.0"
+	defaultAPIPort      = 4001
+	defaultMetricsPort  = 7300
+
+	defaultStreamBufferSize = 256
+	defaultStreamDropPolicy = "drop_oldest"
+
+	defaultHeaderWindow = 64
+
+	// defaultTopic ... Topic of the default pipeline when no pipelines file
+	// is given, records pending txs. Set TOPIC=block_header to follow headers
+	defaultTopic = core.PendingTx
+
+	defaultBucketCompression = "zstd"
+	defaultChain             = "mainnet"
+
+	defaultUploadInterval = time.Minute
+	defaultUploadPartSize = 16 << 20
+	defaultUploadRetries  = 5
+
+	defaultPostgresBatchSize     = 500
+	defaultPostgresFlushInterval = time.Second
+
+	defaultL1PollInterval = 12 * time.Second
+
+	defaultReceiptBatchSize     = 50
+	defaultReceiptBatchInterval = 50 * time.Millisecond
+)
+
 type SystemConfig struct {
-	L1PollInterval int
+	// Pipeline names the pipeline the config is scoped to, see ForPipeline
+	Pipeline        string
+	Topic           core.TopicType
+	TrackInclusions bool
+	// DropTTL is the time after which a pending tx neither mined nor replaced
+	// is recorded as dropped. Detection runs in the inclusion tracker, so it
+	// needs TrackInclusions and a working new heads subscription
+	DropTTL      time.Duration
+	Sinks        []string
+	PersistDedup bool
+	Workers      int
+	// ProcessType is the process expected for the topic, zero accepts any
+	ProcessType core.ProcessType
+	// HeaderWindow is the number of recent canonical headers kept to detect reorgs
+	HeaderWindow int
+	// BucketCompression is the codec of closed buckets (none|gzip|zstd)
+	BucketCompression string
+	// BucketDuration is the time span of a bucket, from 1m to 24h
+	BucketDuration time.Duration
+	// BucketLayout is the directory template of the bucket files, see state.Layout
+	BucketLayout string
+	// Chain names the chain in bucket layouts
+	Chain string
+	// SyncInterval and SyncRows bound the rows lost on a crash, zero disables either
+	SyncInterval time.Duration
+	SyncRows     int
+
+	ReceiptBatchSize     int
+	ReceiptBatchInterval time.Duration
+
+	// LogAddresses and LogTopics filter the log subscription, empty matches every log
+	LogAddresses []common.Address
+	LogTopics    [][]common.Hash
+}
+
+type APIConfig struct {
+	Enabled bool
+	Host    string
+	Port    int
+
+	// StreamBufferSize is the number of txs buffered per live stream client
+	StreamBufferSize int
+	// StreamDropPolicy applies to clients whose buffer is full, unless they pick their own
+	StreamDropPolicy string
+}
+
+// PostgresConfig ... Database of the postgres sink
+type PostgresConfig struct {
+	URL string
+	// BatchSize is the number of buffered rows per table that triggers a flush
+	BatchSize int
+	// FlushInterval bounds the time rows stay buffered
+	FlushInterval time.Duration
+}
+
+// UploadConfig ... S3 compatible target of the sealed buckets
+type UploadConfig struct {
+	Enabled   bool
+	Endpoint  string
+	Region    string
+	AccessKey string
+	SecretKey string
+	UseSSL    bool
+	Bucket    string
+	// Prefix is prepended to the object keys, which mirror the paths below the data dirs
+	Prefix string
+
+	// Interval between two scans of the data dirs for sealed buckets
+	Interval time.Duration
+	// PartSize splits larger files into resumable multipart uploads
+	PartSize int64
+	// Retries is the number of attempts per request before a file is left for the next scan
+	Retries int
+	// DeleteLocal removes the sealed file and its manifest once they are
+	// uploaded, the upload marker stays
+	DeleteLocal bool
+}
+
+type MetricsConfig struct {
+	Enabled bool
+	Host    string
+	Port    int
 }
 
 // Config app level config defined
 type Config struct {
-	Environment  core.Env
-	DataDir      string
-	ClientConfig *core.ClientConfig
-	SystemConfig *SystemConfig
+	Environment    core.Env
+	DataDir        string
+	ClientConfig   *core.ClientConfig
+	SystemConfig   *SystemConfig
+	APIConfig      *APIConfig
+	MetricsConfig  *MetricsConfig
+	UploadConfig   *UploadConfig
+	PostgresConfig *PostgresConfig
+	Pipelines      []*Pipeline
 }
 
 func NewConfig(c *cli.Context) *Config {
@@ -32,18 +155,99 @@ func NewConfig(c *cli.Context) *Config {
 		logging.NoContext().Warn("config file not found for file: %s", zap.Any("file", envFile))
 	}
 
+	l1RpcEndpoint := getEnvStr("L1_RPC_ENDPOINT")
+
+	topic, err := core.ParseTopicType(lookupEnvStr("TOPIC", defaultTopic.String()))
+	if err != nil {
+		log.Fatalf("invalid TOPIC env var: %s", err.Error())
+	}
+
+	sinks := lookupEnvList("SINKS", []string{defaultSink})
+
+	pipelines := []*Pipeline{{Name: defaultPipelineName, Topic: topic, Sinks: sinks, DataDir: dataDir}}
+	if path := c.String("pipelines"); path != "" || lookupEnvStr("PIPELINES_FILE", "") != "" {
+		if path == "" {
+			path = lookupEnvStr("PIPELINES_FILE", "")
+		}
+		if pipelines, err = loadPipelines(path, dataDir, sinks); err != nil {
+			log.Fatalf("could not load pipelines: %s", err.Error())
+		}
+	}
+
 	return &Config{
 		Environment: core.Env(getEnvStr("ENV")),
 		DataDir:     dataDir,
 
 		ClientConfig: &core.ClientConfig{
-			L1RpcEndpoint: getEnvStr("L1_RPC_ENDPOINT"),
+			L1RpcEndpoint: l1RpcEndpoint,
+			Endpoints:     parseEndpoints(lookupEnvStr("L1_RPC_ENDPOINTS", ""), l1RpcEndpoint),
 			NumOfRetries:  getEnvInt("NUM_OF_RETRIES"),
+			PollInterval:  lookupEnvSeconds("L1_POLL_INTERVAL", defaultL1PollInterval),
+			StartHeight:   lookupEnvBigInt("L1_START_HEIGHT"),
+			EndHeight:     lookupEnvBigInt("L1_END_HEIGHT"),
 		},
 
 		SystemConfig: &SystemConfig{
-			L1PollInterval: getEnvInt("L1_POLL_INTERVAL"),
+			Topic:           topic,
+			TrackInclusions: lookupEnvBool("TRACK_INCLUSIONS", true),
+			DropTTL:         lookupEnvDuration("TX_DROP_TTL", core.TXCacheTime),
+			Sinks:           sinks,
+			PersistDedup:    lookupEnvBool("PERSIST_DEDUP", false),
+			Workers:         lookupEnvInt("WORKERS", defaultWorkers),
+			HeaderWindow:    lookupEnvInt("HEADER_WINDOW", defaultHeaderWindow),
+
+			BucketCompression: lookupEnvStr("BUCKET_COMPRESSION", defaultBucketCompression),
+			BucketDuration:    lookupEnvDuration("BUCKET_DURATION", core.DefaultBucketDuration),
+			BucketLayout:      lookupEnvStr("BUCKET_LAYOUT", core.DefaultBucketLayout),
+			Chain:             lookupEnvStr("CHAIN", defaultChain),
+			SyncInterval:      lookupEnvDuration("SYNC_INTERVAL", core.DefaultSyncInterval),
+			SyncRows:          lookupEnvInt("SYNC_ROWS", core.DefaultSyncRows),
+
+			ReceiptBatchSize:     lookupEnvInt("RECEIPT_BATCH_SIZE", defaultReceiptBatchSize),
+			ReceiptBatchInterval: lookupEnvDuration("RECEIPT_BATCH_INTERVAL", defaultReceiptBatchInterval),
+
+			LogAddresses: lookupEnvAddresses("LOG_ADDRESSES"),
+			LogTopics:    lookupEnvTopics("LOG_TOPICS"),
+		},
+
+		APIConfig: &APIConfig{
+			Enabled: lookupEnvBool("API_ENABLED", true),
+			Host:    lookupEnvStr("API_HOST", defaultHost),
+			Port:    lookupEnvInt("API_PORT", defaultAPIPort),
+
+			StreamBufferSize: lookupEnvInt("STREAM_BUFFER_SIZE", defaultStreamBufferSize),
+			StreamDropPolicy: lookupEnvStr("STREAM_DROP_POLICY", defaultStreamDropPolicy),
+		},
+
+		MetricsConfig: &MetricsConfig{
+			Enabled: lookupEnvBool("METRICS_ENABLED", true),
+			Host:    lookupEnvStr("METRICS_HOST", defaultHost),
+			Port:    lookupEnvInt("METRICS_PORT", defaultMetricsPort),
 		},
+
+		PostgresConfig: &PostgresConfig{
+			URL:           lookupEnvStr("POSTGRES_URL", ""),
+			BatchSize:     lookupEnvInt("POSTGRES_BATCH_SIZE", defaultPostgresBatchSize),
+			FlushInterval: lookupEnvDuration("POSTGRES_FLUSH_INTERVAL", defaultPostgresFlushInterval),
+		},
+
+		UploadConfig: &UploadConfig{
+			Enabled:   lookupEnvBool("UPLOAD_ENABLED", false),
+			Endpoint:  lookupEnvStr("S3_ENDPOINT", ""),
+			Region:    lookupEnvStr("S3_REGION", ""),
+			AccessKey: lookupEnvStr("S3_ACCESS_KEY", ""),
+			SecretKey: lookupEnvStr("S3_SECRET_KEY", ""),
+			UseSSL:    lookupEnvBool("S3_USE_SSL", true),
+			Bucket:    lookupEnvStr("S3_BUCKET", ""),
+			Prefix:    lookupEnvStr("S3_PREFIX", ""),
+
+			Interval:    lookupEnvDuration("UPLOAD_INTERVAL", defaultUploadInterval),
+			PartSize:    int64(lookupEnvInt("UPLOAD_PART_SIZE", defaultUploadPartSize)),
+			Retries:     lookupEnvInt("UPLOAD_RETRIES", defaultUploadRetries),
+			DeleteLocal: lookupEnvBool("UPLOAD_DELETE_LOCAL", false),
+		},
+
+		Pipelines: pipelines,
 	}
 }
 
@@ -71,6 +275,159 @@ func getEnvStr(key string) string {
 	return envVar
 }
 
+// lookupEnvStr ... Reads env var from process environment, returns def if not found
+func lookupEnvStr(key, def string) string {
+	envVar, ok := os.LookupEnv(key)
+	if !ok || envVar == "" {
+		return def
+	}
+	return envVar
+}
+
+// parseEndpoints ... Parses a comma separated list of name=url pairs.
+// Falls back to a single "default" endpoint when the list is empty
+func parseEndpoints(val, fallback string) []core.Endpoint {
+	if val == "" {
+		return []core.Endpoint{{Name: defaultEndpointName, URL: fallback}}
+	}
+
+	seen := make(map[string]struct{})
+	endpoints := make([]core.Endpoint, 0)
+
+	for _, pair := range strings.Split(val, ",") {
+		name, url, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		name, url = strings.TrimSpace(name), strings.TrimSpace(url)
+		if !ok || name == "" || url == "" {
+			log.Fatalf("invalid endpoint definition, expected name=url; got: %s", pair)
+		}
+
+		if _, exists := seen[name]; exists {
+			log.Fatalf("duplicate endpoint name: %s", name)
+		}
+		seen[name] = struct{}{}
+
+		endpoints = append(endpoints, core.Endpoint{Name: name, URL: url})
+	}
+
+	return endpoints
+}
+
+// lookupEnvBigInt ... Reads an optional base 10 integer env var, returns nil if not found
+func lookupEnvBigInt(key string) *big.Int {
+	val := lookupEnvStr(key, "")
+	if val == "" {
+		return nil
+	}
+
+	n, ok := new(big.Int).SetString(val, 10)
+	if !ok || n.Sign() < 0 {
+		log.Fatalf("env val is not a non-negative int; got: %s=%s", key, val)
+	}
+	return n
+}
+
+// lookupEnvList ... Reads an optional comma separated env var, returns def if not found
+func lookupEnvList(key string, def []string) []string {
+	val := lookupEnvStr(key, "")
+	if val == "" {
+		return def
+	}
+
+	items := make([]string, 0)
+	for _, item := range strings.Split(val, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// lookupEnvAddresses ... Reads an optional comma separated list of addresses
+func lookupEnvAddresses(key string) []common.Address {
+	addrs, err := parseAddresses(lookupEnvList(key, nil))
+	if err != nil {
+		log.Fatalf("invalid %s env var: %s", key, err.Error())
+	}
+	return addrs
+}
+
+// lookupEnvTopics ... Reads an optional log topic filter. Positions are comma
+// separated and alternatives within a position are separated by |, an empty
+// position matches any topic, e.g. 0xddf2...|0x8c5b...,,0x0000...
+func lookupEnvTopics(key string) [][]common.Hash {
+	val := lookupEnvStr(key, "")
+	if val == "" {
+		return nil
+	}
+
+	positions := make([][]string, 0)
+	for _, pos := range strings.Split(val, ",") {
+		alts := make([]string, 0)
+		for _, alt := range strings.Split(pos, "|") {
+			if alt = strings.TrimSpace(alt); alt != "" {
+				alts = append(alts, alt)
+			}
+		}
+		positions = append(positions, alts)
+	}
+
+	topics, err := parseTopics(positions)
+	if err != nil {
+		log.Fatalf("invalid %s env var: %s", key, err.Error())
+	}
+	return topics
+}
+
+// lookupEnvInt ... Reads an optional int env var, returns def if not found
+func lookupEnvInt(key string, def int) int {
+	if lookupEnvStr(key, "") == "" {
+		return def
+	}
+	return getEnvInt(key)
+}
+
+// lookupEnvBool ... Reads an optional bool env var, returns def if not found
+func lookupEnvBool(key string, def bool) bool {
+	val := lookupEnvStr(key, "")
+	if val == "" {
+		return def
+	}
+
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		log.Fatalf("env val is not bool; got: %s=%s; err: %s", key, val, err.Error())
+	}
+	return b
+}
+
+// lookupEnvDuration ... Reads an optional duration env var (e.g. 30m), returns def if not found
+func lookupEnvDuration(key string, def time.Duration) time.Duration {
+	val := lookupEnvStr(key, "")
+	if val == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		log.Fatalf("env val is not a positive duration; got: %s=%s", key, val)
+	}
+	return d
+}
+
+// lookupEnvSeconds ... Reads an optional positive whole number of seconds,
+// returns def if not found
+func lookupEnvSeconds(key string, def time.Duration) time.Duration {
+	if lookupEnvStr(key, "") == "" {
+		return def
+	}
+
+	sec := getEnvInt(key)
+	if sec <= 0 {
+		log.Fatalf("env val is not a positive number of seconds; got: %s=%d", key, sec)
+	}
+	return time.Duration(sec) * time.Second
+}
+
 // getEnvInt ... Reads env vars and converts to int
 func getEnvInt(key string) int {
 	val := getEnvStr(key)
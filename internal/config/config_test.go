@@ -0,0 +1,55 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseEndpoints(t *testing.T) {
+	tests := []struct {
+		name string
+		val  string
+		want []core.Endpoint
+	}{
+		{
+			name: "empty list falls back to the default endpoint",
+			val:  "",
+			want: []core.Endpoint{{Name: defaultEndpointName, URL: "ws://fallback"}},
+		},
+		{
+			name: "single endpoint",
+			val:  "geth=ws://geth:8546",
+			want: []core.Endpoint{{Name: "geth", URL: "ws://geth:8546"}},
+		},
+		{
+			name: "multiple endpoints keep their order and are trimmed",
+			val:  " geth = ws://geth:8546 , nethermind=ws://nm:8546",
+			want: []core.Endpoint{
+				{Name: "geth", URL: "ws://geth:8546"},
+				{Name: "nethermind", URL: "ws://nm:8546"},
+			},
+		},
+		{
+			name: "urls may contain the separator",
+			val:  "infura=wss://mainnet.infura.io/ws/v3/key?a=b",
+			want: []core.Endpoint{{Name: "infura", URL: "wss://mainnet.infura.io/ws/v3/key?a=b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, parseEndpoints(tt.val, "ws://fallback"))
+		})
+	}
+}
+
+func TestLookupEnvSeconds(t *testing.T) {
+	t.Setenv("TEST_POLL_INTERVAL", "")
+	require.Equal(t, 12*time.Second, lookupEnvSeconds("TEST_POLL_INTERVAL", 12*time.Second))
+
+	t.Setenv("TEST_POLL_INTERVAL", "3")
+	require.Equal(t, 3*time.Second, lookupEnvSeconds("TEST_POLL_INTERVAL", 12*time.Second))
+}
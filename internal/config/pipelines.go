@@ -0,0 +1,215 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+const (
+	defaultPipelineName = "default"
+)
+
+// Pipeline ... A single monitoring job, run as its own process
+type Pipeline struct {
+	Name  string
+	Topic core.TopicType
+	// ProcessType is checked against the process registered for the topic, zero accepts any
+	ProcessType core.ProcessType
+	Sinks       []string
+	// DataDir holds the buckets and dedup index of the pipeline
+	DataDir string
+	// LogAddresses and LogTopics replace the env log filter when set
+	LogAddresses []common.Address
+	LogTopics    [][]common.Hash
+}
+
+// pipelineFile ... On disk format of the pipelines file
+type pipelineFile struct {
+	Pipelines []struct {
+		Name    string   `json:"name"`
+		Topic   string   `json:"topic"`
+		Process string   `json:"process"`
+		Sinks   []string `json:"sinks"`
+		DataDir string   `json:"data_dir"`
+		// Addresses and Topics filter log pipelines, an empty topic position matches any topic
+		Addresses []string   `json:"addresses"`
+		Topics    [][]string `json:"topics"`
+	} `json:"pipelines"`
+}
+
+// loadPipelines ... Reads the pipelines file. Pipelines without sinks use the
+// default sinks and pipelines without a data dir write to <dataDir>/<name>
+func loadPipelines(path, dataDir string, defaultSinks []string) ([]*Pipeline, error) {
+	raw, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	var file pipelineFile
+	if err := json.Unmarshal(raw, &file); err != nil {
+		return nil, fmt.Errorf("invalid pipelines file %s: %w", path, err)
+	}
+
+	if len(file.Pipelines) == 0 {
+		return nil, fmt.Errorf("no pipelines defined in %s", path)
+	}
+
+	seen := make(map[string]struct{})
+	pipelines := make([]*Pipeline, 0, len(file.Pipelines))
+
+	for _, def := range file.Pipelines {
+		if def.Name == "" {
+			return nil, fmt.Errorf("pipeline without a name in %s", path)
+		}
+		if _, exists := seen[def.Name]; exists {
+			return nil, fmt.Errorf("duplicate pipeline name: %s", def.Name)
+		}
+		seen[def.Name] = struct{}{}
+
+		topic, err := core.ParseTopicType(def.Topic)
+		if err != nil {
+			return nil, fmt.Errorf("pipeline %s: %w", def.Name, err)
+		}
+
+		p := &Pipeline{
+			Name:    def.Name,
+			Topic:   topic,
+			Sinks:   def.Sinks,
+			DataDir: def.DataDir,
+		}
+
+		if def.Process != "" {
+			if p.ProcessType, err = core.ParseProcessType(def.Process); err != nil {
+				return nil, fmt.Errorf("pipeline %s: %w", def.Name, err)
+			}
+		}
+
+		if p.LogAddresses, err = parseAddresses(def.Addresses); err != nil {
+			return nil, fmt.Errorf("pipeline %s: %w", def.Name, err)
+		}
+
+		if p.LogTopics, err = parseTopics(def.Topics); err != nil {
+			return nil, fmt.Errorf("pipeline %s: %w", def.Name, err)
+		}
+
+		if len(p.Sinks) == 0 {
+			p.Sinks = defaultSinks
+		}
+
+		if p.DataDir == "" {
+			p.DataDir = filepath.Join(dataDir, def.Name)
+		}
+
+		pipelines = append(pipelines, p)
+	}
+
+	return pipelines, nil
+}
+
+// ForPipeline ... Returns a copy of the config scoped to a single pipeline.
+// Pipelines have their own stores and sinks, but share the node clients, the
+// tx index and the live stream of the app. Metrics carry the pipeline name
+func (cfg *Config) ForPipeline(p *Pipeline) *Config {
+	scoped := *cfg
+	scoped.DataDir = p.DataDir
+
+	sys := *cfg.SystemConfig
+	sys.Pipeline = p.Name
+	sys.Topic = p.Topic
+	sys.ProcessType = p.ProcessType
+	sys.Sinks = p.Sinks
+	if len(p.LogAddresses) > 0 {
+		sys.LogAddresses = p.LogAddresses
+	}
+	if len(p.LogTopics) > 0 {
+		sys.LogTopics = p.LogTopics
+	}
+	scoped.SystemConfig = &sys
+
+	return &scoped
+}
+
+// UsesSink ... Reports whether any pipeline writes to the sink
+func (cfg *Config) UsesSink(name string) bool {
+	for _, p := range cfg.Pipelines {
+		for _, s := range p.Sinks {
+			if strings.EqualFold(s, name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DataDirs ... Returns the data dirs of all pipelines, leaving out the dirs
+// nested in another one
+func (cfg *Config) DataDirs() []string {
+	dirs := make([]string, 0, len(cfg.Pipelines))
+	for _, p := range cfg.Pipelines {
+		dirs = append(dirs, filepath.Clean(p.DataDir))
+	}
+	sort.Strings(dirs)
+
+	var top []string
+	for _, dir := range dirs {
+		nested := false
+		for _, parent := range top {
+			if rel, err := filepath.Rel(parent, dir); err == nil &&
+				rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				nested = true
+				break
+			}
+		}
+		if !nested {
+			top = append(top, dir)
+		}
+	}
+
+	return top
+}
+
+// parseAddresses ... Parses hex encoded addresses
+func parseAddresses(vals []string) ([]common.Address, error) {
+	if len(vals) == 0 {
+		return nil, nil
+	}
+
+	addrs := make([]common.Address, 0, len(vals))
+	for _, val := range vals {
+		if !common.IsHexAddress(val) {
+			return nil, fmt.Errorf("invalid address %s", val)
+		}
+		addrs = append(addrs, common.HexToAddress(val))
+	}
+	return addrs, nil
+}
+
+// parseTopics ... Parses a log topic filter, each position lists the topics
+// it accepts
+func parseTopics(positions [][]string) ([][]common.Hash, error) {
+	if len(positions) == 0 {
+		return nil, nil
+	}
+
+	topics := make([][]common.Hash, 0, len(positions))
+	for _, alts := range positions {
+		hashes := make([]common.Hash, 0, len(alts))
+		for _, val := range alts {
+			raw, err := hexutil.Decode(val)
+			if err != nil || len(raw) != common.HashLength {
+				return nil, fmt.Errorf("invalid topic %s, expected 32 hex encoded bytes", val)
+			}
+			hashes = append(hashes, common.BytesToHash(raw))
+		}
+		topics = append(topics, hashes)
+	}
+	return topics, nil
+}
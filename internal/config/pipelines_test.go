@@ -0,0 +1,106 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func writePipelines(t *testing.T, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "pipelines.json")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoadPipelines(t *testing.T) {
+	addr := "0x1000000000000000000000000000000000000001"
+	topic := "0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef"
+
+	path := writePipelines(t, `{"pipelines": [
+		{"name": "pending", "topic": "pending_tx"},
+		{"name": "erc20", "topic": "log", "sinks": ["parquet"], "data_dir": "/data/erc20",
+			"addresses": ["`+addr+`"], "topics": [["`+topic+`"], []]}
+	]}`)
+
+	pipelines, err := loadPipelines(path, "/data", []string{"csv"})
+	require.NoError(t, err)
+	require.Equal(t, []*Pipeline{
+		{Name: "pending", Topic: core.PendingTx, Sinks: []string{"csv"}, DataDir: filepath.Join("/data", "pending")},
+		{
+			Name:         "erc20",
+			Topic:        core.Log,
+			Sinks:        []string{"parquet"},
+			DataDir:      "/data/erc20",
+			LogAddresses: []common.Address{common.HexToAddress(addr)},
+			LogTopics:    [][]common.Hash{{common.HexToHash(topic)}, {}},
+		},
+	}, pipelines)
+}
+
+func TestLoadPipelinesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{name: "invalid json", content: `{"pipelines": [`},
+		{name: "no pipelines", content: `{"pipelines": []}`},
+		{name: "missing name", content: `{"pipelines": [{"topic": "pending_tx"}]}`},
+		{name: "duplicate name", content: `{"pipelines": [{"name": "a", "topic": "log"}, {"name": "a", "topic": "log"}]}`},
+		{name: "unknown topic", content: `{"pipelines": [{"name": "a", "topic": "nope"}]}`},
+		{name: "unknown process", content: `{"pipelines": [{"name": "a", "topic": "log", "process": "nope"}]}`},
+		{name: "invalid address", content: `{"pipelines": [{"name": "a", "topic": "log", "addresses": ["0x12"]}]}`},
+		{name: "invalid topic", content: `{"pipelines": [{"name": "a", "topic": "log", "topics": [["0x12"]]}]}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := loadPipelines(writePipelines(t, tt.content), "/data", nil)
+			require.Error(t, err)
+		})
+	}
+
+	_, err := loadPipelines(filepath.Join(t.TempDir(), "missing.json"), "/data", nil)
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestForPipeline(t *testing.T) {
+	cfg := &Config{
+		DataDir: "/data",
+		SystemConfig: &SystemConfig{
+			Topic:        core.PendingTx,
+			Sinks:        []string{"csv"},
+			LogAddresses: []common.Address{{1}},
+		},
+	}
+
+	scoped := cfg.ForPipeline(&Pipeline{Name: "logs", Topic: core.Log, Sinks: []string{"postgres"}, DataDir: "/logs"})
+	require.Equal(t, "/logs", scoped.DataDir)
+	require.Equal(t, "logs", scoped.SystemConfig.Pipeline)
+	require.Equal(t, core.Log, scoped.SystemConfig.Topic)
+	require.Equal(t, []string{"postgres"}, scoped.SystemConfig.Sinks)
+	// the env log filter is kept unless the pipeline sets its own
+	require.Equal(t, []common.Address{{1}}, scoped.SystemConfig.LogAddresses)
+
+	// the app config is left untouched
+	require.Equal(t, "/data", cfg.DataDir)
+	require.Empty(t, cfg.SystemConfig.Pipeline)
+	require.Equal(t, core.PendingTx, cfg.SystemConfig.Topic)
+}
+
+func TestUsesSink(t *testing.T) {
+	cfg := &Config{Pipelines: []*Pipeline{
+		{Name: "txs", Sinks: []string{"csv"}},
+		{Name: "logs", Sinks: []string{"parquet", "Postgres"}},
+	}}
+
+	require.True(t, cfg.UsesSink("csv"))
+	require.True(t, cfg.UsesSink("postgres"))
+	require.False(t, cfg.UsesSink("s3"))
+	require.False(t, (&Config{}).UsesSink("csv"))
+}
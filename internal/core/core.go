@@ -1,6 +1,7 @@
 package core
 
 import (
+	"fmt"
 	"math/big"
 	"time"
 
@@ -14,10 +15,15 @@ const (
 	Production  Env = "production"
 	Local       Env = "local"
 
+	MinBackoffMs  = 500
 	MaxBackoffSec = 5
 
-	BucketMinutes = 60
-	TXCacheTime   = time.Minute * 30
+	DefaultBucketDuration = time.Hour
+	// DefaultBucketLayout ... Bucket directory template used unless configured
+	DefaultBucketLayout = "{date}/{kind}"
+	DefaultSyncInterval = time.Second
+	DefaultSyncRows     = 1000
+	TXCacheTime         = time.Minute * 30
 )
 
 const (
@@ -30,14 +36,26 @@ const (
 	Logger CtxKey = iota
 	Clients
 	State
+	Stream
+	Chain
+	Sinks
 )
 
+// Endpoint ... Named node connection used as a pending tx source
+type Endpoint struct {
+	Name string
+	URL  string
+}
+
 type ClientConfig struct {
 	L1RpcEndpoint string
-	PollInterval  int
-	NumOfRetries  int
-	StartHeight   *big.Int
-	EndHeight     *big.Int
+	Endpoints     []Endpoint
+	// PollInterval is the period the block reader polls for new blocks at
+	// once it reached the head, read from L1_POLL_INTERVAL in seconds
+	PollInterval time.Duration
+	NumOfRetries int
+	StartHeight  *big.Int
+	EndHeight    *big.Int
 }
 
 type Event struct {
@@ -52,6 +70,8 @@ type TopicType uint8
 const (
 	BlockHeader TopicType = iota + 1
 	Log
+	Block
+	PendingTx
 )
 
 func (rt TopicType) String() string {
@@ -61,11 +81,27 @@ func (rt TopicType) String() string {
 
 	case Log:
 		return "log"
+
+	case Block:
+		return "block"
+
+	case PendingTx:
+		return "pending_tx"
 	}
 
 	return UnknownType
 }
 
+// ParseTopicType ... Returns the topic type for its string representation
+func ParseTopicType(s string) (TopicType, error) {
+	for _, tt := range []TopicType{BlockHeader, Log, Block, PendingTx} {
+		if tt.String() == s {
+			return tt, nil
+		}
+	}
+	return 0, fmt.Errorf(UnknownTopicErr, s)
+}
+
 type ProcessType uint8
 
 const (
@@ -91,7 +127,18 @@ func (ct ProcessType) String() string {
 	return UnknownType
 }
 
+// ParseProcessType ... Returns the process type for its string representation
+func ParseProcessType(s string) (ProcessType, error) {
+	for _, pt := range []ProcessType{Read, Subscribe} {
+		if pt.String() == s {
+			return pt, nil
+		}
+	}
+	return 0, fmt.Errorf(UnknownCompType, s)
+}
+
 const (
 	UnknownCompType = "unknown process type %s provided"
 	CouldNotCastErr = "could not cast process initializer function to %s constructor type"
+	UnknownTopicErr = "unknown topic type %s provided"
 )
@@ -0,0 +1,58 @@
+package core
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	SelectorLength = 4
+)
+
+// TxFields ... Decoded fields of a recorded tx, shared by the sinks so
+// consumers do not have to decode the rlp and recover the sender again
+type TxFields struct {
+	Sender common.Address
+	// To is nil for contract creations
+	To        *common.Address
+	Nonce     uint64
+	Value     *big.Int
+	Gas       uint64
+	GasPrice  *big.Int
+	GasFeeCap *big.Int
+	GasTipCap *big.Int
+	Type      uint8
+	ChainID   *big.Int
+	InputSize int
+	// Selector is nil when the input is shorter than a method selector
+	Selector []byte
+	// AccessListSize is the number of addresses in the access list
+	AccessListSize int
+	BlobCount      int
+}
+
+func NewTxFields(tx *types.Transaction, sender common.Address) *TxFields {
+	f := &TxFields{
+		Sender:         sender,
+		To:             tx.To(),
+		Nonce:          tx.Nonce(),
+		Value:          tx.Value(),
+		Gas:            tx.Gas(),
+		GasPrice:       tx.GasPrice(),
+		GasFeeCap:      tx.GasFeeCap(),
+		GasTipCap:      tx.GasTipCap(),
+		Type:           tx.Type(),
+		ChainID:        tx.ChainId(),
+		InputSize:      len(tx.Data()),
+		AccessListSize: len(tx.AccessList()),
+		BlobCount:      len(tx.BlobHashes()),
+	}
+
+	if data := tx.Data(); len(data) >= SelectorLength {
+		f.Selector = data[:SelectorLength]
+	}
+
+	return f
+}
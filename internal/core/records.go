@@ -0,0 +1,97 @@
+package core
+
+import (
+	"math/big"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// Sighting ... Single delivery of a pending tx by a source
+type Sighting struct {
+	Timestamp time.Time
+	Hash      common.Hash
+	Source    string
+}
+
+// TxRecord ... First sighting of a new validated tx
+type TxRecord struct {
+	Timestamp time.Time
+	Source    string
+	Sender    common.Address
+	Tx        *types.Transaction
+}
+
+// Inclusion ... Watched tx mined in a block
+type Inclusion struct {
+	Hash              common.Hash
+	BlockNumber       uint64
+	BlockHash         common.Hash
+	BlockTime         time.Time
+	TxIndex           int
+	EffectiveGasPrice *big.Int
+	Status            uint64
+	FirstSeen         time.Time
+}
+
+type ReplacementKind string
+
+const (
+	// FeeBump ... Same sender and nonce resubmitted with higher fees
+	FeeBump ReplacementKind = "fee_bump"
+	// Underpriced ... Same sender and nonce resubmitted without raising the
+	// fees, most nodes reject it unless the first tx left their pool
+	Underpriced ReplacementKind = "underpriced"
+	// Cancel ... Same sender and nonce resubmitted as a zero value self transfer
+	Cancel ReplacementKind = "cancel"
+	// Dropped ... Watched tx never got mined within the drop ttl
+	Dropped ReplacementKind = "dropped"
+)
+
+// Replacement ... Explains why a recorded tx never landed
+type Replacement struct {
+	Timestamp time.Time
+	Kind      ReplacementKind
+	Sender    common.Address
+	Nonce     uint64
+
+	Old *types.Transaction
+	// New is nil for dropped txs
+	New *types.Transaction
+}
+
+// LogRecord ... Contract event delivered by a log subscription
+type LogRecord struct {
+	Timestamp time.Time
+	Source    string
+	// Log.Removed is set when a reorg reverted a previously delivered log
+	Log types.Log
+}
+
+// Header ... Block header that joined the canonical chain
+type Header struct {
+	Timestamp time.Time
+	Header    *types.Header
+}
+
+// Reorg ... Replacement of the tip of the canonical chain. Hashes are
+// ordered by ascending block number
+type Reorg struct {
+	Timestamp time.Time
+	// Depth is the number of orphaned blocks
+	Depth          int
+	AncestorNumber uint64
+	AncestorHash   common.Hash
+	OldHashes      []common.Hash
+	NewHashes      []common.Hash
+}
+
+// Retraction ... Recorded inclusion of a tx in a block orphaned by a reorg
+type Retraction struct {
+	Timestamp   time.Time
+	Hash        common.Hash
+	BlockNumber uint64
+	BlockHash   common.Hash
+	FirstSeen   time.Time
+}
@@ -2,6 +2,7 @@ package etl
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 
@@ -13,12 +14,27 @@ import (
 	"go.uber.org/zap"
 )
 
+const (
+	processMismatchErr   = "data topic %s is handled by a %s process, not a %s"
+	unknownPipelineErr   = "no running pipeline named %s"
+	duplicatePipelineErr = "pipeline %s is already running"
+)
+
 type ETL interface {
 	CreateProcess(cfg *config.Config) (process.Process, error)
-	Run(p process.Process) error
+	// Run starts the event loop of a process, tracked under the pipeline name
+	Run(name string, p process.Process) error
 
 	EventLoop() error
-	Shutdown(p process.Process) error
+	// Shutdown closes a single pipeline process and waits for its event loop
+	Shutdown(name string) error
+	ShutdownAll() error
+}
+
+// pipeline ... A running process and the signal of its event loop ending
+type pipeline struct {
+	process process.Process
+	done    chan struct{}
 }
 
 type etl struct {
@@ -26,28 +42,33 @@ type etl struct {
 	cancel context.CancelFunc
 
 	registry *registry.Registry
-	wg       sync.WaitGroup
+
+	mu        sync.Mutex
+	pipelines map[string]*pipeline
 }
 
 func New(ctx context.Context, r *registry.Registry) ETL {
 	ctx, cancel := context.WithCancel(ctx)
 	return &etl{
-		ctx:      ctx,
-		cancel:   cancel,
-		registry: r,
-		wg:       sync.WaitGroup{},
+		ctx:       ctx,
+		cancel:    cancel,
+		registry:  r,
+		pipelines: make(map[string]*pipeline),
 	}
 }
 
 func (e *etl) CreateProcess(cfg *config.Config) (process.Process, error) {
 	logger := logging.WithContext(e.ctx)
 
-	// hardcode
-	dt, err := e.registry.GetDataTopic(core.BlockHeader)
+	dt, err := e.registry.GetDataTopic(cfg.SystemConfig.Topic)
 	if err != nil {
 		return nil, err
 	}
 
+	if want := cfg.SystemConfig.ProcessType; want != 0 && want != dt.ProcessType {
+		return nil, fmt.Errorf(processMismatchErr, dt.DataType.String(), dt.ProcessType.String(), want.String())
+	}
+
 	logger.Debug("constructing process",
 		zap.String("type", dt.ProcessType.String()),
 		zap.String("register_type", dt.DataType.String()))
@@ -56,14 +77,18 @@ func (e *etl) CreateProcess(cfg *config.Config) (process.Process, error) {
 	case core.Subscribe:
 		init, success := dt.Constructor.(process.Constructor)
 		if !success {
-			return nil, fmt.Errorf(fmt.Sprintf(core.CouldNotCastErr, core.Read.String()))
+			return nil, fmt.Errorf(fmt.Sprintf(core.CouldNotCastErr, core.Subscribe.String()))
 		}
 
 		return init(e.ctx, cfg)
 
 	case core.Read:
-		// TODO
-		return nil, err
+		init, success := dt.Constructor.(process.Constructor)
+		if !success {
+			return nil, fmt.Errorf(fmt.Sprintf(core.CouldNotCastErr, core.Read.String()))
+		}
+
+		return init(e.ctx, cfg)
 
 	default:
 		return nil, fmt.Errorf(core.UnknownCompType, dt.ProcessType.String())
@@ -80,32 +105,73 @@ func (e *etl) EventLoop() error {
 	}
 }
 
-func (e *etl) Shutdown(p process.Process) error {
+func (e *etl) Shutdown(name string) error {
+	e.mu.Lock()
+	pl, exists := e.pipelines[name]
+	delete(e.pipelines, name)
+	e.mu.Unlock()
+
+	if !exists {
+		return fmt.Errorf(unknownPipelineErr, name)
+	}
+
+	return e.stop(name, pl)
+}
+
+func (e *etl) ShutdownAll() error {
 	e.cancel()
-	logger := logging.WithContext(e.ctx)
 
-	if err := p.Close(); err != nil {
+	e.mu.Lock()
+	pipelines := e.pipelines
+	e.pipelines = make(map[string]*pipeline)
+	e.mu.Unlock()
+
+	var errs []error
+	for name, pl := range pipelines {
+		if err := e.stop(name, pl); err != nil {
+			errs = append(errs, fmt.Errorf("pipeline %s: %w", name, err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// stop ... Closes the process of a pipeline and waits for its event loop to
+// end, a failed Close has signalled the loop as well
+func (e *etl) stop(name string, pl *pipeline) error {
+	logger := logging.WithContext(e.ctx).With(zap.String("pipeline", name))
+
+	err := pl.process.Close()
+	if err != nil {
 		logger.Error("Failed to close process", zap.Error(err))
-		return err
 	}
 
-	logger.Debug("Waiting for all process routines to end")
-	e.wg.Wait()
+	logger.Debug("Waiting for process routines to end")
+	<-pl.done
 
-	return nil
+	return err
 }
 
-func (e *etl) Run(p process.Process) error {
-	e.wg.Add(1)
+func (e *etl) Run(name string, p process.Process) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if _, exists := e.pipelines[name]; exists {
+		return fmt.Errorf(duplicatePipelineErr, name)
+	}
+
+	pl := &pipeline{process: p, done: make(chan struct{})}
+	e.pipelines[name] = pl
 
-	go func(p process.Process, wg *sync.WaitGroup) {
-		defer wg.Done()
-		logging.NoContext().Debug("Starting process")
+	go func() {
+		defer close(pl.done)
+		logger := logging.NoContext().With(zap.String("pipeline", name))
+		logger.Debug("Starting process")
 
 		if err := p.EventLoop(); err != nil {
-			logging.NoContext().Error("Obtained error from event loop", zap.Error(err))
+			logger.Error("Obtained error from event loop", zap.Error(err))
 		}
-	}(p, &e.wg)
+	}()
 
 	return nil
 }
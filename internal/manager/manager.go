@@ -2,20 +2,19 @@ package manager
 
 import (
 	"context"
+	"fmt"
 	"sync"
 
 	"github.com/denzelpenzel/magic-chain/internal/config"
 	"github.com/denzelpenzel/magic-chain/internal/etl"
 	"github.com/denzelpenzel/magic-chain/internal/logging"
-	"github.com/denzelpenzel/magic-chain/internal/process"
 	"go.uber.org/zap"
 )
 
 type Manager struct {
-	ctx     context.Context
-	cfg     *config.Config
-	etl     etl.ETL
-	process process.Process
+	ctx context.Context
+	cfg *config.Config
+	etl etl.ETL
 
 	*sync.WaitGroup
 }
@@ -53,17 +52,52 @@ func (m *Manager) EventLoop() error {
 }
 
 func (m *Manager) Shutdown() error {
-	if err := m.etl.Shutdown(m.process); err != nil {
-		return err
+	return m.etl.ShutdownAll()
+}
+
+// StopPipeline ... Shuts down a single pipeline, leaving the others running
+func (m *Manager) StopPipeline(name string) error {
+	return m.etl.Shutdown(name)
+}
+
+// Run ... Constructs and starts a process for every configured pipeline. When
+// one fails, the pipelines started before it are shut down again
+func (m *Manager) Run() error {
+	logger := logging.WithContext(m.ctx)
+
+	started := make([]string, 0, len(m.cfg.Pipelines))
+	for _, pl := range m.cfg.Pipelines {
+		err := m.runPipeline(pl)
+		if err == nil {
+			logger.Info("Started pipeline",
+				zap.String("pipeline", pl.Name),
+				zap.String("topic", pl.Topic.String()),
+				zap.Strings("sinks", pl.Sinks))
+			started = append(started, pl.Name)
+			continue
+		}
+
+		logger.Error("Failed to start pipeline", zap.String("pipeline", pl.Name), zap.Error(err))
+		for _, name := range started {
+			if stopErr := m.etl.Shutdown(name); stopErr != nil {
+				logger.Error("Failed to stop pipeline", zap.String("pipeline", name), zap.Error(stopErr))
+			}
+		}
+		return fmt.Errorf("pipeline %s: %w", pl.Name, err)
 	}
+
 	return nil
 }
 
-func (m *Manager) Run() error {
-	p, err := m.etl.CreateProcess(m.cfg)
+func (m *Manager) runPipeline(pl *config.Pipeline) error {
+	p, err := m.etl.CreateProcess(m.cfg.ForPipeline(pl))
 	if err != nil {
 		return err
 	}
-	m.process = p
-	return m.etl.Run(p)
+
+	if err := m.etl.Run(pl.Name, p); err != nil {
+		_ = p.Close()
+		return err
+	}
+	return nil
 }
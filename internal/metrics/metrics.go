@@ -0,0 +1,168 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/logging"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.uber.org/zap"
+)
+
+const (
+	namespace = "magic_chain"
+
+	metricsPath       = "/metrics"
+	readHeaderTimeout = 5 * time.Second
+)
+
+var (
+	TxsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "txs_received_total",
+		Help:      "Pending txs delivered per source, including duplicates",
+	}, []string{"pipeline", "source"})
+
+	LogsReceived = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "logs_received_total",
+		Help:      "Contract event logs delivered per source, removed logs are reverted by reorgs",
+	}, []string{"pipeline", "source", "removed"})
+
+	DuplicatesSkipped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "duplicates_skipped_total",
+		Help:      "Txs skipped because they were already recorded",
+	}, []string{"pipeline"})
+
+	ValidationFailures = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "validation_failures_total",
+		Help:      "Txs rejected by validation per reason",
+	}, []string{"pipeline", "reason"})
+
+	AlreadyIncluded = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "already_included_total",
+		Help:      "Pending txs skipped because they were already mined",
+	}, []string{"pipeline"})
+
+	SinkWriteErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "sink_write_errors_total",
+		Help:      "Failed sink writes per sink and record type",
+	}, []string{"pipeline", "sink", "op"})
+
+	QueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "job_queue_depth",
+		Help:      "Events waiting in the job queue or for a worker",
+	}, []string{"pipeline"})
+
+	WorkerUtilisation = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "worker_utilisation_ratio",
+		Help:      "Share of worker time spent processing events",
+	}, []string{"pipeline"})
+
+	SubscriptionReconnects = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "subscription_reconnects_total",
+		Help:      "Successful resubscriptions per source",
+	}, []string{"pipeline", "source"})
+
+	ReorgDepth = promauto.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "reorg_depth_blocks",
+		Help:      "Orphaned blocks per detected reorg",
+		Buckets:   prometheus.ExponentialBuckets(1, 2, 7),
+	})
+
+	InclusionsRetracted = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "inclusions_retracted_total",
+		Help:      "Recorded inclusions retracted because their block got orphaned",
+	})
+
+	StreamClients = promauto.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "stream_clients",
+		Help:      "Connected live stream clients",
+	})
+
+	StreamDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stream_dropped_total",
+		Help:      "Txs not delivered to slow stream clients per drop policy",
+	}, []string{"policy"})
+
+	RPCLatency = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rpc_latency_seconds",
+		Help:      "Latency of node RPC calls per method",
+		Buckets:   prometheus.ExponentialBuckets(0.005, 2, 12),
+	}, []string{"method"})
+
+	UploadedFiles = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploaded_files_total",
+		Help:      "Sealed buckets uploaded to object storage",
+	})
+
+	UploadedBytes = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "uploaded_bytes_total",
+		Help:      "Bytes sent to object storage, including retried parts",
+	})
+
+	UploadFailures = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "upload_failures_total",
+		Help:      "Sealed bucket uploads that failed and are retried on the next scan",
+	})
+)
+
+// ObserveRPC ... Records the latency of an RPC call started at start
+func ObserveRPC(method string, start time.Time) {
+	RPCLatency.WithLabelValues(method).Observe(time.Since(start).Seconds())
+}
+
+// Server ... HTTP server exposing the metrics endpoint
+type Server struct {
+	srv *http.Server
+}
+
+func NewServer(host string, port int) *Server {
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, promhttp.Handler())
+
+	return &Server{
+		srv: &http.Server{
+			Addr:              net.JoinHostPort(host, strconv.Itoa(port)),
+			Handler:           mux,
+			ReadHeaderTimeout: readHeaderTimeout,
+		},
+	}
+}
+
+// Start ... Serves metrics in the background
+func (s *Server) Start() {
+	logger := logging.NoContext()
+	logger.Info("Starting metrics server", zap.String("addr", s.srv.Addr))
+
+	go func() {
+		if err := s.srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error("Metrics server failed", zap.Error(err))
+		}
+	}()
+}
+
+func (s *Server) Shutdown(ctx context.Context) error {
+	return s.srv.Shutdown(ctx)
+}
@@ -0,0 +1,209 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/logging"
+	"github.com/denzelpenzel/magic-chain/internal/metrics"
+	"github.com/denzelpenzel/magic-chain/internal/sink"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+)
+
+type BlockRoutine interface {
+	Name() string
+	Height(ctx context.Context) (*big.Int, error)
+	Block(ctx context.Context, number *big.Int) (*types.Block, error)
+}
+
+// BlockReader ... Walks mined blocks from StartHeight to EndHeight, or to the
+// chain head and then keeps following it, storing every included tx. A block
+// is read again when one of its txs reached no sink, the txs stored before
+// are skipped by the dedup store
+type BlockReader struct {
+	ctx context.Context
+
+	routine  BlockRoutine
+	store    *state.FileStore
+	sink     sink.Sink
+	start    *big.Int
+	end      *big.Int
+	interval time.Duration
+	close    *closeSignal
+
+	wg *sync.WaitGroup
+}
+
+func NewBlockReader(ctx context.Context, cfg *config.Config, store *state.FileStore, s sink.Sink,
+	r BlockRoutine) (Process, error) {
+	start, end := cfg.ClientConfig.StartHeight, cfg.ClientConfig.EndHeight
+	if start != nil && end != nil && start.Cmp(end) > 0 {
+		return nil, fmt.Errorf("start height %s is above end height %s", start, end)
+	}
+
+	br := &BlockReader{
+		ctx:      ctx,
+		routine:  r,
+		store:    store,
+		sink:     s,
+		start:    start,
+		end:      end,
+		interval: cfg.ClientConfig.PollInterval,
+		wg:       &sync.WaitGroup{},
+		close:    newCloseSignal(),
+	}
+
+	return br, nil
+}
+
+func (br *BlockReader) Close() error {
+	br.close.send()
+	br.wg.Wait()
+	return errors.Join(br.sink.Close(), br.store.Close())
+}
+
+func (br *BlockReader) EventLoop() error {
+	if !br.close.start() {
+		return nil
+	}
+
+	logger := logging.WithContext(br.ctx).With(zap.String("source", br.routine.Name()))
+	logger.Debug("Starting block reader job")
+
+	jobCtx, cancel := context.WithCancel(br.ctx)
+	defer cancel()
+
+	ticker := time.NewTicker(br.interval)
+	defer ticker.Stop()
+
+	var next *big.Int
+	if br.start != nil {
+		next = new(big.Int).Set(br.start)
+	}
+
+	for {
+		var err error
+		next, err = br.readUntilHead(jobCtx, next)
+		if err != nil {
+			logger.Error("Failed to read blocks", zap.Error(err))
+		}
+
+		if br.end != nil && next != nil && next.Cmp(br.end) > 0 {
+			logger.Info("Block range backfill completed",
+				zap.String("start", br.start.String()),
+				zap.String("end", br.end.String()))
+
+			<-br.close.ch
+			logger.Debug("Shutting down block reader process")
+			return nil
+		}
+
+		select {
+		case <-ticker.C:
+		case <-br.close.ch:
+			logger.Debug("Shutting down block reader process")
+			return nil
+		}
+	}
+}
+
+// readUntilHead ... Reads blocks starting at next up to the end height or the
+// current head and returns the next height to read
+func (br *BlockReader) readUntilHead(ctx context.Context, next *big.Int) (*big.Int, error) {
+	head := br.end
+	if head == nil {
+		start := time.Now()
+		height, err := br.routine.Height(ctx)
+		metrics.ObserveRPC("eth_blockNumber", start)
+		if err != nil {
+			return next, err
+		}
+		head = height
+	}
+
+	if next == nil {
+		next = new(big.Int).Set(head)
+	}
+
+	for ; next.Cmp(head) <= 0; next = new(big.Int).Add(next, big.NewInt(1)) {
+		select {
+		case <-ctx.Done():
+			return next, ctx.Err()
+		default:
+		}
+
+		start := time.Now()
+		block, err := br.routine.Block(ctx, next)
+		metrics.ObserveRPC("eth_getBlockByNumber", start)
+		if err != nil {
+			return next, err
+		}
+
+		if err := br.processBlock(block); err != nil {
+			return next, err
+		}
+	}
+
+	return next, nil
+}
+
+func (br *BlockReader) processBlock(block *types.Block) error {
+	logger := logging.WithContext(br.ctx)
+
+	ts := time.Unix(int64(block.Time()), 0).UTC() //nolint:gosec // block timestamps fit into int64
+
+	logger.Debug("Processing block",
+		zap.Uint64("number", block.NumberU64()),
+		zap.Int("txs", len(block.Transactions())))
+
+	for _, tx := range block.Transactions() {
+		event := core.Event{Timestamp: ts, Value: tx, Source: br.routine.Name()}
+		if err := br.processTx(event); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (br *BlockReader) processTx(event core.Event) error {
+	txHashLower := strings.ToLower(event.Value.Hash().Hex())
+
+	if _, err := br.store.GetTx(txHashLower); err == nil {
+		return nil
+	}
+
+	// mined txs are already valid, an unrecoverable sender is left empty
+	sender, err := types.Sender(types.LatestSignerForChainID(event.Value.ChainId()), event.Value)
+	if err != nil {
+		logging.WithContext(br.ctx).Debug("Failed to recover tx sender",
+			zap.String("txHash", txHashLower), zap.Error(err))
+	}
+
+	err = br.sink.WriteTx(&core.TxRecord{
+		Timestamp: event.Timestamp,
+		Source:    event.Source,
+		Sender:    sender,
+		Tx:        event.Value,
+	})
+	var partial *sink.PartialWriteError
+	if errors.As(err, &partial) {
+		// retrying the block would duplicate the tx in the sinks that stored it
+		logging.WithContext(br.ctx).Error("Failed to store tx in some sinks",
+			zap.String("txHash", txHashLower), zap.Strings("sinks", partial.Failed), zap.Error(err))
+	} else if err != nil {
+		return err
+	}
+
+	_, err = br.store.SetTx(txHashLower, event.Timestamp)
+	return err
+}
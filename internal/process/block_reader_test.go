@@ -0,0 +1,87 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/sink"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"github.com/stretchr/testify/require"
+)
+
+type failingSink struct {
+	name string
+	err  error
+	txs  int
+}
+
+func (f *failingSink) Name() string                       { return f.name }
+func (f *failingSink) WriteSighting(*core.Sighting) error { return nil }
+func (f *failingSink) Close() error                       { return nil }
+
+func (f *failingSink) WriteTx(*core.TxRecord) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.txs++
+	return nil
+}
+
+func TestBlockReaderSinkErrors(t *testing.T) {
+	errDown := errors.New("down")
+	event := core.Event{Timestamp: time.Unix(1_700_000_000, 0), Value: legacyTx(1, 10, testRecipient, 5)}
+	key := strings.ToLower(event.Value.Hash().Hex())
+
+	newReader := func(s sink.Sink) *BlockReader {
+		store := state.NewFileStore(t.TempDir())
+		t.Cleanup(func() { _ = store.Close() })
+		return &BlockReader{ctx: context.Background(), store: store, sink: s}
+	}
+
+	t.Run("a partial failure is not retried", func(t *testing.T) {
+		ok := &failingSink{name: "ok"}
+		br := newReader(sink.NewMulti(ok, &failingSink{name: "down", err: errDown}))
+
+		require.NoError(t, br.processTx(event))
+		require.NoError(t, br.processTx(event))
+		require.Equal(t, 1, ok.txs)
+
+		_, err := br.store.GetTx(key)
+		require.NoError(t, err)
+	})
+
+	t.Run("a tx stored nowhere fails the block", func(t *testing.T) {
+		br := newReader(sink.NewMulti(&failingSink{name: "down", err: errDown}))
+
+		require.ErrorIs(t, br.processTx(event), errDown)
+
+		_, err := br.store.GetTx(key)
+		require.Error(t, err)
+	})
+}
+
+func TestCloseWithoutEventLoop(t *testing.T) {
+	cfg := &config.Config{ClientConfig: &core.ClientConfig{}, SystemConfig: &config.SystemConfig{}}
+	store := state.NewFileStore(t.TempDir())
+	p, err := NewBlockReader(context.Background(), cfg, store, &failingSink{name: "csv"}, nil)
+	require.NoError(t, err)
+
+	// the process was never run, e.g. the etl refused its pipeline name
+	closed := make(chan error, 1)
+	go func() { closed <- p.Close() }()
+
+	select {
+	case err := <-closed:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("Close blocked on an event loop that never started")
+	}
+
+	// a loop started after Close ends right away
+	require.NoError(t, p.EventLoop())
+}
@@ -0,0 +1,203 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/chain"
+	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/logging"
+	"github.com/denzelpenzel/magic-chain/internal/metrics"
+	"github.com/denzelpenzel/magic-chain/internal/sink"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+)
+
+type HeaderRoutine interface {
+	Name() string
+	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
+	HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error)
+	Redial(ctx context.Context) error
+}
+
+// HeaderFollower ... Follows new block headers and keeps a window of the
+// canonical chain. Reorgs are stored and published to the reorg feed so the
+// inclusions recorded for orphaned blocks get retracted
+type HeaderFollower struct {
+	ctx context.Context
+
+	routine  HeaderRoutine
+	window   *chain.Window
+	feed     *chain.Feed
+	store    *state.FileStore
+	sink     sink.Sink
+	pipeline string
+	retries  int
+	close    *closeSignal
+
+	wg *sync.WaitGroup
+}
+
+func NewHeaderFollower(ctx context.Context, cfg *config.Config, store *state.FileStore, s sink.Sink,
+	r HeaderRoutine) (Process, error) {
+	hf := &HeaderFollower{
+		ctx:      ctx,
+		routine:  r,
+		window:   chain.NewWindow(cfg.SystemConfig.HeaderWindow),
+		store:    store,
+		sink:     s,
+		pipeline: cfg.SystemConfig.Pipeline,
+		retries:  cfg.ClientConfig.NumOfRetries,
+		close:    newCloseSignal(),
+		wg:       &sync.WaitGroup{},
+	}
+
+	// reorgs reach the inclusion trackers of the other pipelines through the feed
+	if feed, err := chain.FeedFromContext(ctx); err == nil {
+		hf.feed = feed
+	}
+
+	return hf, nil
+}
+
+func (hf *HeaderFollower) Close() error {
+	hf.close.send()
+	hf.wg.Wait()
+	return errors.Join(hf.sink.Close(), hf.store.Close())
+}
+
+func (hf *HeaderFollower) EventLoop() error {
+	if !hf.close.start() {
+		return nil
+	}
+
+	logger := logging.WithContext(hf.ctx).With(zap.String("source", hf.routine.Name()))
+	logger.Debug("Starting header follower job")
+
+	jobCtx, cancel := context.WithCancel(hf.ctx)
+
+	hf.wg.Add(1)
+	go hf.subscribe(jobCtx)
+
+	<-hf.close.ch
+	logger.Debug("Shutting down header follower process")
+	cancel()
+	return nil
+}
+
+// subscribe ... Runs the header subscription, redialing with capped
+// exponential backoff until the retry budget is spent. Blocks missed while
+// disconnected are fetched once the next header arrives
+func (hf *HeaderFollower) subscribe(ctx context.Context) {
+	defer hf.wg.Done()
+
+	logger := logging.WithContext(hf.ctx).With(zap.String("source", hf.routine.Name()))
+
+	run := func(ctx context.Context, connected func()) error {
+		headers := make(chan *types.Header)
+
+		sub, err := hf.routine.SubscribeNewHead(ctx, headers)
+		if err != nil {
+			return err
+		}
+		connected()
+
+		return hf.consume(ctx, sub, headers)
+	}
+
+	resubscribe(ctx, logger, hf.pipeline, hf.routine.Name(), "new headers", hf.retries, run, hf.routine.Redial)
+}
+
+// consume ... Applies headers until the subscription fails or ctx is done.
+// Returns nil only when ctx is done
+func (hf *HeaderFollower) consume(ctx context.Context, sub ethereum.Subscription, headers chan *types.Header) error {
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case err := <-sub.Err():
+			if err == nil {
+				err = fmt.Errorf("subscription closed")
+			}
+			return err
+
+		case header := <-headers:
+			if err := hf.processHeader(ctx, header); err != nil {
+				logging.WithContext(hf.ctx).Error("Failed to process header",
+					zap.Uint64("block", header.Number.Uint64()), zap.Error(err))
+			}
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (hf *HeaderFollower) processHeader(ctx context.Context, header *types.Header) error {
+	logger := logging.WithContext(hf.ctx)
+
+	added, reorg, err := hf.window.Apply(ctx, header, hf.headerByHash)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().UTC()
+	for _, h := range added {
+		logger.Debug("New canonical header",
+			zap.Uint64("number", h.Number.Uint64()),
+			zap.String("hash", h.Hash().Hex()))
+
+		if err := writeHeader(hf.sink, &core.Header{Timestamp: now, Header: h}); err != nil {
+			logger.Error("Failed to store header", zap.Error(err))
+		}
+	}
+
+	if reorg == nil {
+		return nil
+	}
+
+	logger.Warn("Detected chain reorg",
+		zap.Int("depth", reorg.Depth),
+		zap.Uint64("ancestor", reorg.AncestorNumber),
+		zap.Stringers("old", reorg.OldHashes),
+		zap.Stringers("new", reorg.NewHashes))
+	metrics.ReorgDepth.Observe(float64(reorg.Depth))
+
+	if err := writeReorg(hf.sink, reorg); err != nil {
+		logger.Error("Failed to store reorg", zap.Error(err))
+	}
+
+	if hf.feed != nil {
+		hf.feed.Publish(ctx, reorg)
+	}
+
+	return nil
+}
+
+func (hf *HeaderFollower) headerByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	start := time.Now()
+	header, err := hf.routine.HeaderByHash(ctx, hash)
+	metrics.ObserveRPC("eth_getBlockByHash", start)
+	return header, err
+}
+
+func writeHeader(s sink.Sink, h *core.Header) error {
+	if w, ok := s.(sink.HeaderWriter); ok {
+		return w.WriteHeader(h)
+	}
+	return nil
+}
+
+func writeReorg(s sink.Sink, r *core.Reorg) error {
+	if w, ok := s.(sink.ReorgWriter); ok {
+		return w.WriteReorg(r)
+	}
+	return nil
+}
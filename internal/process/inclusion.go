@@ -0,0 +1,482 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/chain"
+	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/logging"
+	"github.com/denzelpenzel/magic-chain/internal/metrics"
+	"github.com/denzelpenzel/magic-chain/internal/sink"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+)
+
+const (
+	headersSource = "headers"
+
+	// inclusionRetainBlocks is how long recorded inclusions can be retracted by a reorg
+	inclusionRetainBlocks = 128
+	// maxGapBlocks caps the missed blocks scanned when a header skips ahead,
+	// e.g. after a long resubscribe gap
+	maxGapBlocks = 256
+)
+
+// HeadRoutine ... Node access required to follow new blocks
+type HeadRoutine interface {
+	SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error)
+	BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error)
+	BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error)
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+type watchedTx struct {
+	tx        *types.Transaction
+	key       nonceKey
+	firstSeen time.Time
+	replaced  bool
+}
+
+// includedTx ... Recorded inclusion, kept to watch the tx and its nonce
+// siblings again if the block gets orphaned
+type includedTx struct {
+	hash      common.Hash
+	firstSeen time.Time
+	unwatched []*watchedTx
+}
+
+type includedBlock struct {
+	number uint64
+	txs    []*includedTx
+}
+
+// InclusionTracker ... Follows new block headers and records when and where
+// the watched pending txs get mined. Txs that are neither mined nor replaced
+// within the drop ttl are recorded as dropped, checked on every new header so
+// nothing is recorded while the header subscription is down
+type InclusionTracker struct {
+	ctx context.Context
+
+	routine  HeadRoutine
+	sink     sink.Sink
+	pipeline string
+	retries  int
+	dropTTL  time.Duration
+	reorgs   *chain.Feed
+
+	watched map[common.Hash]*watchedTx
+	byNonce map[nonceKey]map[common.Hash]struct{}
+	// included is keyed by block hash, guarded by the watched lock as well
+	included    map[common.Hash]*includedBlock
+	watchedLock sync.Mutex
+
+	// lastBlock is the last block scanned without errors, the blocks between
+	// it and a new header are scanned before the header. Owned by Run
+	lastBlock uint64
+}
+
+type TrackerOption = func(*InclusionTracker)
+
+// WithReorgFeed ... Retracts the inclusions recorded for blocks orphaned by
+// the reorgs of the feed and watches their txs again
+func WithReorgFeed(f *chain.Feed) TrackerOption {
+	return func(it *InclusionTracker) {
+		it.reorgs = f
+	}
+}
+
+func NewInclusionTracker(ctx context.Context, cfg *config.Config, r HeadRoutine, s sink.Sink,
+	opts ...TrackerOption) *InclusionTracker {
+	it := &InclusionTracker{
+		ctx:      ctx,
+		routine:  r,
+		sink:     s,
+		pipeline: cfg.SystemConfig.Pipeline,
+		retries:  cfg.ClientConfig.NumOfRetries,
+		dropTTL:  cfg.SystemConfig.DropTTL,
+		watched:  make(map[common.Hash]*watchedTx),
+		byNonce:  make(map[nonceKey]map[common.Hash]struct{}),
+		included: make(map[common.Hash]*includedBlock),
+	}
+
+	for _, opt := range opts {
+		opt(it)
+	}
+
+	return it
+}
+
+// Watch ... Adds a recorded pending tx to the watch list
+func (it *InclusionTracker) Watch(tx *types.Transaction, sender common.Address, firstSeen time.Time) {
+	it.watchedLock.Lock()
+	defer it.watchedLock.Unlock()
+
+	if _, exists := it.watched[tx.Hash()]; exists {
+		return
+	}
+
+	it.watch(&watchedTx{tx: tx, key: nonceKey{sender: sender, nonce: tx.Nonce()}, firstSeen: firstSeen})
+}
+
+// watch ... Must be called with the watched lock held
+func (it *InclusionTracker) watch(w *watchedTx) {
+	it.watched[w.tx.Hash()] = w
+
+	if _, ok := it.byNonce[w.key]; !ok {
+		it.byNonce[w.key] = make(map[common.Hash]struct{})
+	}
+	it.byNonce[w.key][w.tx.Hash()] = struct{}{}
+}
+
+// MarkReplaced ... Keeps watching a replaced tx in case it still gets mined,
+// but no longer reports it as dropped
+func (it *InclusionTracker) MarkReplaced(hash common.Hash) {
+	it.watchedLock.Lock()
+	defer it.watchedLock.Unlock()
+
+	if w, ok := it.watched[hash]; ok {
+		w.replaced = true
+	}
+}
+
+// unwatch ... Removes the tx and, once it is mined, all txs sharing its nonce.
+// Returns the removed txs. Must be called with the watched lock held
+func (it *InclusionTracker) unwatch(hash common.Hash, siblings bool) []*watchedTx {
+	w, ok := it.watched[hash]
+	if !ok {
+		return nil
+	}
+
+	removed := []*watchedTx{w}
+	delete(it.watched, hash)
+	delete(it.byNonce[w.key], hash)
+
+	if siblings {
+		for sibling := range it.byNonce[w.key] {
+			removed = append(removed, it.watched[sibling])
+			delete(it.watched, sibling)
+		}
+		delete(it.byNonce, w.key)
+	}
+
+	if len(it.byNonce[w.key]) == 0 {
+		delete(it.byNonce, w.key)
+	}
+
+	return removed
+}
+
+// Run ... Follows new block headers until ctx is done, resubscribing with
+// capped exponential backoff when the subscription fails
+func (it *InclusionTracker) Run(ctx context.Context) {
+	logger := logging.WithContext(it.ctx).With(zap.String("source", headersSource))
+
+	var reorgs <-chan *core.Reorg
+	if it.reorgs != nil {
+		ch, unsubscribe := it.reorgs.Subscribe(ctx)
+		defer unsubscribe()
+		reorgs = ch
+	}
+
+	run := func(ctx context.Context, connected func()) error {
+		headers := make(chan *types.Header)
+
+		sub, err := it.routine.SubscribeNewHead(ctx, headers)
+		if err != nil {
+			return err
+		}
+		connected()
+
+		return it.follow(ctx, sub, headers, reorgs)
+	}
+
+	// the tracker shares the node client of the bundle, it is never redialed
+	resubscribe(ctx, logger, it.pipeline, headersSource, "inclusion headers", it.retries, run, nil)
+}
+
+// follow ... Processes headers until the subscription fails or ctx is done.
+// Returns nil only when ctx is done
+func (it *InclusionTracker) follow(ctx context.Context, sub ethereum.Subscription,
+	headers chan *types.Header, reorgs <-chan *core.Reorg) error {
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case err := <-sub.Err():
+			if err == nil {
+				err = fmt.Errorf("subscription closed")
+			}
+			return err
+
+		case header := <-headers:
+			if err := it.processHeader(ctx, header); err != nil {
+				logging.WithContext(it.ctx).Error("Failed to process header",
+					zap.Uint64("block", header.Number.Uint64()), zap.Error(err))
+			}
+
+		case r := <-reorgs:
+			it.processReorg(ctx, r)
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// processHeader ... Scans the blocks missed since the last scanned block and
+// the block of the header. Expired txs are only evicted once every block up
+// to the header got scanned, a failed block is scanned again with the next
+// header
+func (it *InclusionTracker) processHeader(ctx context.Context, header *types.Header) error {
+	number := header.Number.Uint64()
+
+	it.watchedLock.Lock()
+	empty := len(it.watched) == 0
+	it.watchedLock.Unlock()
+
+	if !empty {
+		if err := it.fillGap(ctx, number); err != nil {
+			return err
+		}
+
+		if err := it.processBlock(ctx, header.Hash()); err != nil {
+			return err
+		}
+	}
+
+	it.lastBlock = number
+	it.evictExpired()
+
+	return nil
+}
+
+// fillGap ... Scans the blocks after the last scanned block up to number,
+// which the node skipped or which were mined while resubscribing
+func (it *InclusionTracker) fillGap(ctx context.Context, number uint64) error {
+	if it.lastBlock == 0 || number <= it.lastBlock+1 {
+		return nil
+	}
+
+	from := it.lastBlock + 1
+	if number-from > maxGapBlocks {
+		logging.WithContext(it.ctx).Warn("Skipping blocks missed by the inclusion tracker",
+			zap.Uint64("from", from), zap.Uint64("to", number-maxGapBlocks-1))
+		from = number - maxGapBlocks
+	}
+
+	for n := from; n < number; n++ {
+		start := time.Now()
+		block, err := it.routine.BlockByNumber(ctx, new(big.Int).SetUint64(n))
+		metrics.ObserveRPC("eth_getBlockByNumber", start)
+		if err != nil {
+			return err
+		}
+
+		if err := it.scanBlock(ctx, block); err != nil {
+			return err
+		}
+		it.lastBlock = n
+	}
+
+	return nil
+}
+
+func (it *InclusionTracker) processBlock(ctx context.Context, hash common.Hash) error {
+	start := time.Now()
+	block, err := it.routine.BlockByHash(ctx, hash)
+	metrics.ObserveRPC("eth_getBlockByHash", start)
+	if err != nil {
+		return err
+	}
+
+	return it.scanBlock(ctx, block)
+}
+
+// scanBlock ... Records the inclusions of the watched txs mined in the block.
+// A tx is only unwatched once its inclusion is stored, the failed ones are
+// returned and stay watched for the next scan of the block
+func (it *InclusionTracker) scanBlock(ctx context.Context, block *types.Block) error {
+	blockTime := time.Unix(int64(block.Time()), 0).UTC() //nolint:gosec // block timestamps fit into int64
+
+	var errs []error
+	for idx, tx := range block.Transactions() {
+		it.watchedLock.Lock()
+		w, ok := it.watched[tx.Hash()]
+		it.watchedLock.Unlock()
+
+		if !ok {
+			continue
+		}
+
+		if err := it.recordInclusion(ctx, block, blockTime, idx, tx, w.firstSeen); err != nil {
+			logging.WithContext(it.ctx).Error("Failed to record inclusion",
+				zap.String("txHash", tx.Hash().Hex()), zap.Error(err))
+			errs = append(errs, err)
+			continue
+		}
+
+		it.watchedLock.Lock()
+		unwatched := it.unwatch(tx.Hash(), true)
+		it.watchedLock.Unlock()
+
+		it.addIncluded(block, &includedTx{hash: tx.Hash(), firstSeen: w.firstSeen, unwatched: unwatched})
+	}
+
+	it.pruneIncluded(block.NumberU64())
+
+	return errors.Join(errs...)
+}
+
+func (it *InclusionTracker) addIncluded(block *types.Block, itx *includedTx) {
+	it.watchedLock.Lock()
+	defer it.watchedLock.Unlock()
+
+	ib, ok := it.included[block.Hash()]
+	if !ok {
+		ib = &includedBlock{number: block.NumberU64()}
+		it.included[block.Hash()] = ib
+	}
+	ib.txs = append(ib.txs, itx)
+}
+
+// pruneIncluded ... Forgets inclusions too deep to be orphaned
+func (it *InclusionTracker) pruneIncluded(head uint64) {
+	it.watchedLock.Lock()
+	defer it.watchedLock.Unlock()
+
+	for hash, ib := range it.included {
+		if ib.number+inclusionRetainBlocks < head {
+			delete(it.included, hash)
+		}
+	}
+}
+
+// processReorg ... Retracts the inclusions of the orphaned blocks, watches
+// their txs again and rescans the blocks that replaced them
+func (it *InclusionTracker) processReorg(ctx context.Context, r *core.Reorg) {
+	logger := logging.WithContext(it.ctx)
+
+	var retractions []*core.Retraction
+
+	it.watchedLock.Lock()
+	for _, hash := range r.OldHashes {
+		ib, ok := it.included[hash]
+		if !ok {
+			continue
+		}
+		delete(it.included, hash)
+
+		for _, itx := range ib.txs {
+			for _, w := range itx.unwatched {
+				it.watch(w)
+			}
+
+			retractions = append(retractions, &core.Retraction{
+				Timestamp:   r.Timestamp,
+				Hash:        itx.hash,
+				BlockNumber: ib.number,
+				BlockHash:   hash,
+				FirstSeen:   itx.firstSeen,
+			})
+		}
+	}
+	it.watchedLock.Unlock()
+
+	for _, rt := range retractions {
+		logger.Info("Retracting inclusion of orphaned block",
+			zap.String("txHash", rt.Hash.Hex()),
+			zap.Uint64("block", rt.BlockNumber))
+		metrics.InclusionsRetracted.Inc()
+
+		if err := writeRetraction(it.sink, rt); err != nil {
+			logger.Error("Failed to record retraction",
+				zap.String("txHash", rt.Hash.Hex()), zap.Error(err))
+		}
+	}
+
+	if len(retractions) == 0 {
+		return
+	}
+
+	for _, hash := range r.NewHashes {
+		if err := it.processBlock(ctx, hash); err != nil {
+			logger.Error("Failed to rescan canonical block",
+				zap.String("block", hash.Hex()), zap.Error(err))
+		}
+	}
+}
+
+func writeRetraction(s sink.Sink, r *core.Retraction) error {
+	if w, ok := s.(sink.ReorgWriter); ok {
+		return w.WriteRetraction(r)
+	}
+	return nil
+}
+
+func (it *InclusionTracker) recordInclusion(ctx context.Context, block *types.Block, blockTime time.Time,
+	idx int, tx *types.Transaction, firstSeen time.Time) error {
+	w, ok := it.sink.(sink.InclusionWriter)
+	if !ok {
+		return nil
+	}
+
+	start := time.Now()
+	receipt, err := it.routine.TransactionReceipt(ctx, tx.Hash())
+	metrics.ObserveRPC(receiptMethod, start)
+	if err != nil {
+		return err
+	}
+
+	return w.WriteInclusion(&core.Inclusion{
+		Hash:              tx.Hash(),
+		BlockNumber:       block.NumberU64(),
+		BlockHash:         block.Hash(),
+		BlockTime:         blockTime,
+		TxIndex:           idx,
+		EffectiveGasPrice: receipt.EffectiveGasPrice,
+		Status:            receipt.Status,
+		FirstSeen:         firstSeen,
+	})
+}
+
+// evictExpired ... Stops watching txs that were not mined within the drop ttl
+// and records the ones that were not replaced either as dropped
+func (it *InclusionTracker) evictExpired() {
+	now := time.Now().UTC()
+	var dropped []*watchedTx
+
+	it.watchedLock.Lock()
+	for hash, w := range it.watched {
+		if now.Sub(w.firstSeen) <= it.dropTTL {
+			continue
+		}
+
+		if !w.replaced {
+			dropped = append(dropped, w)
+		}
+		it.unwatch(hash, false)
+	}
+	it.watchedLock.Unlock()
+
+	for _, w := range dropped {
+		err := writeReplacement(it.sink, &core.Replacement{
+			Timestamp: now,
+			Kind:      core.Dropped,
+			Sender:    w.key.sender,
+			Nonce:     w.key.nonce,
+			Old:       w.tx,
+		})
+		if err != nil {
+			logging.WithContext(it.ctx).Error("Failed to record dropped tx",
+				zap.String("txHash", w.tx.Hash().Hex()), zap.Error(err))
+		}
+	}
+}
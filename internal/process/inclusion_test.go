@@ -0,0 +1,133 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeHeadRoutine ... Serves a fixed chain of blocks
+type fakeHeadRoutine struct {
+	blocks     map[uint64]*types.Block
+	receiptErr error
+}
+
+func (f *fakeHeadRoutine) SubscribeNewHead(context.Context, chan<- *types.Header) (ethereum.Subscription, error) {
+	return nil, errors.New("not subscribable")
+}
+
+func (f *fakeHeadRoutine) BlockByHash(_ context.Context, hash common.Hash) (*types.Block, error) {
+	for _, b := range f.blocks {
+		if b.Hash() == hash {
+			return b, nil
+		}
+	}
+	return nil, ethereum.NotFound
+}
+
+func (f *fakeHeadRoutine) BlockByNumber(_ context.Context, number *big.Int) (*types.Block, error) {
+	if b, ok := f.blocks[number.Uint64()]; ok {
+		return b, nil
+	}
+	return nil, ethereum.NotFound
+}
+
+func (f *fakeHeadRoutine) TransactionReceipt(context.Context, common.Hash) (*types.Receipt, error) {
+	if f.receiptErr != nil {
+		return nil, f.receiptErr
+	}
+	return &types.Receipt{Status: types.ReceiptStatusSuccessful, EffectiveGasPrice: big.NewInt(7)}, nil
+}
+
+func (f *fakeHeadRoutine) add(number uint64, txs ...*types.Transaction) *types.Block {
+	header := &types.Header{Number: new(big.Int).SetUint64(number), Time: 1_700_000_000 + number}
+	b := types.NewBlockWithHeader(header).WithBody(types.Body{Transactions: txs})
+	f.blocks[number] = b
+	return b
+}
+
+// inclusionSink ... Records the inclusions and replacements written by the tracker
+type inclusionSink struct {
+	failingSink
+	inclusions   []*core.Inclusion
+	replacements []*core.Replacement
+}
+
+func (s *inclusionSink) WriteInclusion(i *core.Inclusion) error {
+	s.inclusions = append(s.inclusions, i)
+	return nil
+}
+
+func (s *inclusionSink) WriteReplacement(r *core.Replacement) error {
+	s.replacements = append(s.replacements, r)
+	return nil
+}
+
+func newTestTracker(t *testing.T) (*InclusionTracker, *fakeHeadRoutine, *inclusionSink) {
+	t.Helper()
+
+	r := &fakeHeadRoutine{blocks: make(map[uint64]*types.Block)}
+	s := &inclusionSink{failingSink: failingSink{name: "inclusions"}}
+	cfg := &config.Config{ClientConfig: &core.ClientConfig{}, SystemConfig: &config.SystemConfig{DropTTL: time.Minute}}
+	return NewInclusionTracker(context.Background(), cfg, r, s), r, s
+}
+
+func TestInclusionTrackerFillsHeaderGaps(t *testing.T) {
+	ctx := context.Background()
+	it, r, s := newTestTracker(t)
+
+	require.NoError(t, it.processHeader(ctx, r.add(10).Header()))
+
+	// the tx expires with the next header unless its block gets scanned
+	tx := dynamicTx(1, 2, 10, testRecipient, 5)
+	it.Watch(tx, testSender, time.Now().Add(-2*time.Minute))
+
+	mined := r.add(11, tx)
+	// the node skips block 11 and announces 12 right away
+	require.NoError(t, it.processHeader(ctx, r.add(12).Header()))
+
+	require.Len(t, s.inclusions, 1)
+	require.Equal(t, tx.Hash(), s.inclusions[0].Hash)
+	require.Equal(t, mined.Hash(), s.inclusions[0].BlockHash)
+	require.Equal(t, uint64(11), s.inclusions[0].BlockNumber)
+	require.Empty(t, s.replacements)
+	require.Empty(t, it.watched)
+	require.Equal(t, uint64(12), it.lastBlock)
+}
+
+func TestInclusionTrackerRetriesFailedReceipts(t *testing.T) {
+	ctx := context.Background()
+	it, r, s := newTestTracker(t)
+
+	require.NoError(t, it.processHeader(ctx, r.add(10).Header()))
+
+	tx := dynamicTx(1, 2, 10, testRecipient, 5)
+	it.Watch(tx, testSender, time.Now().Add(-2*time.Minute))
+
+	r.receiptErr = errors.New("receipt unavailable")
+	require.Error(t, it.processHeader(ctx, r.add(11, tx).Header()))
+
+	// the tx stays watched and is neither recorded nor dropped
+	require.Empty(t, s.inclusions)
+	require.Empty(t, s.replacements)
+	require.Contains(t, it.watched, tx.Hash())
+	require.Equal(t, uint64(10), it.lastBlock)
+
+	// block 11 is scanned again before the next header
+	r.receiptErr = nil
+	require.NoError(t, it.processHeader(ctx, r.add(12).Header()))
+
+	require.Len(t, s.inclusions, 1)
+	require.Equal(t, uint64(11), s.inclusions[0].BlockNumber)
+	require.Empty(t, s.replacements)
+	require.Empty(t, it.watched)
+}
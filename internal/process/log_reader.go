@@ -0,0 +1,162 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/logging"
+	"github.com/denzelpenzel/magic-chain/internal/metrics"
+	"github.com/denzelpenzel/magic-chain/internal/sink"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"go.uber.org/zap"
+)
+
+const (
+	logQueueSize = 100
+)
+
+type LogRoutine interface {
+	Name() string
+	SubscribeLogs(ctx context.Context, q ethereum.FilterQuery, ch chan<- types.Log) (ethereum.Subscription, error)
+	Redial(ctx context.Context) error
+}
+
+// LogReader ... Subscribes to the contract event logs matching the configured
+// addresses and topics and stores them, including logs removed by reorgs
+type LogReader struct {
+	ctx context.Context
+
+	routine  LogRoutine
+	query    ethereum.FilterQuery
+	store    *state.FileStore
+	sink     sink.Sink
+	pipeline string
+	retries  int
+	close    *closeSignal
+
+	wg *sync.WaitGroup
+}
+
+func NewLogReader(ctx context.Context, cfg *config.Config, store *state.FileStore, s sink.Sink,
+	r LogRoutine) (Process, error) {
+	return &LogReader{
+		ctx:     ctx,
+		routine: r,
+		query: ethereum.FilterQuery{
+			Addresses: cfg.SystemConfig.LogAddresses,
+			Topics:    cfg.SystemConfig.LogTopics,
+		},
+		store:    store,
+		sink:     s,
+		pipeline: cfg.SystemConfig.Pipeline,
+		retries:  cfg.ClientConfig.NumOfRetries,
+		close:    newCloseSignal(),
+		wg:       &sync.WaitGroup{},
+	}, nil
+}
+
+func (lr *LogReader) Close() error {
+	lr.close.send()
+	lr.wg.Wait()
+	return errors.Join(lr.sink.Close(), lr.store.Close())
+}
+
+func (lr *LogReader) EventLoop() error {
+	if !lr.close.start() {
+		return nil
+	}
+
+	logger := logging.WithContext(lr.ctx).With(zap.String("source", lr.routine.Name()))
+	logger.Debug("Starting log reader job",
+		zap.Int("addresses", len(lr.query.Addresses)),
+		zap.Int("topic_positions", len(lr.query.Topics)))
+
+	jobCtx, cancel := context.WithCancel(lr.ctx)
+
+	lr.wg.Add(1)
+	go lr.subscribe(jobCtx)
+
+	<-lr.close.ch
+	logger.Debug("Shutting down log reader process")
+	cancel()
+	return nil
+}
+
+// subscribe ... Runs the log subscription, redialing with capped exponential
+// backoff until the retry budget is spent. Logs emitted while disconnected
+// are not recovered
+func (lr *LogReader) subscribe(ctx context.Context) {
+	defer lr.wg.Done()
+
+	logger := logging.WithContext(lr.ctx).With(zap.String("source", lr.routine.Name()))
+
+	run := func(ctx context.Context, connected func()) error {
+		logs := make(chan types.Log, logQueueSize)
+
+		sub, err := lr.routine.SubscribeLogs(ctx, lr.query, logs)
+		if err != nil {
+			return err
+		}
+		connected()
+
+		return lr.consume(ctx, sub, logs)
+	}
+
+	resubscribe(ctx, logger, lr.pipeline, lr.routine.Name(), "logs", lr.retries, run, lr.routine.Redial)
+}
+
+// consume ... Stores logs until the subscription fails or ctx is done.
+// Returns nil only when ctx is done
+func (lr *LogReader) consume(ctx context.Context, sub ethereum.Subscription, logs chan types.Log) error {
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case err := <-sub.Err():
+			if err == nil {
+				err = fmt.Errorf("subscription closed")
+			}
+			return err
+
+		case l := <-logs:
+			lr.processLog(l)
+
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (lr *LogReader) processLog(l types.Log) {
+	logger := logging.WithContext(lr.ctx)
+
+	logger.Debug("Processing log",
+		zap.String("txHash", l.TxHash.Hex()),
+		zap.Uint("logIndex", l.Index),
+		zap.Bool("removed", l.Removed))
+	metrics.LogsReceived.WithLabelValues(lr.pipeline, lr.routine.Name(), strconv.FormatBool(l.Removed)).Inc()
+
+	err := writeLog(lr.sink, &core.LogRecord{
+		Timestamp: time.Now().UTC(),
+		Source:    lr.routine.Name(),
+		Log:       l,
+	})
+	if err != nil {
+		logger.Error("Failed to store log", zap.Error(err))
+	}
+}
+
+func writeLog(s sink.Sink, l *core.LogRecord) error {
+	if w, ok := s.(sink.LogWriter); ok {
+		return w.WriteLog(l)
+	}
+	return nil
+}
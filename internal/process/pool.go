@@ -0,0 +1,157 @@
+package process
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// PoolStats ... Snapshot used to size the worker pool
+type PoolStats struct {
+	Workers int
+	// QueueDepth is the number of events waiting for a worker
+	QueueDepth    int
+	QueueCapacity int
+	// Busy is the number of workers currently processing an event
+	Busy int
+	// Utilisation is the share of worker time spent processing since the last snapshot
+	Utilisation float64
+}
+
+// WorkerPool ... Processes events in parallel. Events are sharded by sender, so
+// the txs of a sender, and every sighting of a tx, are handled in arrival order
+// by the same worker
+type WorkerPool struct {
+	queues []chan core.Event
+	handle func(core.Event)
+
+	busy      atomic.Int64
+	busyNanos atomic.Int64
+	// inflight counts the submitted events not yet handled
+	inflight sync.WaitGroup
+
+	statsLock sync.Mutex
+	lastStats time.Time
+	lastBusy  int64
+}
+
+func NewWorkerPool(workers, queueSize int, handle func(core.Event)) *WorkerPool {
+	if workers < 1 {
+		workers = 1
+	}
+
+	queues := make([]chan core.Event, workers)
+	for i := range queues {
+		queues[i] = make(chan core.Event, queueSize)
+	}
+
+	return &WorkerPool{
+		queues:    queues,
+		handle:    handle,
+		lastStats: time.Now(),
+	}
+}
+
+// Start ... Runs the workers until ctx is done
+func (p *WorkerPool) Start(ctx context.Context, wg *sync.WaitGroup) {
+	for _, queue := range p.queues {
+		wg.Add(1)
+		go p.work(ctx, queue, wg)
+	}
+}
+
+func (p *WorkerPool) work(ctx context.Context, queue chan core.Event, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	for {
+		select {
+		case event := <-queue:
+			p.busy.Add(1)
+			start := time.Now()
+
+			p.handle(event)
+
+			p.busyNanos.Add(int64(time.Since(start)))
+			p.busy.Add(-1)
+			p.inflight.Done()
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Submit ... Queues the event on the worker owning its sender. Blocks while
+// that worker's queue is full, returns false if ctx is done first
+func (p *WorkerPool) Submit(ctx context.Context, event core.Event) bool {
+	shard := p.shard(event.Value)
+
+	p.inflight.Add(1)
+
+	select {
+	case p.queues[shard] <- event:
+		return true
+	case <-ctx.Done():
+		p.inflight.Done()
+		return false
+	}
+}
+
+// shard ... Index of the worker owning the tx sender. The recovered sender is
+// cached in the tx, validation reuses it. Txs without a valid signature are
+// sharded by hash and fail validation later
+func (p *WorkerPool) shard(tx *types.Transaction) uint {
+	key := tx.Hash().Bytes()
+	if sender, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx); err == nil {
+		key = sender.Bytes()
+	}
+	return (uint(key[0])<<8 | uint(key[1])) % uint(len(p.queues))
+}
+
+// Wait ... Blocks until every submitted event is handled. Must not be called
+// concurrently with Submit
+func (p *WorkerPool) Wait() {
+	p.inflight.Wait()
+}
+
+// QueueDepth ... Number of events waiting for a worker. Unlike Stats it does
+// not start a new utilisation window
+func (p *WorkerPool) QueueDepth() int {
+	depth := 0
+	for _, queue := range p.queues {
+		depth += len(queue)
+	}
+	return depth
+}
+
+// Stats ... Snapshot of the pool, the utilisation covers the time since the
+// previous snapshot
+func (p *WorkerPool) Stats() PoolStats {
+	stats := PoolStats{
+		Workers: len(p.queues),
+		Busy:    int(p.busy.Load()),
+	}
+
+	stats.QueueDepth = p.QueueDepth()
+	for _, queue := range p.queues {
+		stats.QueueCapacity += cap(queue)
+	}
+
+	p.statsLock.Lock()
+	defer p.statsLock.Unlock()
+
+	now := time.Now()
+	busyNanos := p.busyNanos.Load()
+
+	if elapsed := now.Sub(p.lastStats); elapsed > 0 {
+		stats.Utilisation = float64(busyNanos-p.lastBusy) / float64(elapsed.Nanoseconds()*int64(len(p.queues)))
+	}
+
+	p.lastStats, p.lastBusy = now, busyNanos
+
+	return stats
+}
@@ -0,0 +1,100 @@
+package process
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/stretchr/testify/require"
+)
+
+func signedTx(t *testing.T, key *ecdsa.PrivateKey, nonce uint64) *types.Transaction {
+	t.Helper()
+
+	signer := types.LatestSignerForChainID(big.NewInt(1))
+	tx, err := types.SignNewTx(key, signer, &types.DynamicFeeTx{
+		ChainID:   big.NewInt(1),
+		Nonce:     nonce,
+		GasTipCap: big.NewInt(1),
+		GasFeeCap: big.NewInt(10),
+		Gas:       21000,
+		To:        &testRecipient,
+	})
+	require.NoError(t, err)
+	return tx
+}
+
+func TestWorkerPoolShardsBySender(t *testing.T) {
+	const workers, senders, nonces = 8, 16, 20
+
+	var (
+		lock    sync.Mutex
+		handled = make(map[string][]uint64)
+	)
+
+	keys := make([]*ecdsa.PrivateKey, senders)
+	for i := range keys {
+		key, err := crypto.GenerateKey()
+		require.NoError(t, err)
+		keys[i] = key
+	}
+
+	pool := NewWorkerPool(workers, senders*nonces, func(event core.Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		handled[event.Source] = append(handled[event.Source], event.Value.Nonce())
+	})
+
+	for nonce := uint64(0); nonce < nonces; nonce++ {
+		for i, key := range keys {
+			tx := signedTx(t, key, nonce)
+			require.Equal(t, pool.shard(signedTx(t, key, nonce+1)), pool.shard(tx))
+
+			event := core.Event{Timestamp: time.Now(), Value: tx, Source: strconv.Itoa(i)}
+			require.True(t, pool.Submit(context.Background(), event))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var wg sync.WaitGroup
+	pool.Start(ctx, &wg)
+	pool.Wait()
+
+	// every sender's txs are handled in nonce order
+	require.Len(t, handled, senders)
+	for sender, got := range handled {
+		require.Len(t, got, nonces, "sender %s", sender)
+		for i, nonce := range got {
+			require.Equal(t, uint64(i), nonce, "sender %s", sender)
+		}
+	}
+}
+
+func TestReaderQueueDepth(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+
+	cfg := &config.Config{ClientConfig: &core.ClientConfig{}, SystemConfig: &config.SystemConfig{Workers: 2}}
+	cr := NewReplayReader(context.Background(), cfg, nil, nil)
+
+	// workers are not started, every event stays queued
+	for nonce := uint64(0); nonce < 3; nonce++ {
+		require.NoError(t, cr.Push(context.Background(), core.Event{Value: signedTx(t, key, nonce)}))
+	}
+	cr.jobEvents <- core.Event{Value: signedTx(t, key, 3)}
+
+	require.Equal(t, 3, cr.pool.QueueDepth())
+	require.Equal(t, 4, cr.queueDepth())
+	require.Equal(t, 4, cr.Stats().QueueDepth)
+	require.Equal(t, 3*jobQueueSize, cr.Stats().QueueCapacity)
+}
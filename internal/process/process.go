@@ -2,6 +2,7 @@ package process
 
 import (
 	"context"
+	"sync"
 
 	"github.com/denzelpenzel/magic-chain/internal/config"
 )
@@ -18,3 +19,38 @@ type Process interface {
 type (
 	Constructor = func(context.Context, *config.Config) (Process, error)
 )
+
+// closeSignal ... Shutdown signal of a process event loop. Closing a process
+// whose loop never started does not block, e.g. when the etl refused to run
+// it, and a loop started after Close returns right away
+type closeSignal struct {
+	ch      chan int
+	lock    sync.Mutex
+	started bool
+	closed  bool
+}
+
+func newCloseSignal() *closeSignal {
+	return &closeSignal{ch: make(chan int)}
+}
+
+// start ... Marks the loop as running, false when the process is closed
+func (c *closeSignal) start() bool {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.started = !c.closed
+	return c.started
+}
+
+// send ... Hands the signal to the running loop, if any
+func (c *closeSignal) send() {
+	c.lock.Lock()
+	c.closed = true
+	started := c.started
+	c.lock.Unlock()
+
+	if started {
+		c.ch <- killSig
+	}
+}
@@ -2,6 +2,7 @@ package process
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 	"strings"
@@ -9,10 +10,14 @@ import (
 	"time"
 
 	"github.com/denzelpenzel/magic-chain/internal/client"
+	"github.com/denzelpenzel/magic-chain/internal/config"
 	"github.com/denzelpenzel/magic-chain/internal/core"
 	"github.com/denzelpenzel/magic-chain/internal/logging"
+	"github.com/denzelpenzel/magic-chain/internal/metrics"
+	"github.com/denzelpenzel/magic-chain/internal/sink"
 	"github.com/denzelpenzel/magic-chain/internal/state"
-	"github.com/denzelpenzel/magic-chain/internal/utils"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
 	ethcore "github.com/ethereum/go-ethereum/core"
 	"github.com/ethereum/go-ethereum/core/txpool"
 	"github.com/ethereum/go-ethereum/core/types"
@@ -22,82 +27,311 @@ import (
 )
 
 type Routine interface {
+	Name() string
 	Loop(ctx context.Context, processChan chan *types.Transaction) (*rpc.ClientSubscription, error)
-	Height() (*big.Int, error)
+	Redial(ctx context.Context) error
+	Height(ctx context.Context) (*big.Int, error)
 }
+
+const (
+	jobQueueSize      = 100
+	poolStatsInterval = time.Second * 30
+	// shutdownDrainTimeout bounds the time spent processing queued txs on close
+	shutdownDrainTimeout = time.Second * 30
+)
+
 type ChainReader struct {
 	ctx context.Context
+	// jobCtx outlives ctx while the queued txs are drained on shutdown
+	jobCtx context.Context
 
-	routine   Routine
+	routines  []Routine
 	jobEvents chan core.Event
-	close     chan int
+	close     *closeSignal
 	store     *state.FileStore
+	sink      sink.Sink
+	pipeline  string
+	retries   int
+	tracker   *InclusionTracker
+	index     *NonceIndex
+	pool      *WorkerPool
+	receipts  ReceiptFetcher
+	batcher   *ReceiptBatcher
+
+	// checking holds the txs waiting for a batched receipt lookup, so further
+	// sightings are skipped until the first one is stored or dropped
+	checking     map[common.Hash]struct{}
+	checkingLock sync.Mutex
+	// lookups counts the batched receipt lookups not yet finished
+	lookups sync.WaitGroup
 
 	wg *sync.WaitGroup
 }
 
-func NewReader(ctx context.Context, r Routine, store *state.FileStore) (Process, error) {
+type ReaderOption = func(*ChainReader)
+
+// WithInclusionTracker ... Watches every recorded tx until it gets mined
+func WithInclusionTracker(t *InclusionTracker) ReaderOption {
+	return func(cr *ChainReader) {
+		cr.tracker = t
+	}
+}
+
+// WithReceiptBatcher ... Batches the inclusion check receipt lookups. Workers
+// do not wait for the lookup, the tx is stored or dropped once its batch returns
+func WithReceiptBatcher(b *ReceiptBatcher) ReaderOption {
+	return func(cr *ChainReader) {
+		cr.batcher = b
+	}
+}
+
+func NewReader(ctx context.Context, cfg *config.Config, store *state.FileStore, s sink.Sink,
+	routines []Routine, opts ...ReaderOption) (Process, error) {
+	if len(routines) == 0 {
+		return nil, fmt.Errorf("no read routines provided")
+	}
+
+	l1Client, err := client.FromNetwork(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cr := newChainReader(ctx, cfg, store, s, routines)
+	cr.receipts = l1Client
+
+	for _, opt := range opts {
+		opt(cr)
+	}
+
+	return cr, nil
+}
+
+// NewReplayReader ... Builds a reader without read routines and node access,
+// txs are fed through Push and are not checked for inclusion
+func NewReplayReader(ctx context.Context, cfg *config.Config, store *state.FileStore, s sink.Sink,
+	opts ...ReaderOption) *ChainReader {
+	cr := newChainReader(ctx, cfg, store, s, nil)
+
+	for _, opt := range opts {
+		opt(cr)
+	}
+
+	return cr
+}
+
+func newChainReader(ctx context.Context, cfg *config.Config, store *state.FileStore, s sink.Sink,
+	routines []Routine) *ChainReader {
 	cr := &ChainReader{
 		ctx:       ctx,
-		routine:   r,
-		jobEvents: make(chan core.Event, 100),
+		jobCtx:    ctx,
+		routines:  routines,
+		jobEvents: make(chan core.Event, jobQueueSize),
 		wg:        &sync.WaitGroup{},
-		close:     make(chan int),
+		close:     newCloseSignal(),
 		store:     store,
+		sink:      s,
+		pipeline:  cfg.SystemConfig.Pipeline,
+		retries:   cfg.ClientConfig.NumOfRetries,
+		index:     NewNonceIndex(cfg.SystemConfig.DropTTL),
+		checking:  make(map[common.Hash]struct{}),
 	}
 
-	return cr, nil
+	cr.pool = NewWorkerPool(cfg.SystemConfig.Workers, jobQueueSize, cr.processTx)
+
+	return cr
 }
 
 func (cr *ChainReader) Close() error {
-	cr.close <- killSig
+	cr.close.send()
 	cr.wg.Wait()
-	return nil
+	return errors.Join(cr.sink.Close(), cr.store.Close())
 }
 
 func (cr *ChainReader) EventLoop() error {
+	if !cr.close.start() {
+		return nil
+	}
+
 	logger := logging.WithContext(cr.ctx)
 	logger.Debug("Starting process job")
 
-	jobCtx, cancel := context.WithCancel(cr.ctx)
+	// the queued txs are still processed after the process context is
+	// cancelled on shutdown, only the subscriptions stop right away
+	jobCtx, cancel := context.WithCancel(context.WithoutCancel(cr.ctx))
+	subCtx, cancelSubs := context.WithCancel(cr.ctx)
+	defer cancelSubs()
+	cr.jobCtx = jobCtx
+
+	cr.pool.Start(jobCtx, cr.wg)
+
+	subs := &sync.WaitGroup{}
+	for _, r := range cr.routines {
+		cr.wg.Add(1)
+		subs.Add(1)
+		go func(r Routine) {
+			defer subs.Done()
+			cr.subscribe(subCtx, r)
+		}(r)
+	}
+
+	if cr.tracker != nil {
+		cr.wg.Add(1)
+		go func() {
+			defer cr.wg.Done()
+			cr.tracker.Run(jobCtx)
+		}()
+	}
+
+	if cr.batcher != nil {
+		cr.wg.Add(1)
+		go func() {
+			defer cr.wg.Done()
+			cr.batcher.Run(jobCtx)
+		}()
+	}
+
+	evictTicker := time.NewTicker(time.Minute)
+	defer evictTicker.Stop()
+
+	statsTicker := time.NewTicker(poolStatsInterval)
+	defer statsTicker.Stop()
 
-	cr.wg.Add(1)
+	for {
+		select {
+		case event := <-cr.jobEvents:
+			logger.Info("Received the new event", zap.Any("event", event))
+			cr.pool.Submit(jobCtx, event)
+			metrics.QueueDepth.WithLabelValues(cr.pipeline).Set(float64(cr.queueDepth()))
+
+		case now := <-evictTicker.C:
+			cr.index.Evict(now)
+
+		case <-statsTicker.C:
+			stats := cr.Stats()
+			logger.Info("Worker pool stats",
+				zap.Int("workers", stats.Workers),
+				zap.Int("busy", stats.Busy),
+				zap.Int("queue_depth", stats.QueueDepth),
+				zap.Int("queue_capacity", stats.QueueCapacity),
+				zap.Float64("utilisation", stats.Utilisation))
+			metrics.WorkerUtilisation.WithLabelValues(cr.pipeline).Set(stats.Utilisation)
+			metrics.QueueDepth.WithLabelValues(cr.pipeline).Set(float64(stats.QueueDepth))
+
+		case <-cr.close.ch:
+			logger.Debug("Shutting down reader process")
+			cancelSubs()
+			subs.Wait()
+			cr.drain(jobCtx)
+			cancel()
+			return nil
+		}
+	}
+}
+
+// drain ... Hands the queued txs to the workers and waits until they are
+// processed, giving up after shutdownDrainTimeout
+func (cr *ChainReader) drain(ctx context.Context) {
+	logger := logging.WithContext(cr.ctx)
 
+	ctx, cancel := context.WithTimeout(ctx, shutdownDrainTimeout)
+	defer cancel()
+
+	queued := len(cr.jobEvents)
+	for i := 0; i < queued; i++ {
+		if !cr.pool.Submit(ctx, <-cr.jobEvents) {
+			break
+		}
+	}
+
+	done := make(chan struct{})
 	go func() {
-		defer cr.wg.Done()
+		cr.pool.Wait()
+		cr.lookups.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		logger.Debug("Drained job queue", zap.Int("events", queued))
+	case <-ctx.Done():
+		logger.Warn("Timed out draining job queue",
+			zap.Int("events", queued),
+			zap.Int("pending", cr.pool.QueueDepth()))
+	}
+}
+
+// Push ... Hands an event straight to the worker pool, blocking while the
+// worker owning its tx is busy. Used to replay recorded txs
+func (cr *ChainReader) Push(ctx context.Context, event core.Event) error {
+	if !cr.pool.Submit(ctx, event) {
+		return ctx.Err()
+	}
+	return nil
+}
+
+// Drain ... Waits until every pushed event is processed
+func (cr *ChainReader) Drain() {
+	cr.pool.Wait()
+}
+
+// Stats ... Worker pool stats including the events not yet dispatched to a worker
+func (cr *ChainReader) Stats() PoolStats {
+	stats := cr.pool.Stats()
+	stats.QueueDepth = cr.queueDepth()
+	stats.QueueCapacity += cap(cr.jobEvents)
+	return stats
+}
 
+// queueDepth ... Events not yet picked up by a worker
+func (cr *ChainReader) queueDepth() int {
+	return cr.pool.QueueDepth() + len(cr.jobEvents)
+}
+
+// subscribe ... Runs a single routine subscription and forwards its txs
+// to the job queue tagged with the routine name. A failed subscription is
+// redialed with capped exponential backoff until the retry budget is spent
+func (cr *ChainReader) subscribe(ctx context.Context, r Routine) {
+	defer cr.wg.Done()
+
+	logger := logging.WithContext(cr.ctx).With(zap.String("source", r.Name()))
+
+	run := func(ctx context.Context, connected func()) error {
 		localTx := make(chan *types.Transaction)
 
-		sub, err := cr.routine.Loop(cr.ctx, localTx)
+		sub, err := r.Loop(ctx, localTx)
 		if err != nil {
-			logger.Error("Received error from read routine", zap.Error(err))
-			return
+			return err
 		}
+		connected()
 
-		for {
-			select {
-			case err = <-sub.Err():
-				logger.Error("Subscription error.", zap.Error(err))
-				return
+		return cr.consume(ctx, r, sub, localTx)
+	}
 
-			case tx := <-localTx:
-				cr.jobEvents <- core.Event{Timestamp: time.Now().UTC(), Value: tx}
+	resubscribe(ctx, logger, cr.pipeline, r.Name(), "pending txs", cr.retries, run, r.Redial)
+}
 
-			case <-jobCtx.Done():
-				return
-			}
-		}
-	}()
+// consume ... Forwards txs until the subscription fails or ctx is done.
+// Returns nil only when ctx is done
+func (cr *ChainReader) consume(ctx context.Context, r Routine, sub *rpc.ClientSubscription,
+	localTx chan *types.Transaction) error {
+	defer sub.Unsubscribe()
 
 	for {
 		select {
-		case event := <-cr.jobEvents:
-			logger.Info("Received the new event", zap.Any("event", event))
-			cr.processTx(event)
+		case err := <-sub.Err():
+			if err == nil {
+				err = fmt.Errorf("subscription closed")
+			}
+			return err
 
-		case <-cr.close:
-			logger.Debug("Shutting down reader process")
-			cancel()
+		case tx := <-localTx:
+			select {
+			case cr.jobEvents <- core.Event{Timestamp: time.Now().UTC(), Value: tx, Source: r.Name()}:
+			case <-ctx.Done():
+				return nil
+			}
+
+		case <-ctx.Done():
 			return nil
 		}
 	}
@@ -110,60 +344,95 @@ func (cr *ChainReader) processTx(event core.Event) {
 	txHashLower := strings.ToLower(tx.Hash().Hex())
 
 	logger.Debug("Processing tx", zap.String("txHash", txHashLower))
+	metrics.TxsReceived.WithLabelValues(cr.pipeline, event.Source).Inc()
 
-	outFiles, err := cr.store.GetCSVFile(event.Timestamp.Unix())
-	if err != nil {
-		logger.Error("Failed to get CSV file", zap.Error(err))
-		return
-	}
-
-	logger.Info("Store tx in CSV file",
-		zap.String("source", outFiles.FSourcelog.Name()),
-		zap.String("tx", outFiles.FTxs.Name()),
-	)
-
-	_, err = fmt.Fprintf(outFiles.FSourcelog, "%d,%s,%s\n", event.Timestamp.UnixMilli(), txHashLower, event.Source)
+	err := cr.sink.WriteSighting(&core.Sighting{
+		Timestamp: event.Timestamp,
+		Hash:      tx.Hash(),
+		Source:    event.Source,
+	})
 	if err != nil {
-		logger.Error("Failed to store fsourcelog data", zap.Error(err))
-		return
+		logger.Error("Failed to store sighting", zap.Error(err))
 	}
 
 	_, err = cr.store.GetTx(txHashLower)
 	if err == nil {
 		logger.Error("Transaction already processed")
+		metrics.DuplicatesSkipped.WithLabelValues(cr.pipeline).Inc()
 		return
 	}
 
-	if err := cr.validateTx(event); err != nil {
-		return
-	}
-
-	l1Client, err := client.FromNetwork(cr.ctx)
+	sender, err := cr.validateTx(event)
 	if err != nil {
+		metrics.ValidationFailures.WithLabelValues(cr.pipeline, validationReason(err)).Inc()
 		return
 	}
 
-	receipt, err := l1Client.TransactionReceipt(context.Background(), tx.Hash())
-	if err != nil {
-		if err.Error() != "not found" {
-			logger.Error("Failed to execute ethClient.TransactionReceipt", zap.Error(err))
+	switch {
+	case cr.batcher != nil:
+		cr.checkingLock.Lock()
+		_, pending := cr.checking[tx.Hash()]
+		cr.checking[tx.Hash()] = struct{}{}
+		cr.checkingLock.Unlock()
+
+		if pending {
+			metrics.DuplicatesSkipped.WithLabelValues(cr.pipeline).Inc()
+			return
 		}
+
+		cr.lookups.Add(1)
+		cr.batcher.Lookup(cr.jobCtx, tx.Hash(), func(receipt *types.Receipt, err error) {
+			defer cr.lookups.Done()
+			cr.storeTx(event, sender, receipt, err)
+
+			cr.checkingLock.Lock()
+			delete(cr.checking, tx.Hash())
+			cr.checkingLock.Unlock()
+		})
+
+	case cr.receipts != nil:
+		start := time.Now()
+		receipt, err := cr.receipts.TransactionReceipt(cr.jobCtx, tx.Hash())
+		metrics.ObserveRPC(receiptMethod, start)
+		cr.storeTx(event, sender, receipt, err)
+
+	default:
+		// replayed txs have no node to check against
+		cr.storeTx(event, sender, nil, nil)
 	}
+}
 
-	if receipt != nil {
-		logger.Info("Tx already included", zap.Uint64("block", receipt.BlockNumber.Uint64()))
-		return
+// storeTx ... Stores a validated tx unless its receipt shows it is already
+// included. A failed lookup is logged and the tx stored anyway
+func (cr *ChainReader) storeTx(event core.Event, sender common.Address, receipt *types.Receipt, err error) {
+	logger := logging.WithContext(cr.ctx)
+
+	tx := event.Value
+	txHashLower := strings.ToLower(tx.Hash().Hex())
+
+	if err != nil && !errors.Is(err, ethereum.NotFound) {
+		logger.Error("Failed to execute ethClient.TransactionReceipt", zap.Error(err))
 	}
 
-	rlpHex, err := utils.TxToRLPString(event.Value)
-	if err != nil {
-		logger.Error("Failed to encode rlp", zap.Error(err))
+	if receipt != nil {
+		logger.Info("Tx already included", zap.Uint64("block", receipt.BlockNumber.Uint64()))
+		metrics.AlreadyIncluded.WithLabelValues(cr.pipeline).Inc()
 		return
 	}
 
-	_, err = fmt.Fprintf(outFiles.FTxs, "%d,%s,%s\n", event.Timestamp.UnixMilli(), txHashLower, rlpHex)
-	if err != nil {
-		logger.Error("Failed to store tx in file", zap.Error(err))
+	err = cr.sink.WriteTx(&core.TxRecord{
+		Timestamp: event.Timestamp,
+		Source:    event.Source,
+		Sender:    sender,
+		Tx:        tx,
+	})
+	var partial *sink.PartialWriteError
+	if errors.As(err, &partial) {
+		// a later sighting must not retry the write, it would duplicate the
+		// tx in the sinks that stored it
+		logger.Error("Failed to store tx in some sinks", zap.Strings("sinks", partial.Failed), zap.Error(err))
+	} else if err != nil {
+		logger.Error("Failed to store tx", zap.Error(err))
 		return
 	}
 
@@ -172,30 +441,82 @@ func (cr *ChainReader) processTx(event core.Event) {
 		logger.Error("Failed to store tx", zap.Error(err))
 		return
 	}
+
+	if replaced := cr.index.Add(tx, sender, event.Timestamp); replaced != nil {
+		cr.recordReplacement(event, sender, replaced)
+	}
+
+	if cr.tracker != nil {
+		cr.tracker.Watch(tx, sender, event.Timestamp)
+	}
+}
+
+func (cr *ChainReader) recordReplacement(event core.Event, sender common.Address, replaced *types.Transaction) {
+	logger := logging.WithContext(cr.ctx)
+
+	r := &core.Replacement{
+		Timestamp: event.Timestamp,
+		Kind:      classifyReplacement(sender, replaced, event.Value),
+		Sender:    sender,
+		Nonce:     event.Value.Nonce(),
+		Old:       replaced,
+		New:       event.Value,
+	}
+
+	logger.Debug("Detected tx replacement",
+		zap.String("kind", string(r.Kind)),
+		zap.String("old", replaced.Hash().Hex()),
+		zap.String("new", event.Value.Hash().Hex()))
+
+	if err := writeReplacement(cr.sink, r); err != nil {
+		logger.Error("Failed to store replacement", zap.Error(err))
+	}
+
+	if cr.tracker != nil {
+		cr.tracker.MarkReplaced(replaced.Hash())
+	}
 }
 
-func (cr *ChainReader) validateTx(event core.Event) error {
+// validateTx ... Runs stateless tx checks and returns the recovered sender
+func (cr *ChainReader) validateTx(event core.Event) (common.Address, error) {
 	tx := event.Value
 
-	if _, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx); err != nil {
-		return err
+	sender, err := types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx)
+	if err != nil {
+		return common.Address{}, err
 	}
 
 	if tx.Value().Sign() < 0 {
-		return txpool.ErrNegativeValue
+		return common.Address{}, txpool.ErrNegativeValue
 	}
 
 	if tx.GasFeeCap().BitLen() > 256 {
-		return ethcore.ErrFeeCapVeryHigh
+		return common.Address{}, ethcore.ErrFeeCapVeryHigh
 	}
 
 	if tx.GasTipCap().BitLen() > 256 {
-		return ethcore.ErrTipVeryHigh
+		return common.Address{}, ethcore.ErrTipVeryHigh
 	}
 
 	if tx.GasFeeCapIntCmp(tx.GasTipCap()) < 0 {
-		return ethcore.ErrTipAboveFeeCap
+		return common.Address{}, ethcore.ErrTipAboveFeeCap
 	}
 
-	return nil
+	return sender, nil
+}
+
+// validationReason ... Metric label of a validateTx error
+func validationReason(err error) string {
+	switch {
+	case errors.Is(err, txpool.ErrNegativeValue):
+		return "negative_value"
+	case errors.Is(err, ethcore.ErrFeeCapVeryHigh):
+		return "fee_cap_very_high"
+	case errors.Is(err, ethcore.ErrTipVeryHigh):
+		return "tip_very_high"
+	case errors.Is(err, ethcore.ErrTipAboveFeeCap):
+		return "tip_above_fee_cap"
+	default:
+		return "invalid_sender"
+	}
 }
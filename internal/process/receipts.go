@@ -0,0 +1,168 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/metrics"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	receiptMethod      = "eth_getTransactionReceipt"
+	receiptBatchMethod = "eth_getTransactionReceipt_batch"
+)
+
+var errBatcherStopped = errors.New("receipt batcher stopped")
+
+// ReceiptFetcher ... Looks up the receipt of a tx, ethereum.NotFound if not mined
+type ReceiptFetcher interface {
+	TransactionReceipt(ctx context.Context, txHash common.Hash) (*types.Receipt, error)
+}
+
+// BatchCaller ... JSON-RPC client able to send batch requests
+type BatchCaller interface {
+	BatchCallContext(ctx context.Context, b []rpc.BatchElem) error
+}
+
+// ReceiptCallback ... Receives the result of a batched receipt lookup
+type ReceiptCallback = func(receipt *types.Receipt, err error)
+
+type receiptRequest struct {
+	hash common.Hash
+	done ReceiptCallback
+}
+
+// ReceiptBatcher ... Collects receipt lookups over a short window and sends
+// them as a single JSON-RPC batch. Callers do not wait for the result, the
+// callbacks of a batch run in submission order once it returns, after the
+// callbacks of the previous batches
+type ReceiptBatcher struct {
+	client   BatchCaller
+	size     int
+	interval time.Duration
+
+	requests chan *receiptRequest
+	done     chan struct{}
+}
+
+func NewReceiptBatcher(client BatchCaller, size int, interval time.Duration) *ReceiptBatcher {
+	return &ReceiptBatcher{
+		client:   client,
+		size:     size,
+		interval: interval,
+		// unbuffered, a request is either taken by Run or refused once it stopped
+		requests: make(chan *receiptRequest),
+		done:     make(chan struct{}),
+	}
+}
+
+// Lookup ... Queues the receipt lookup on the next batch and returns right
+// away. done is called exactly once, with ethereum.NotFound if the tx is not
+// mined, or right away if the batcher stopped or ctx is done first
+func (b *ReceiptBatcher) Lookup(ctx context.Context, txHash common.Hash, done ReceiptCallback) {
+	select {
+	case b.requests <- &receiptRequest{hash: txHash, done: done}:
+	case <-b.done:
+		done(nil, errBatcherStopped)
+	case <-ctx.Done():
+		done(nil, ctx.Err())
+	}
+}
+
+// Run ... Flushes a batch once it is full or the flush interval elapsed
+// since its first request, until ctx is done
+func (b *ReceiptBatcher) Run(ctx context.Context) {
+	defer close(b.done)
+
+	batch := make([]*receiptRequest, 0, b.size)
+
+	timer := time.NewTimer(b.interval)
+	timer.Stop()
+
+	// prev is closed once the callbacks of the last flushed batch ran
+	prev := make(chan struct{})
+	close(prev)
+
+	flush := func() {
+		timer.Stop()
+		delivered := make(chan struct{})
+		go b.flush(ctx, batch, prev, delivered)
+		batch, prev = make([]*receiptRequest, 0, b.size), delivered
+	}
+
+	for {
+		select {
+		case req := <-b.requests:
+			if len(batch) == 0 {
+				timer.Reset(b.interval)
+			}
+
+			batch = append(batch, req)
+			if len(batch) >= b.size {
+				flush()
+			}
+
+		case <-timer.C:
+			if len(batch) > 0 {
+				flush()
+			}
+
+		case <-ctx.Done():
+			timer.Stop()
+			<-prev
+			for _, req := range batch {
+				req.done(nil, ctx.Err())
+			}
+			return
+		}
+	}
+}
+
+// flush ... Sends the batch and runs its callbacks once prev is closed, then
+// closes delivered
+func (b *ReceiptBatcher) flush(ctx context.Context, batch []*receiptRequest, prev <-chan struct{},
+	delivered chan<- struct{}) {
+	defer close(delivered)
+
+	elems := make([]rpc.BatchElem, len(batch))
+	receipts := make([]*types.Receipt, len(batch))
+
+	for i, req := range batch {
+		elems[i] = rpc.BatchElem{
+			Method: receiptMethod,
+			Args:   []interface{}{req.hash},
+			Result: &receipts[i],
+		}
+	}
+
+	start := time.Now()
+	err := b.client.BatchCallContext(ctx, elems)
+	metrics.ObserveRPC(receiptBatchMethod, start)
+
+	<-prev
+
+	if err != nil {
+		for _, req := range batch {
+			req.done(nil, err)
+		}
+		return
+	}
+
+	for i, req := range batch {
+		switch {
+		case elems[i].Error != nil:
+			req.done(nil, elems[i].Error)
+
+		case receipts[i] == nil:
+			req.done(nil, ethereum.NotFound)
+
+		default:
+			req.done(receipts[i], nil)
+		}
+	}
+}
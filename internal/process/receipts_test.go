@@ -0,0 +1,162 @@
+package process
+
+import (
+	"context"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeBatchCaller ... Answers every lookup of a tx in mined
+type fakeBatchCaller struct {
+	mined map[common.Hash]bool
+
+	lock    sync.Mutex
+	batches [][]common.Hash
+}
+
+func (f *fakeBatchCaller) BatchCallContext(_ context.Context, elems []rpc.BatchElem) error {
+	hashes := make([]common.Hash, 0, len(elems))
+	for _, elem := range elems {
+		hash := elem.Args[0].(common.Hash)
+		hashes = append(hashes, hash)
+		if f.mined[hash] {
+			*elem.Result.(**types.Receipt) = &types.Receipt{TxHash: hash, BlockNumber: big.NewInt(1)}
+		}
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.batches = append(f.batches, hashes)
+	return nil
+}
+
+func TestReceiptBatcher(t *testing.T) {
+	tests := []struct {
+		name     string
+		size     int
+		interval time.Duration
+		lookups  int
+	}{
+		{name: "a full batch is sent right away", size: 32, interval: time.Hour, lookups: 32},
+		{name: "a partial batch is sent after the interval", size: 32, interval: 100 * time.Millisecond, lookups: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caller := &fakeBatchCaller{mined: make(map[common.Hash]bool)}
+			hashes := make([]common.Hash, tt.lookups)
+			for i := range hashes {
+				hashes[i] = common.BigToHash(big.NewInt(int64(i + 1)))
+				caller.mined[hashes[i]] = i%2 == 0
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			b := NewReceiptBatcher(caller, tt.size, tt.interval)
+			go b.Run(ctx)
+
+			var (
+				done sync.WaitGroup
+				lock sync.Mutex
+				got  = make(map[common.Hash]*types.Receipt)
+				errs = make(map[common.Hash]error)
+			)
+			done.Add(tt.lookups)
+
+			// lookups return before their batch is sent
+			for _, hash := range hashes {
+				go b.Lookup(ctx, hash, func(receipt *types.Receipt, err error) {
+					defer done.Done()
+					lock.Lock()
+					defer lock.Unlock()
+					got[hash], errs[hash] = receipt, err
+				})
+			}
+			done.Wait()
+
+			require.Len(t, caller.batches, 1)
+			require.ElementsMatch(t, hashes, caller.batches[0])
+
+			for i, hash := range hashes {
+				if i%2 == 0 {
+					require.NoError(t, errs[hash])
+					require.Equal(t, hash, got[hash].TxHash)
+				} else {
+					require.ErrorIs(t, errs[hash], ethereum.NotFound)
+					require.Nil(t, got[hash])
+				}
+			}
+		})
+	}
+}
+
+func TestReceiptBatcherStopped(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := NewReceiptBatcher(&fakeBatchCaller{}, 8, time.Hour)
+
+	stopped := make(chan struct{})
+	go func() {
+		b.Run(ctx)
+		close(stopped)
+	}()
+
+	// a queued lookup is answered when the batcher stops
+	queued := make(chan error, 1)
+	b.Lookup(context.Background(), common.Hash{1}, func(_ *types.Receipt, err error) { queued <- err })
+	cancel()
+	require.ErrorIs(t, <-queued, context.Canceled)
+	<-stopped
+
+	late := make(chan error, 1)
+	b.Lookup(context.Background(), common.Hash{2}, func(_ *types.Receipt, err error) { late <- err })
+	require.ErrorIs(t, <-late, errBatcherStopped)
+}
+
+func TestReaderBatchedReceiptCheck(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	require.NoError(t, err)
+	pending, mined := signedTx(t, key, 1), signedTx(t, key, 2)
+
+	caller := &fakeBatchCaller{mined: map[common.Hash]bool{mined.Hash(): true}}
+	out := &failingSink{name: "test"}
+	store := state.NewFileStore(t.TempDir())
+	t.Cleanup(func() { _ = store.Close() })
+
+	cfg := &config.Config{ClientConfig: &core.ClientConfig{}, SystemConfig: &config.SystemConfig{Workers: 1}}
+	batcher := NewReceiptBatcher(caller, 8, 10*time.Millisecond)
+	cr := NewReplayReader(context.Background(), cfg, store, out, WithReceiptBatcher(batcher))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go batcher.Run(ctx)
+
+	now := time.Now()
+	cr.processTx(core.Event{Timestamp: now, Value: pending, Source: "a"})
+	// a second sighting while the first one waits for its receipt is skipped
+	cr.processTx(core.Event{Timestamp: now, Value: pending, Source: "b"})
+	cr.processTx(core.Event{Timestamp: now, Value: mined, Source: "a"})
+	cr.lookups.Wait()
+
+	require.Len(t, caller.batches, 1)
+	require.Len(t, caller.batches[0], 2)
+	require.Equal(t, 1, out.txs)
+
+	_, err = store.GetTx(strings.ToLower(pending.Hash().Hex()))
+	require.NoError(t, err)
+	_, err = store.GetTx(strings.ToLower(mined.Hash().Hex()))
+	require.Error(t, err)
+}
@@ -0,0 +1,88 @@
+package process
+
+import (
+	"sync"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/sink"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+// classifyReplacement ... Cancels are zero value transfers back to the sender.
+// Other replacements are fee bumps when they raise the tip or the fee cap
+// without lowering the other one, legacy txs compare their gas price
+func classifyReplacement(sender common.Address, replaced, replacement *types.Transaction) core.ReplacementKind {
+	to := replacement.To()
+	if to != nil && *to == sender && replacement.Value().Sign() == 0 {
+		return core.Cancel
+	}
+
+	tip := replacement.GasTipCapCmp(replaced)
+	feeCap := replacement.GasFeeCapCmp(replaced)
+	if tip >= 0 && feeCap >= 0 && (tip > 0 || feeCap > 0) {
+		return core.FeeBump
+	}
+	return core.Underpriced
+}
+
+// writeReplacement ... Stores the replacement in every sink supporting it
+func writeReplacement(s sink.Sink, r *core.Replacement) error {
+	if w, ok := s.(sink.ReplacementWriter); ok {
+		return w.WriteReplacement(r)
+	}
+	return nil
+}
+
+type nonceKey struct {
+	sender common.Address
+	nonce  uint64
+}
+
+type pendingTx struct {
+	tx   *types.Transaction
+	seen time.Time
+}
+
+// NonceIndex ... Latest pending tx per (sender, nonce)
+type NonceIndex struct {
+	ttl time.Duration
+
+	entries map[nonceKey]*pendingTx
+	lock    sync.Mutex
+}
+
+func NewNonceIndex(ttl time.Duration) *NonceIndex {
+	return &NonceIndex{
+		ttl:     ttl,
+		entries: make(map[nonceKey]*pendingTx),
+	}
+}
+
+// Add ... Indexes the tx and returns the pending tx it replaces, if any
+func (ni *NonceIndex) Add(tx *types.Transaction, sender common.Address, seen time.Time) *types.Transaction {
+	ni.lock.Lock()
+	defer ni.lock.Unlock()
+
+	key := nonceKey{sender: sender, nonce: tx.Nonce()}
+	prev, exists := ni.entries[key]
+	ni.entries[key] = &pendingTx{tx: tx, seen: seen}
+
+	if !exists || prev.tx.Hash() == tx.Hash() {
+		return nil
+	}
+	return prev.tx
+}
+
+// Evict ... Forgets pending txs older than the ttl
+func (ni *NonceIndex) Evict(now time.Time) {
+	ni.lock.Lock()
+	defer ni.lock.Unlock()
+
+	for key, entry := range ni.entries {
+		if now.Sub(entry.seen) > ni.ttl {
+			delete(ni.entries, key)
+		}
+	}
+}
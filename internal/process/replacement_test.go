@@ -0,0 +1,134 @@
+package process
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	testSender    = common.HexToAddress("0x1000000000000000000000000000000000000001")
+	testRecipient = common.HexToAddress("0x2000000000000000000000000000000000000002")
+)
+
+func dynamicTx(nonce uint64, tip, feeCap int64, to common.Address, value int64) *types.Transaction {
+	return types.NewTx(&types.DynamicFeeTx{
+		Nonce:     nonce,
+		GasTipCap: big.NewInt(tip),
+		GasFeeCap: big.NewInt(feeCap),
+		Gas:       21000,
+		To:        &to,
+		Value:     big.NewInt(value),
+	})
+}
+
+func legacyTx(nonce uint64, gasPrice int64, to common.Address, value int64) *types.Transaction {
+	return types.NewTx(&types.LegacyTx{
+		Nonce:    nonce,
+		GasPrice: big.NewInt(gasPrice),
+		Gas:      21000,
+		To:       &to,
+		Value:    big.NewInt(value),
+	})
+}
+
+func TestClassifyReplacement(t *testing.T) {
+	tests := []struct {
+		name        string
+		replaced    *types.Transaction
+		replacement *types.Transaction
+		want        core.ReplacementKind
+	}{
+		{
+			name:        "zero value self transfer is a cancel",
+			replaced:    dynamicTx(1, 2, 10, testRecipient, 5),
+			replacement: dynamicTx(1, 3, 11, testSender, 0),
+			want:        core.Cancel,
+		},
+		{
+			name:        "self transfer with value is not a cancel",
+			replaced:    dynamicTx(1, 2, 10, testRecipient, 5),
+			replacement: dynamicTx(1, 3, 11, testSender, 1),
+			want:        core.FeeBump,
+		},
+		{
+			name:        "higher tip and fee cap",
+			replaced:    dynamicTx(1, 2, 10, testRecipient, 5),
+			replacement: dynamicTx(1, 3, 11, testRecipient, 5),
+			want:        core.FeeBump,
+		},
+		{
+			name:        "higher fee cap only",
+			replaced:    dynamicTx(1, 2, 10, testRecipient, 5),
+			replacement: dynamicTx(1, 2, 11, testRecipient, 5),
+			want:        core.FeeBump,
+		},
+		{
+			name:        "same fees",
+			replaced:    dynamicTx(1, 2, 10, testRecipient, 5),
+			replacement: dynamicTx(1, 2, 10, testRecipient, 6),
+			want:        core.Underpriced,
+		},
+		{
+			name:        "higher tip but lower fee cap",
+			replaced:    dynamicTx(1, 2, 10, testRecipient, 5),
+			replacement: dynamicTx(1, 3, 9, testRecipient, 5),
+			want:        core.Underpriced,
+		},
+		{
+			name:        "legacy gas price bump",
+			replaced:    legacyTx(1, 10, testRecipient, 5),
+			replacement: legacyTx(1, 12, testRecipient, 5),
+			want:        core.FeeBump,
+		},
+		{
+			name:        "legacy lower gas price",
+			replaced:    legacyTx(1, 10, testRecipient, 5),
+			replacement: legacyTx(1, 8, testRecipient, 5),
+			want:        core.Underpriced,
+		},
+		{
+			name:        "legacy replaced by a dynamic fee tx",
+			replaced:    legacyTx(1, 10, testRecipient, 5),
+			replacement: dynamicTx(1, 10, 20, testRecipient, 5),
+			want:        core.FeeBump,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, classifyReplacement(testSender, tt.replaced, tt.replacement))
+		})
+	}
+}
+
+func TestNonceIndex(t *testing.T) {
+	seen := time.Unix(1_700_000_000, 0)
+	ni := NewNonceIndex(time.Minute)
+
+	first := dynamicTx(1, 2, 10, testRecipient, 5)
+	require.Nil(t, ni.Add(first, testSender, seen))
+
+	// the same tx seen again by another source is not a replacement
+	require.Nil(t, ni.Add(first, testSender, seen.Add(time.Second)))
+
+	// other nonces and senders are tracked separately
+	require.Nil(t, ni.Add(dynamicTx(2, 2, 10, testRecipient, 5), testSender, seen))
+	require.Nil(t, ni.Add(first, testRecipient, seen))
+
+	bump := dynamicTx(1, 3, 11, testRecipient, 5)
+	require.Equal(t, first.Hash(), ni.Add(bump, testSender, seen.Add(2*time.Second)).Hash())
+
+	// the latest tx of the nonce is the one replaced next
+	cancel := dynamicTx(1, 4, 12, testSender, 0)
+	require.Equal(t, bump.Hash(), ni.Add(cancel, testSender, seen.Add(3*time.Second)).Hash())
+
+	// expired entries are forgotten, a later tx of the nonce replaces nothing
+	ni.Evict(seen.Add(3*time.Second + time.Minute + 1))
+	require.Nil(t, ni.Add(bump, testSender, seen.Add(2*time.Minute)))
+}
@@ -0,0 +1,83 @@
+package process
+
+import (
+	"context"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/metrics"
+	"github.com/denzelpenzel/magic-chain/internal/utils"
+	"go.uber.org/zap"
+)
+
+// subscribeFunc ... Subscribes and consumes until the subscription fails or
+// ctx is done, calling connected once the subscription is established.
+// Returns nil only when ctx is done
+type subscribeFunc = func(ctx context.Context, connected func()) error
+
+// redialFunc ... Replaces the node connection before the next attempt
+type redialFunc = func(ctx context.Context) error
+
+// resubscribe ... Keeps a subscription running until ctx is done. A failed
+// subscription is retried with capped exponential backoff until the retry
+// budget is spent, redialing the node first unless redial is nil
+func resubscribe(ctx context.Context, logger *zap.Logger, pipeline, source, topic string, retries int,
+	subscribe subscribeFunc, redial redialFunc) {
+	var lostAt time.Time
+	attempt := 0
+
+	connected := func() {
+		if !lostAt.IsZero() {
+			logger.Info("Resubscribed to "+topic,
+				zap.Int("attempts", attempt),
+				zap.Duration("gap", time.Since(lostAt)))
+			metrics.SubscriptionReconnects.WithLabelValues(pipeline, source).Inc()
+		}
+		lostAt, attempt = time.Time{}, 0
+	}
+
+	for {
+		err := subscribe(ctx, connected)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+
+		logger.Error("Subscription to "+topic+" failed", zap.Error(err))
+
+		if lostAt.IsZero() {
+			lostAt = time.Now()
+		}
+
+		for {
+			attempt++
+			if attempt > retries {
+				logger.Error("Giving up on "+topic+" subscription",
+					zap.Int("attempts", attempt-1),
+					zap.Duration("gap", time.Since(lostAt)))
+				return
+			}
+
+			delay := utils.Backoff(attempt, core.MinBackoffMs*time.Millisecond, core.MaxBackoffSec*time.Second)
+			logger.Warn("Reconnecting to node",
+				zap.Int("attempt", attempt),
+				zap.Int("max_attempts", retries),
+				zap.Duration("delay", delay))
+
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return
+			}
+
+			if redial == nil {
+				break
+			}
+
+			if err := redial(ctx); err != nil {
+				logger.Error("Failed to redial node", zap.Error(err))
+				continue
+			}
+			break
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package process
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestResubscribe(t *testing.T) {
+	errLost := errors.New("connection lost")
+
+	t.Run("redials after a failed subscription", func(t *testing.T) {
+		calls, redials, connects := 0, 0, 0
+
+		subscribe := func(_ context.Context, connected func()) error {
+			calls++
+			if calls == 1 {
+				return errLost
+			}
+			connected()
+			connects++
+			return nil
+		}
+		redial := func(context.Context) error {
+			redials++
+			return nil
+		}
+
+		resubscribe(context.Background(), zap.NewNop(), "test", "test", "tests", 1, subscribe, redial)
+		require.Equal(t, 2, calls)
+		require.Equal(t, 1, redials)
+		require.Equal(t, 1, connects)
+	})
+
+	t.Run("gives up once the retry budget is spent", func(t *testing.T) {
+		calls := 0
+		subscribe := func(context.Context, func()) error {
+			calls++
+			return errLost
+		}
+
+		resubscribe(context.Background(), zap.NewNop(), "test", "test", "tests", 0, subscribe, nil)
+		require.Equal(t, 1, calls)
+	})
+
+	t.Run("stops when ctx is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		calls := 0
+		subscribe := func(context.Context, func()) error {
+			calls++
+			return errLost
+		}
+
+		resubscribe(ctx, zap.NewNop(), "test", "test", "tests", 5, subscribe, nil)
+		require.Equal(t, 1, calls)
+	})
+}
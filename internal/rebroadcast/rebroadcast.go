@@ -0,0 +1,341 @@
+package rebroadcast
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"github.com/denzelpenzel/magic-chain/internal/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethcore "github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/txpool"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/rpc"
+)
+
+const (
+	sendMethod = "eth_sendRawTransaction"
+)
+
+// Result ... Outcome of a single submission
+type Result string
+
+const (
+	Accepted               Result = "accepted"
+	AlreadyKnown           Result = "already_known"
+	NonceTooLow            Result = "nonce_too_low"
+	NonceTooHigh           Result = "nonce_too_high"
+	ReplacementUnderpriced Result = "replacement_underpriced"
+	Underpriced            Result = "underpriced"
+	FeeCapTooLow           Result = "fee_cap_too_low"
+	InsufficientFunds      Result = "insufficient_funds"
+	GasLimit               Result = "gas_limit"
+	IntrinsicGas           Result = "intrinsic_gas"
+	InvalidSender          Result = "invalid_sender"
+	Rejected               Result = "rejected"
+	// Failed is a transport error, the node may not have seen the tx
+	Failed Result = "failed"
+)
+
+// rejections ... Node errors matched by message, the json-rpc layer only
+// forwards the error text. Longer messages come first where they overlap
+var rejections = []struct {
+	err    error
+	result Result
+}{
+	{txpool.ErrAlreadyKnown, AlreadyKnown},
+	{ethcore.ErrNonceTooLow, NonceTooLow},
+	{ethcore.ErrNonceTooHigh, NonceTooHigh},
+	{txpool.ErrReplaceUnderpriced, ReplacementUnderpriced},
+	{txpool.ErrUnderpriced, Underpriced},
+	{ethcore.ErrFeeCapTooLow, FeeCapTooLow},
+	{errors.New("insufficient funds"), InsufficientFunds},
+	{txpool.ErrGasLimit, GasLimit},
+	{ethcore.ErrIntrinsicGas, IntrinsicGas},
+	{txpool.ErrInvalidSender, InvalidSender},
+}
+
+// ReportColumns ... Header row of the report file
+var ReportColumns = []string{"sent_at", "hash", "sender", "nonce", "first_seen", "result", "error"}
+
+// Caller ... JSON-RPC access to the target node, satisfied by *rpc.Client
+type Caller interface {
+	CallContext(ctx context.Context, result interface{}, method string, args ...interface{}) error
+}
+
+// Filter ... Selects the recorded txs to submit, empty fields match every tx
+type Filter struct {
+	Senders map[common.Address]struct{}
+	Hashes  map[common.Hash]struct{}
+}
+
+func (f *Filter) match(hash common.Hash, sender common.Address) bool {
+	if len(f.Hashes) > 0 {
+		if _, ok := f.Hashes[hash]; !ok {
+			return false
+		}
+	}
+
+	if len(f.Senders) > 0 {
+		if _, ok := f.Senders[sender]; !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Summary ... Number of submissions per result
+type Summary struct {
+	Results map[Result]int
+	// Skipped counts the rows whose rlp or sender could not be decoded
+	Skipped int
+}
+
+// Rebroadcaster ... Submits recorded txs to a node in the order they were
+// first seen, the txs of a sender by nonce, and writes the outcome of every
+// submission to a report
+type Rebroadcaster struct {
+	caller Caller
+	// interval between two submissions, zero submits as fast as the node answers
+	interval time.Duration
+	report   *csv.Writer
+}
+
+// New ... rate is the number of txs submitted per second, zero disables the limit
+func New(caller Caller, rate float64, report io.Writer) *Rebroadcaster {
+	var interval time.Duration
+	if rate > 0 {
+		interval = time.Duration(float64(time.Second) / rate)
+	}
+
+	return &Rebroadcaster{
+		caller:   caller,
+		interval: interval,
+		report:   csv.NewWriter(report),
+	}
+}
+
+type recordedTx struct {
+	firstSeen time.Time
+	sender    common.Address
+	tx        *types.Transaction
+}
+
+// Run ... Submits the matching txs recorded under dataDir within [from, to]
+func (r *Rebroadcaster) Run(ctx context.Context, dataDir string, from, to time.Time, f *Filter) (*Summary, error) {
+	files, err := state.BucketFiles(dataDir, state.TxsPrefix, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &Summary{Results: make(map[Result]int)}
+
+	if err := r.report.Write(ReportColumns); err != nil {
+		return summary, err
+	}
+	defer r.report.Flush()
+
+	txs, skipped, err := readBuckets(files, from, to, f)
+	if err != nil {
+		return summary, err
+	}
+	summary.Skipped = skipped
+
+	var next time.Time
+	for _, rt := range txs {
+		if err := wait(ctx, next); err != nil {
+			return summary, err
+		}
+		next = time.Now().Add(r.interval)
+
+		res, sendErr := r.send(ctx, rt.tx)
+		summary.Results[res]++
+
+		if err := r.write(rt, res, sendErr); err != nil {
+			return summary, err
+		}
+	}
+
+	r.report.Flush()
+	return summary, r.report.Error()
+}
+
+func (r *Rebroadcaster) send(ctx context.Context, tx *types.Transaction) (Result, error) {
+	rlpHex, err := utils.TxToRLPString(tx)
+	if err != nil {
+		return Failed, err
+	}
+
+	var hash common.Hash
+	err = r.caller.CallContext(ctx, &hash, sendMethod, rlpHex)
+	return classify(err), err
+}
+
+func (r *Rebroadcaster) write(rt *recordedTx, res Result, sendErr error) error {
+	msg := ""
+	if sendErr != nil {
+		msg = sendErr.Error()
+	}
+
+	return r.report.Write([]string{
+		strconv.FormatInt(time.Now().UTC().UnixMilli(), 10),
+		strings.ToLower(rt.tx.Hash().Hex()),
+		strings.ToLower(rt.sender.Hex()),
+		strconv.FormatUint(rt.tx.Nonce(), 10),
+		strconv.FormatInt(rt.firstSeen.UnixMilli(), 10),
+		string(res),
+		msg,
+	})
+}
+
+// classify ... Maps the node answer to a result
+func classify(err error) Result {
+	if err == nil {
+		return Accepted
+	}
+
+	var rpcErr rpc.Error
+	if !errors.As(err, &rpcErr) {
+		return Failed
+	}
+
+	msg := strings.ToLower(rpcErr.Error())
+	for _, rej := range rejections {
+		if strings.Contains(msg, rej.err.Error()) {
+			return rej.result
+		}
+	}
+	return Rejected
+}
+
+// readBuckets ... Decodes the matching txs of all bucket files ordered by
+// first sighting, see order. The window is ordered as a whole, the nonces of
+// a sender may be spread over several buckets
+func readBuckets(paths []string, from, to time.Time, f *Filter) ([]*recordedTx, int, error) {
+	var (
+		all     []*recordedTx
+		skipped int
+	)
+
+	for _, path := range paths {
+		txs, n, err := readBucket(path, from, to, f)
+		if err != nil {
+			return nil, 0, err
+		}
+		all = append(all, txs...)
+		skipped += n
+	}
+
+	order(all)
+
+	// restarts without a persisted dedup index may record a tx twice, the
+	// first sighting is kept
+	seen := make(map[common.Hash]struct{}, len(all))
+	txs := all[:0]
+	for _, rt := range all {
+		if _, ok := seen[rt.tx.Hash()]; ok {
+			continue
+		}
+		seen[rt.tx.Hash()] = struct{}{}
+		txs = append(txs, rt)
+	}
+
+	return txs, skipped, nil
+}
+
+// readBucket ... Decodes the matching txs of a bucket file in file order
+func readBucket(path string, from, to time.Time, f *Filter) ([]*recordedTx, int, error) {
+	var txs []*recordedTx
+	skipped := 0
+
+	err := state.WalkFile(path, from, to, func(ts time.Time, cols []string) error {
+		if len(cols) <= state.TxsRLPCol {
+			skipped++
+			return nil
+		}
+
+		raw, err := hexutil.Decode(cols[state.TxsRLPCol])
+		if err != nil {
+			skipped++
+			return nil
+		}
+
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(raw); err != nil {
+			skipped++
+			return nil
+		}
+
+		var sender common.Address
+		if len(cols) > state.TxsSenderCol && common.IsHexAddress(cols[state.TxsSenderCol]) {
+			sender = common.HexToAddress(cols[state.TxsSenderCol])
+		} else if sender, err = types.Sender(types.LatestSignerForChainID(tx.ChainId()), tx); err != nil {
+			skipped++
+			return nil
+		}
+
+		if f.match(tx.Hash(), sender) {
+			txs = append(txs, &recordedTx{firstSeen: ts, sender: sender, tx: tx})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return txs, skipped, nil
+}
+
+// order ... Sorts the txs by first sighting across senders. The nonces of a
+// sender have to reach the node in order, whatever order they were seen in,
+// so the txs of a sender are sorted by nonce within the slots they occupy
+func order(txs []*recordedTx) {
+	sort.SliceStable(txs, func(i, j int) bool { return txs[i].firstSeen.Before(txs[j].firstSeen) })
+
+	slots := make(map[common.Address][]int)
+	for i, rt := range txs {
+		slots[rt.sender] = append(slots[rt.sender], i)
+	}
+
+	for _, idx := range slots {
+		if len(idx) < 2 {
+			continue
+		}
+
+		senderTxs := make([]*recordedTx, len(idx))
+		for i, pos := range idx {
+			senderTxs[i] = txs[pos]
+		}
+		// stable, replacements of a nonce keep their first seen order
+		sort.SliceStable(senderTxs, func(i, j int) bool { return senderTxs[i].tx.Nonce() < senderTxs[j].tx.Nonce() })
+
+		for i, pos := range idx {
+			txs[pos] = senderTxs[i]
+		}
+	}
+}
+
+func wait(ctx context.Context, until time.Time) error {
+	d := time.Until(until)
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
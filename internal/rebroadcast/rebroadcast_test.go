@@ -0,0 +1,127 @@
+package rebroadcast
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	ethcore "github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/txpool"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+// rpcError ... Error answered by the node, as forwarded by the json-rpc client
+type rpcError struct {
+	msg string
+}
+
+func (e *rpcError) Error() string  { return e.msg }
+func (e *rpcError) ErrorCode() int { return -32000 }
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		res  Result
+	}{
+		{name: "accepted", err: nil, res: Accepted},
+		{name: "transport", err: errors.New("connection refused"), res: Failed},
+		{name: "already known", err: &rpcError{txpool.ErrAlreadyKnown.Error()}, res: AlreadyKnown},
+		{
+			name: "nonce too low",
+			err:  &rpcError{fmt.Sprintf("%s: address 0x01, tx: 1 state: 2", ethcore.ErrNonceTooLow)},
+			res:  NonceTooLow,
+		},
+		{name: "nonce too high", err: &rpcError{ethcore.ErrNonceTooHigh.Error()}, res: NonceTooHigh},
+		{
+			name: "replacement underpriced",
+			err:  &rpcError{txpool.ErrReplaceUnderpriced.Error()},
+			res:  ReplacementUnderpriced,
+		},
+		{name: "underpriced", err: &rpcError{txpool.ErrUnderpriced.Error()}, res: Underpriced},
+		{name: "fee cap too low", err: &rpcError{ethcore.ErrFeeCapTooLow.Error()}, res: FeeCapTooLow},
+		{
+			name: "insufficient funds",
+			err:  &rpcError{"insufficient funds for gas * price + value: balance 0"},
+			res:  InsufficientFunds,
+		},
+		{name: "gas limit", err: &rpcError{txpool.ErrGasLimit.Error()}, res: GasLimit},
+		{name: "intrinsic gas", err: &rpcError{ethcore.ErrIntrinsicGas.Error()}, res: IntrinsicGas},
+		{name: "invalid sender", err: &rpcError{txpool.ErrInvalidSender.Error()}, res: InvalidSender},
+		{name: "case insensitive", err: &rpcError{"Already Known"}, res: AlreadyKnown},
+		{name: "wrapped", err: fmt.Errorf("send: %w", &rpcError{"already known"}), res: AlreadyKnown},
+		{name: "unknown rejection", err: &rpcError{"tx type not supported"}, res: Rejected},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.res, classify(tt.err))
+		})
+	}
+}
+
+func TestOrder(t *testing.T) {
+	alice := common.HexToAddress("0x00000000000000000000000000000000000a11ce")
+	bob := common.HexToAddress("0x0000000000000000000000000000000000000b0b")
+	start := time.Unix(1700000000, 0)
+
+	recorded := func(sender common.Address, nonce uint64, seen int, tip int64) *recordedTx {
+		return &recordedTx{
+			firstSeen: start.Add(time.Duration(seen) * time.Second),
+			sender:    sender,
+			tx:        types.NewTx(&types.DynamicFeeTx{Nonce: nonce, GasTipCap: big.NewInt(tip)}),
+		}
+	}
+
+	aliceNonce1 := recorded(alice, 1, 0, 1)
+	bobNonce7 := recorded(bob, 7, 1, 1)
+	aliceNonce0 := recorded(alice, 0, 2, 1)
+	aliceBump1 := recorded(alice, 1, 3, 2)
+	bobNonce6 := recorded(bob, 6, 4, 1)
+	aliceNonce2 := recorded(alice, 2, 5, 1)
+
+	// shuffled, order sorts by first sighting first
+	txs := []*recordedTx{aliceNonce2, bobNonce6, aliceNonce0, aliceNonce1, aliceBump1, bobNonce7}
+	order(txs)
+
+	// the senders keep their slots, the nonces of a sender ascend in them and
+	// the fee bump follows the tx it replaces
+	require.Equal(t, []*recordedTx{aliceNonce0, bobNonce6, aliceNonce1, aliceBump1, bobNonce7, aliceNonce2}, txs)
+}
+
+func TestReadBucketsOrdersAcrossBuckets(t *testing.T) {
+	alice := common.HexToAddress("0x00000000000000000000000000000000000a11ce")
+	dir := t.TempDir()
+
+	row := func(ms int64, nonce uint64) (*types.Transaction, string) {
+		tx := types.NewTx(&types.DynamicFeeTx{Nonce: nonce, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(2)})
+		raw, err := tx.MarshalBinary()
+		require.NoError(t, err)
+		return tx, fmt.Sprintf("%d,%s,%s,%s\n", ms, tx.Hash().Hex(), hexutil.Encode(raw), alice.Hex())
+	}
+
+	// nonce 1 was seen first, its bucket ends before nonce 0 shows up
+	nonce1, row1 := row(1700000000000, 1)
+	nonce0, row0 := row(1700003600000, 0)
+
+	first := filepath.Join(dir, "txs_first.csv")
+	second := filepath.Join(dir, "txs_second.csv")
+	require.NoError(t, os.WriteFile(first, []byte(row1), 0o600))
+	// a tx recorded twice across restarts is sent once
+	require.NoError(t, os.WriteFile(second, []byte(row0+row1), 0o600))
+
+	txs, skipped, err := readBuckets([]string{first, second}, time.Unix(0, 0), time.Unix(1800000000, 0), &Filter{})
+	require.NoError(t, err)
+	require.Zero(t, skipped)
+
+	require.Len(t, txs, 2)
+	require.Equal(t, nonce0.Hash(), txs[0].tx.Hash())
+	require.Equal(t, nonce1.Hash(), txs[1].tx.Hash())
+}
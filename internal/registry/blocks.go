@@ -0,0 +1,67 @@
+package registry
+
+import (
+	"context"
+	"math/big"
+
+	"github.com/denzelpenzel/magic-chain/internal/client"
+	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/process"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	blockSourceName = "block"
+)
+
+// BlockTraversal ... Reads mined blocks from the L1 node
+type BlockTraversal struct {
+	l1Client *ethclient.Client
+}
+
+func NewBlockTraversal(ctx context.Context, cfg *config.Config) (process.Process, error) {
+	l1Client, err := client.FromNetwork(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// backfilled blocks carry historical timestamps, age buckets by them
+	store, err := newFileStore(cfg, state.WithEventTime())
+	if err != nil {
+		return nil, err
+	}
+
+	bt := &BlockTraversal{
+		l1Client: l1Client,
+	}
+
+	out, err := newSink(ctx, cfg, store)
+	if err != nil {
+		return nil, closeOnError(err, store, nil)
+	}
+
+	br, err := process.NewBlockReader(ctx, cfg, store, out, bt)
+	if err != nil {
+		return nil, closeOnError(err, store, out)
+	}
+
+	return br, nil
+}
+
+func (bt *BlockTraversal) Name() string {
+	return blockSourceName
+}
+
+func (bt *BlockTraversal) Height(ctx context.Context) (*big.Int, error) {
+	height, err := bt.l1Client.BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetUint64(height), nil
+}
+
+func (bt *BlockTraversal) Block(ctx context.Context, number *big.Int) (*types.Block, error) {
+	return bt.l1Client.BlockByNumber(ctx, number)
+}
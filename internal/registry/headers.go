@@ -0,0 +1,83 @@
+package registry
+
+import (
+	"context"
+
+	"github.com/denzelpenzel/magic-chain/internal/client"
+	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/process"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	headerSourceName = "headers"
+)
+
+// HeadTraversal ... Follows the block headers of the L1 node
+type HeadTraversal struct {
+	url      string
+	l1Client *ethclient.Client
+	// redialed is set once l1Client was dialed by Redial, the initial client
+	// belongs to the bundle and stays open
+	redialed bool
+}
+
+func NewHeaderFollower(ctx context.Context, cfg *config.Config) (process.Process, error) {
+	l1Client, err := client.FromNetwork(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := newFileStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ht := &HeadTraversal{
+		url:      cfg.ClientConfig.L1RpcEndpoint,
+		l1Client: l1Client,
+	}
+
+	out, err := newSink(ctx, cfg, store)
+	if err != nil {
+		return nil, closeOnError(err, store, nil)
+	}
+
+	hf, err := process.NewHeaderFollower(ctx, cfg, store, out, ht)
+	if err != nil {
+		return nil, closeOnError(err, store, out)
+	}
+
+	return hf, nil
+}
+
+func (ht *HeadTraversal) Name() string {
+	return headerSourceName
+}
+
+func (ht *HeadTraversal) SubscribeNewHead(ctx context.Context, ch chan<- *types.Header) (ethereum.Subscription, error) {
+	return ht.l1Client.SubscribeNewHead(ctx, ch)
+}
+
+func (ht *HeadTraversal) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
+	return ht.l1Client.HeaderByHash(ctx, hash)
+}
+
+// Redial ... Replaces the L1 client of the traversal with a fresh connection,
+// closing the client of the previous redial. The shared client of the bundle
+// is left untouched
+func (ht *HeadTraversal) Redial(ctx context.Context) error {
+	if ht.redialed {
+		ht.l1Client.Close()
+	}
+
+	l1Client, err := client.NewEthClient(ctx, ht.url)
+	if err != nil {
+		return err
+	}
+	ht.l1Client, ht.redialed = l1Client, true
+	return nil
+}
@@ -0,0 +1,79 @@
+package registry
+
+import (
+	"context"
+
+	"github.com/denzelpenzel/magic-chain/internal/client"
+	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/process"
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
+)
+
+const (
+	logSourceName = "logs"
+)
+
+// LogTraversal ... Subscribes to contract event logs on the L1 node
+type LogTraversal struct {
+	url      string
+	l1Client *ethclient.Client
+	// redialed is set once l1Client was dialed by Redial, the initial client
+	// belongs to the bundle and stays open
+	redialed bool
+}
+
+func NewLogTraversal(ctx context.Context, cfg *config.Config) (process.Process, error) {
+	l1Client, err := client.FromNetwork(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := newFileStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	lt := &LogTraversal{
+		url:      cfg.ClientConfig.L1RpcEndpoint,
+		l1Client: l1Client,
+	}
+
+	out, err := newSink(ctx, cfg, store)
+	if err != nil {
+		return nil, closeOnError(err, store, nil)
+	}
+
+	lr, err := process.NewLogReader(ctx, cfg, store, out, lt)
+	if err != nil {
+		return nil, closeOnError(err, store, out)
+	}
+
+	return lr, nil
+}
+
+func (lt *LogTraversal) Name() string {
+	return logSourceName
+}
+
+func (lt *LogTraversal) SubscribeLogs(ctx context.Context, q ethereum.FilterQuery,
+	ch chan<- types.Log) (ethereum.Subscription, error) {
+	return lt.l1Client.SubscribeFilterLogs(ctx, q, ch)
+}
+
+// Redial ... Replaces the L1 client of the traversal with a fresh connection,
+// closing the client of the previous redial. The shared client of the bundle
+// is left untouched
+func (lt *LogTraversal) Redial(ctx context.Context) error {
+	if lt.redialed {
+		lt.l1Client.Close()
+	}
+
+	l1Client, err := client.NewEthClient(ctx, lt.url)
+	if err != nil {
+		return err
+	}
+	lt.l1Client, lt.redialed = l1Client, true
+	return nil
+}
@@ -4,17 +4,25 @@ import (
 	"context"
 	"math/big"
 
+	"github.com/denzelpenzel/magic-chain/internal/chain"
 	"github.com/denzelpenzel/magic-chain/internal/client"
 	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/logging"
 	"github.com/denzelpenzel/magic-chain/internal/process"
-	"github.com/denzelpenzel/magic-chain/internal/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ethereum/go-ethereum/ethclient/gethclient"
 	"github.com/ethereum/go-ethereum/rpc"
 )
 
 type NodeTraversal struct {
+	name       string
+	url        string
 	nodeClient *gethclient.Client
+	// conn is the connection dialed by the last Redial, the initial node
+	// client belongs to the bundle and stays open
+	conn     *rpc.Client
+	l1Client *ethclient.Client
 }
 
 func NewHeaderTraversal(ctx context.Context, cfg *config.Config) (process.Process, error) {
@@ -23,22 +31,56 @@ func NewHeaderTraversal(ctx context.Context, cfg *config.Config) (process.Proces
 		return nil, err
 	}
 
-	nodeClient := clients.NodeClient()
-	store := state.NewFileStore(cfg.DataDir)
+	store, err := newFileStore(cfg)
+	if err != nil {
+		return nil, err
+	}
 
-	// remove old transactions in background
-	go store.Cleaner()
+	// one subscription per configured source, all feeding the same reader
+	routines := make([]process.Routine, 0, len(clients.Sources))
+	for _, src := range clients.Sources {
+		routines = append(routines, &NodeTraversal{
+			name:       src.Name,
+			url:        src.URL,
+			nodeClient: src.NodeClient,
+			l1Client:   clients.L1Client,
+		})
+	}
 
-	nt := &NodeTraversal{
-		nodeClient: nodeClient,
+	out, err := newSink(ctx, cfg, store)
+	if err != nil {
+		return nil, closeOnError(err, store, nil)
 	}
 
-	reader, err := process.NewReader(ctx, nt, store)
+	var opts []process.ReaderOption
+	if cfg.SystemConfig.TrackInclusions {
+		var trackerOpts []process.TrackerOption
+		if feed, err := chain.FeedFromContext(ctx); err == nil {
+			trackerOpts = append(trackerOpts, process.WithReorgFeed(feed))
+		}
+
+		tracker := process.NewInclusionTracker(ctx, cfg, clients.L1Client, out, trackerOpts...)
+		opts = append(opts, process.WithInclusionTracker(tracker))
+	} else {
+		logging.WithContext(ctx).Warn("Inclusion tracking is disabled, dropped txs are not recorded")
+	}
+
+	if cfg.SystemConfig.ReceiptBatchSize > 1 {
+		batcher := process.NewReceiptBatcher(clients.L1Client.Client(),
+			cfg.SystemConfig.ReceiptBatchSize, cfg.SystemConfig.ReceiptBatchInterval)
+		opts = append(opts, process.WithReceiptBatcher(batcher))
+	}
+
+	reader, err := process.NewReader(ctx, cfg, store, out, routines, opts...)
 	if err != nil {
-		return nil, err
+		return nil, closeOnError(err, store, out)
 	}
 
-	return reader, err
+	return reader, nil
+}
+
+func (ht *NodeTraversal) Name() string {
+	return ht.name
 }
 
 func (ht *NodeTraversal) Loop(ctx context.Context, consumer chan *types.Transaction) (*rpc.ClientSubscription, error) {
@@ -49,7 +91,26 @@ func (ht *NodeTraversal) Loop(ctx context.Context, consumer chan *types.Transact
 	return sub, nil
 }
 
-func (ht *NodeTraversal) Height() (*big.Int, error) {
-	// TODO implement me
-	panic("implement me")
+// Redial ... Replaces the node client with a fresh connection to the same
+// endpoint, closing the connection of the previous redial
+func (ht *NodeTraversal) Redial(ctx context.Context) error {
+	if ht.conn != nil {
+		ht.conn.Close()
+		ht.conn = nil
+	}
+
+	nodeClient, conn, err := client.NewNodeClient(ctx, ht.url)
+	if err != nil {
+		return err
+	}
+	ht.nodeClient, ht.conn = nodeClient, conn
+	return nil
+}
+
+func (ht *NodeTraversal) Height(ctx context.Context) (*big.Int, error) {
+	height, err := ht.l1Client.BlockNumber(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetUint64(height), nil
 }
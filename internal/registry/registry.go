@@ -1,13 +1,23 @@
 package registry
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"path/filepath"
 
+	"github.com/denzelpenzel/magic-chain/internal/config"
 	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/sink"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"github.com/denzelpenzel/magic-chain/internal/stream"
 )
 
 const (
-	noEntryErr = "could not find data topic type %v"
+	noEntryErr       = "could not find data topic type %v"
+	noConstructorErr = "no process is implemented for data topic type %v"
+
+	dedupDirname = "dedup"
 )
 
 type Registry struct {
@@ -16,20 +26,101 @@ type Registry struct {
 
 func New() *Registry {
 	topics := map[core.TopicType]*core.DataTopic{
+		core.PendingTx: {
+			DataType:    core.PendingTx,
+			ProcessType: core.Subscribe,
+			Constructor: NewHeaderTraversal,
+		},
 		core.BlockHeader: {
 			DataType:    core.BlockHeader,
 			ProcessType: core.Subscribe,
-			Constructor: NewHeaderTraversal,
+			Constructor: NewHeaderFollower,
+		},
+		core.Log: {
+			DataType:    core.Log,
+			ProcessType: core.Subscribe,
+			Constructor: NewLogTraversal,
+		},
+		core.Block: {
+			DataType:    core.Block,
+			ProcessType: core.Read,
+			Constructor: NewBlockTraversal,
 		},
-		core.Log: {},
 	}
 
 	return &Registry{topics}
 }
 
+// newFileStore ... Creates the file store of a process and starts its cleaner,
+// extra options are applied after the configured ones
+func newFileStore(cfg *config.Config, extra ...state.Option) (*state.FileStore, error) {
+	compression, err := state.ParseCompression(cfg.SystemConfig.BucketCompression)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := state.CheckBucketDuration(cfg.SystemConfig.BucketDuration); err != nil {
+		return nil, err
+	}
+
+	layout, err := state.ParseLayout(cfg.SystemConfig.BucketLayout, cfg.SystemConfig.Chain)
+	if err != nil {
+		return nil, err
+	}
+
+	opts := []state.Option{
+		state.WithCompression(compression),
+		state.WithBucketDuration(cfg.SystemConfig.BucketDuration),
+		state.WithLayout(layout),
+		state.WithSync(cfg.SystemConfig.SyncInterval, cfg.SystemConfig.SyncRows),
+	}
+
+	if cfg.SystemConfig.PersistDedup {
+		cache, err := state.NewPebbleCache(filepath.Join(cfg.DataDir, dedupDirname))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, state.WithTxCache(cache))
+	}
+
+	store := state.NewFileStore(cfg.DataDir, append(opts, extra...)...)
+
+	// remove old transactions in background
+	go store.Cleaner()
+
+	return store, nil
+}
+
+// newSink ... Builds the configured sinks of a process, feeding the app wide
+// tx index and live stream as well when the context carries them
+func newSink(ctx context.Context, cfg *config.Config, store *state.FileStore) (*sink.Multi, error) {
+	var extra []sink.Sink
+	if index, err := state.IndexFromContext(ctx); err == nil {
+		extra = append(extra, sink.NewIndex(index, cfg.SystemConfig.Pipeline))
+	}
+
+	if hub, err := stream.HubFromContext(ctx); err == nil {
+		extra = append(extra, sink.NewStream(hub))
+	}
+
+	return sink.New(ctx, cfg, store, extra...)
+}
+
+// closeOnError ... Releases the store of a process whose constructor failed,
+// stopping its cleaner and dedup index, and the sink when it got built
+func closeOnError(err error, store *state.FileStore, out *sink.Multi) error {
+	if out != nil {
+		err = errors.Join(err, out.Close())
+	}
+	return errors.Join(err, store.Close())
+}
+
 func (r *Registry) GetDataTopic(tt core.TopicType) (*core.DataTopic, error) {
 	if _, exists := r.topics[tt]; !exists {
 		return nil, fmt.Errorf(noEntryErr, tt)
 	}
+	if r.topics[tt].Constructor == nil {
+		return nil, fmt.Errorf(noConstructorErr, tt)
+	}
 	return r.topics[tt], nil
 }
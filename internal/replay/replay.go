@@ -0,0 +1,193 @@
+package replay
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	// SourceName ... Source of the replayed events
+	SourceName = "replay"
+
+	speedMax      = "max"
+	speedRealtime = "realtime"
+)
+
+// Speed ... Replay rate relative to the recorded traffic, zero replays as
+// fast as the target accepts the txs
+type Speed float64
+
+const (
+	AsFastAsPossible Speed = 0
+	RealTime         Speed = 1
+)
+
+// ParseSpeed ... Accepts max, realtime or a factor such as 10 or 10x
+func ParseSpeed(val string) (Speed, error) {
+	norm := strings.ToLower(strings.TrimSpace(val))
+	switch norm {
+	case speedMax:
+		return AsFastAsPossible, nil
+	case speedRealtime:
+		return RealTime, nil
+	}
+
+	f, err := strconv.ParseFloat(strings.TrimSuffix(norm, "x"), 64)
+	if err != nil || f <= 0 || math.IsInf(f, 0) || math.IsNaN(f) {
+		return 0, fmt.Errorf("invalid replay speed %s, expected max, realtime or a positive factor", val)
+	}
+	return Speed(f), nil
+}
+
+func (s Speed) String() string {
+	if s == AsFastAsPossible {
+		return speedMax
+	}
+	return strconv.FormatFloat(float64(s), 'f', -1, 64) + "x"
+}
+
+// Target ... Consumer of the replayed events, e.g. a replay chain reader
+type Target interface {
+	Push(ctx context.Context, event core.Event) error
+}
+
+// Stats ... Summary of a finished replay
+type Stats struct {
+	Txs int
+	// Skipped counts the rows whose rlp could not be decoded
+	Skipped int
+	First   time.Time
+	Last    time.Time
+	Elapsed time.Duration
+}
+
+// Replayer ... Feeds the recorded transactions buckets of a window to a
+// target in the order they were first seen, with their original timestamps
+type Replayer struct {
+	dataDir string
+	from    time.Time
+	to      time.Time
+	speed   Speed
+}
+
+func New(dataDir string, from, to time.Time, speed Speed) *Replayer {
+	return &Replayer{
+		dataDir: dataDir,
+		from:    from,
+		to:      to,
+		speed:   speed,
+	}
+}
+
+type row struct {
+	ts time.Time
+	tx *types.Transaction
+}
+
+// Run ... Replays the window bucket by bucket until it is exhausted or ctx is done
+func (r *Replayer) Run(ctx context.Context, t Target) (*Stats, error) {
+	files, err := state.BucketFiles(r.dataDir, state.TxsPrefix, r.from, r.to)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &Stats{}
+	start := time.Now()
+
+	for _, path := range files {
+		rows, skipped, err := r.readBucket(path)
+		if err != nil {
+			return stats, err
+		}
+		stats.Skipped += skipped
+
+		for _, rw := range rows {
+			if stats.First.IsZero() {
+				stats.First = rw.ts
+			}
+
+			if err := r.pace(ctx, start, stats.First, rw.ts); err != nil {
+				return stats, err
+			}
+
+			if err := t.Push(ctx, core.Event{Timestamp: rw.ts, Value: rw.tx, Source: SourceName}); err != nil {
+				return stats, err
+			}
+
+			stats.Txs++
+			stats.Last = rw.ts
+		}
+	}
+
+	stats.Elapsed = time.Since(start)
+	return stats, nil
+}
+
+// readBucket ... Decodes the txs of a bucket file ordered by first sighting
+func (r *Replayer) readBucket(path string) ([]row, int, error) {
+	var rows []row
+	skipped := 0
+
+	err := state.WalkFile(path, r.from, r.to, func(ts time.Time, cols []string) error {
+		if len(cols) <= state.TxsRLPCol {
+			skipped++
+			return nil
+		}
+
+		raw, err := hexutil.Decode(cols[state.TxsRLPCol])
+		if err != nil {
+			skipped++
+			return nil
+		}
+
+		tx := new(types.Transaction)
+		if err := tx.UnmarshalBinary(raw); err != nil {
+			skipped++
+			return nil
+		}
+
+		rows = append(rows, row{ts: ts, tx: tx})
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// concurrent workers append rows slightly out of order
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].ts.Before(rows[j].ts) })
+
+	return rows, skipped, nil
+}
+
+// pace ... Waits until ts is due relative to the first replayed tx
+func (r *Replayer) pace(ctx context.Context, start, first, ts time.Time) error {
+	if r.speed == AsFastAsPossible {
+		return ctx.Err()
+	}
+
+	due := start.Add(time.Duration(float64(ts.Sub(first)) / float64(r.speed)))
+	wait := time.Until(due)
+	if wait <= 0 {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
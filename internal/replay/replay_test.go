@@ -0,0 +1,50 @@
+package replay
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSpeed(t *testing.T) {
+	tests := []struct {
+		val   string
+		speed Speed
+	}{
+		{val: "max", speed: AsFastAsPossible},
+		{val: " MAX ", speed: AsFastAsPossible},
+		{val: "realtime", speed: RealTime},
+		{val: "Realtime", speed: RealTime},
+		{val: "10", speed: 10},
+		{val: "10x", speed: 10},
+		{val: " 2.5X ", speed: 2.5},
+		{val: "0.5x", speed: 0.5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.val, func(t *testing.T) {
+			speed, err := ParseSpeed(tt.val)
+			require.NoError(t, err)
+			require.Equal(t, tt.speed, speed)
+		})
+	}
+
+	for _, val := range []string{"", "x", "fast", "0", "0x", "-1x", "NaN", "inf", "10xx"} {
+		t.Run("invalid "+val, func(t *testing.T) {
+			_, err := ParseSpeed(val)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestSpeedString(t *testing.T) {
+	require.Equal(t, "max", AsFastAsPossible.String())
+	require.Equal(t, "1x", RealTime.String())
+	require.Equal(t, "2.5x", Speed(2.5).String())
+
+	for _, speed := range []Speed{AsFastAsPossible, RealTime, 2.5, 100} {
+		parsed, err := ParseSpeed(speed.String())
+		require.NoError(t, err)
+		require.Equal(t, speed, parsed)
+	}
+}
@@ -0,0 +1,206 @@
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/state"
+)
+
+const (
+	FormatTable = "table"
+	FormatJSON  = "json"
+
+	sourcelogHashCol   = 1
+	sourcelogSourceCol = 2
+
+	unknownSource = "unknown"
+)
+
+// SourceStats ... First-seen statistics for a single source
+type SourceStats struct {
+	Source string `json:"source"`
+	Seen   int    `json:"seen"`
+	Wins   int    `json:"wins"`
+	// Exclusive is the number of txs no other source delivered
+	Exclusive int `json:"exclusive"`
+
+	// Coverage is the share of all txs in the window seen by this source
+	Coverage float64 `json:"coverage_pct"`
+	// ExclusiveCoverage is the share of all txs in the window seen only by this source
+	ExclusiveCoverage float64 `json:"exclusive_coverage_pct"`
+	// WinRate is the share of this source's txs it saw first (ties count for every tied source)
+	WinRate float64 `json:"win_rate_pct"`
+
+	// Delay to the first sighting across all sources, in milliseconds
+	P50 int64 `json:"p50_ms"`
+	P90 int64 `json:"p90_ms"`
+	P99 int64 `json:"p99_ms"`
+}
+
+// LatencyReport ... First-seen latency comparison across sources
+type LatencyReport struct {
+	From     time.Time      `json:"from"`
+	To       time.Time      `json:"to"`
+	TotalTxs int            `json:"total_txs"`
+	Sources  []*SourceStats `json:"sources"`
+}
+
+// Latency ... Builds a latency report from the sourcelog buckets stored under dataDir
+func Latency(dataDir string, from, to time.Time) (*LatencyReport, error) {
+	// tx hash -> source -> first sighting
+	sightings := make(map[string]map[string]time.Time)
+
+	err := state.WalkRows(dataDir, state.SourcelogPrefix, from, to, func(ts time.Time, cols []string) error {
+		if len(cols) <= sourcelogHashCol {
+			return nil
+		}
+
+		hash := cols[sourcelogHashCol]
+		source := unknownSource
+		if len(cols) > sourcelogSourceCol && cols[sourcelogSourceCol] != "" {
+			source = cols[sourcelogSourceCol]
+		}
+
+		bySource, ok := sightings[hash]
+		if !ok {
+			bySource = make(map[string]time.Time)
+			sightings[hash] = bySource
+		}
+
+		if prev, seen := bySource[source]; !seen || ts.Before(prev) {
+			bySource[source] = ts
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return buildLatencyReport(from, to, sightings), nil
+}
+
+func buildLatencyReport(from, to time.Time, sightings map[string]map[string]time.Time) *LatencyReport {
+	stats := make(map[string]*SourceStats)
+	delays := make(map[string][]int64)
+
+	for _, bySource := range sightings {
+		var first time.Time
+		for _, ts := range bySource {
+			if first.IsZero() || ts.Before(first) {
+				first = ts
+			}
+		}
+
+		for source, ts := range bySource {
+			s, ok := stats[source]
+			if !ok {
+				s = &SourceStats{Source: source}
+				stats[source] = s
+			}
+
+			s.Seen++
+			if ts.Equal(first) {
+				s.Wins++
+			}
+			if len(bySource) == 1 {
+				s.Exclusive++
+			}
+
+			delays[source] = append(delays[source], ts.Sub(first).Milliseconds())
+		}
+	}
+
+	report := &LatencyReport{
+		From:     from,
+		To:       to,
+		TotalTxs: len(sightings),
+		Sources:  make([]*SourceStats, 0, len(stats)),
+	}
+
+	for source, s := range stats {
+		d := delays[source]
+		sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+
+		s.P50 = percentile(d, 50)
+		s.P90 = percentile(d, 90)
+		s.P99 = percentile(d, 99)
+
+		s.Coverage = pct(s.Seen, report.TotalTxs)
+		s.ExclusiveCoverage = pct(s.Exclusive, report.TotalTxs)
+		s.WinRate = pct(s.Wins, s.Seen)
+
+		report.Sources = append(report.Sources, s)
+	}
+
+	sort.Slice(report.Sources, func(i, j int) bool {
+		return report.Sources[i].Source < report.Sources[j].Source
+	})
+
+	return report
+}
+
+// Write ... Renders the report in the given format
+func (r *LatencyReport) Write(w io.Writer, format string) error {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(r)
+
+	case FormatTable:
+		return r.writeTable(w)
+
+	default:
+		return fmt.Errorf("unknown report format %s", format)
+	}
+}
+
+func (r *LatencyReport) writeTable(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "window %s - %s, %d txs\n\n",
+		r.From.Format(time.RFC3339), r.To.Format(time.RFC3339), r.TotalTxs)
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+
+	_, err = fmt.Fprintln(tw, "source\tseen\tcoverage %\texclusive %\twin rate %\tp50 ms\tp90 ms\tp99 ms\t")
+	if err != nil {
+		return err
+	}
+
+	for _, s := range r.Sources {
+		_, err = fmt.Fprintf(tw, "%s\t%d\t%.2f\t%.2f\t%.2f\t%d\t%d\t%d\t\n",
+			s.Source, s.Seen, s.Coverage, s.ExclusiveCoverage, s.WinRate, s.P50, s.P90, s.P99)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tw.Flush()
+}
+
+// percentile ... Nearest-rank percentile of an ascending sorted slice
+func percentile(sorted []int64, p int) int64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	rank := (p*len(sorted) + 99) / 100
+	if rank < 1 {
+		rank = 1
+	}
+	return sorted[rank-1]
+}
+
+func pct(n, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
@@ -0,0 +1,71 @@
+package report
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPercentile(t *testing.T) {
+	hundred := make([]int64, 100)
+	for i := range hundred {
+		hundred[i] = int64(i + 1)
+	}
+
+	tests := []struct {
+		name   string
+		sorted []int64
+		p      int
+		want   int64
+	}{
+		{name: "empty", sorted: nil, p: 50, want: 0},
+		{name: "single value", sorted: []int64{7}, p: 99, want: 7},
+		{name: "p0 is the minimum", sorted: []int64{1, 2, 3}, p: 0, want: 1},
+		{name: "p100 is the maximum", sorted: []int64{1, 2, 3}, p: 100, want: 3},
+		{name: "nearest rank rounds up", sorted: []int64{10, 20, 30, 40}, p: 50, want: 20},
+		{name: "nearest rank above half", sorted: []int64{10, 20, 30, 40, 50}, p: 50, want: 30},
+		{name: "p90 of 1..100", sorted: hundred, p: 90, want: 90},
+		{name: "p99 of 1..100", sorted: hundred, p: 99, want: 99},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, percentile(tt.sorted, tt.p))
+		})
+	}
+}
+
+func TestBuildLatencyReport(t *testing.T) {
+	base := time.UnixMilli(1_700_000_000_000).UTC()
+	at := func(ms int) time.Time { return base.Add(time.Duration(ms) * time.Millisecond) }
+
+	sightings := map[string]map[string]time.Time{
+		"0x01": {"a": at(0), "b": at(100)},
+		"0x02": {"a": at(50), "b": at(50)},
+		"0x03": {"b": at(10)},
+	}
+
+	r := buildLatencyReport(base, at(1000), sightings)
+	require.Equal(t, 3, r.TotalTxs)
+	require.Len(t, r.Sources, 2)
+
+	a, b := r.Sources[0], r.Sources[1]
+	require.Equal(t, "a", a.Source)
+	require.Equal(t, "b", b.Source)
+
+	require.Equal(t, 2, a.Seen)
+	require.Equal(t, 2, a.Wins)
+	require.Equal(t, 0, a.Exclusive)
+	require.InDelta(t, 100, a.WinRate, 1e-9)
+	require.Equal(t, int64(0), a.P99)
+
+	// ties count as a win for every tied source
+	require.Equal(t, 3, b.Seen)
+	require.Equal(t, 2, b.Wins)
+	require.Equal(t, 1, b.Exclusive)
+	require.InDelta(t, 100, b.Coverage, 1e-9)
+	require.InDelta(t, 100.0/3, b.ExclusiveCoverage, 1e-9)
+	require.Equal(t, int64(0), b.P50)
+	require.Equal(t, int64(100), b.P99)
+}
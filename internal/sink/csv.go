@@ -0,0 +1,298 @@
+package sink
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"github.com/denzelpenzel/magic-chain/internal/utils"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// CSVSink ... Writes records to the hourly csv buckets of the file store
+type CSVSink struct {
+	store *state.FileStore
+}
+
+func NewCSV(store *state.FileStore) *CSVSink {
+	return &CSVSink{store: store}
+}
+
+func (c *CSVSink) Name() string {
+	return CSV
+}
+
+func (c *CSVSink) WriteSighting(s *core.Sighting) error {
+	outFiles, err := c.store.GetCSVFile(s.Timestamp.Unix())
+	if err != nil {
+		return err
+	}
+
+	outFiles.Lock()
+	defer outFiles.Unlock()
+
+	file, err := outFiles.File(state.SourcelogPrefix)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(file, "%d,%s,%s\n",
+		s.Timestamp.UnixMilli(), hashString(s.Hash.Hex()), s.Source)
+	return err
+}
+
+func (c *CSVSink) WriteTx(r *core.TxRecord) error {
+	outFiles, err := c.store.GetCSVFile(r.Timestamp.Unix())
+	if err != nil {
+		return err
+	}
+
+	rlpHex, err := utils.TxToRLPString(r.Tx)
+	if err != nil {
+		return err
+	}
+
+	f := core.NewTxFields(r.Tx, r.Sender)
+
+	to := ""
+	if f.To != nil {
+		to = hashString(f.To.Hex())
+	}
+
+	selector := ""
+	if f.Selector != nil {
+		selector = hexutil.Encode(f.Selector)
+	}
+
+	outFiles.Lock()
+	defer outFiles.Unlock()
+
+	file, err := outFiles.File(state.TxsPrefix)
+	if err != nil {
+		return err
+	}
+
+	// columns follow state.TxsColumns
+	_, err = fmt.Fprintf(file, "%d,%s,%s,%s,%s,%d,%s,%d,%s,%s,%s,%d,%s,%d,%s,%d,%d\n",
+		r.Timestamp.UnixMilli(),
+		hashString(r.Tx.Hash().Hex()),
+		rlpHex,
+		hashString(f.Sender.Hex()),
+		to,
+		f.Nonce,
+		bigString(f.Value),
+		f.Gas,
+		bigString(f.GasPrice),
+		bigString(f.GasFeeCap),
+		bigString(f.GasTipCap),
+		f.Type,
+		bigString(f.ChainID),
+		f.InputSize,
+		selector,
+		f.AccessListSize,
+		f.BlobCount,
+	)
+	return err
+}
+
+func (c *CSVSink) WriteInclusion(i *core.Inclusion) error {
+	outFiles, err := c.store.GetCSVFile(i.BlockTime.Unix())
+	if err != nil {
+		return err
+	}
+
+	outFiles.Lock()
+	defer outFiles.Unlock()
+
+	file, err := outFiles.File(state.InclusionsPrefix)
+	if err != nil {
+		return err
+	}
+
+	// the block hash comes last to keep the earlier columns in place, rows of
+	// orphaned blocks are matched by the retractions bucket
+	_, err = fmt.Fprintf(file, "%d,%s,%d,%d,%s,%d,%d,%d,%s\n",
+		i.BlockTime.UnixMilli(),
+		hashString(i.Hash.Hex()),
+		i.BlockNumber,
+		i.TxIndex,
+		bigString(i.EffectiveGasPrice),
+		i.Status,
+		i.FirstSeen.UnixMilli(),
+		i.BlockTime.Sub(i.FirstSeen).Milliseconds(),
+		hashString(i.BlockHash.Hex()),
+	)
+	return err
+}
+
+func (c *CSVSink) WriteReplacement(r *core.Replacement) error {
+	outFiles, err := c.store.GetCSVFile(r.Timestamp.Unix())
+	if err != nil {
+		return err
+	}
+
+	newHash, newFeeCap, newTipCap := "", "", ""
+	if r.New != nil {
+		newHash = hashString(r.New.Hash().Hex())
+		newFeeCap = r.New.GasFeeCap().String()
+		newTipCap = r.New.GasTipCap().String()
+	}
+
+	outFiles.Lock()
+	defer outFiles.Unlock()
+
+	file, err := outFiles.File(state.ReplacementsPrefix)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(file, "%d,%s,%s,%s,%d,%s,%s,%s,%s,%s\n",
+		r.Timestamp.UnixMilli(),
+		hashString(r.Old.Hash().Hex()),
+		newHash,
+		hashString(r.Sender.Hex()),
+		r.Nonce,
+		r.Kind,
+		r.Old.GasFeeCap(),
+		newFeeCap,
+		r.Old.GasTipCap(),
+		newTipCap,
+	)
+	return err
+}
+
+func (c *CSVSink) WriteLog(l *core.LogRecord) error {
+	outFiles, err := c.store.GetCSVFile(l.Timestamp.Unix())
+	if err != nil {
+		return err
+	}
+
+	topics := make([]string, 0, len(l.Log.Topics))
+	for _, t := range l.Log.Topics {
+		topics = append(topics, hashString(t.Hex()))
+	}
+
+	outFiles.Lock()
+	defer outFiles.Unlock()
+
+	file, err := outFiles.File(state.LogsPrefix)
+	if err != nil {
+		return err
+	}
+
+	// columns follow state.LogsColumns
+	_, err = fmt.Fprintf(file, "%d,%d,%s,%s,%d,%d,%s,%s,%s,%t,%s\n",
+		l.Timestamp.UnixMilli(),
+		l.Log.BlockNumber,
+		hashString(l.Log.BlockHash.Hex()),
+		hashString(l.Log.TxHash.Hex()),
+		l.Log.TxIndex,
+		l.Log.Index,
+		hashString(l.Log.Address.Hex()),
+		strings.Join(topics, state.LogsTopicSep),
+		hexutil.Encode(l.Log.Data),
+		l.Log.Removed,
+		l.Source,
+	)
+	return err
+}
+
+func (c *CSVSink) WriteHeader(h *core.Header) error {
+	outFiles, err := c.store.GetCSVFile(h.Timestamp.Unix())
+	if err != nil {
+		return err
+	}
+
+	outFiles.Lock()
+	defer outFiles.Unlock()
+
+	file, err := outFiles.File(state.HeadersPrefix)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(file, "%d,%d,%s,%s,%d\n",
+		h.Timestamp.UnixMilli(),
+		h.Header.Number.Uint64(),
+		hashString(h.Header.Hash().Hex()),
+		hashString(h.Header.ParentHash.Hex()),
+		h.Header.Time,
+	)
+	return err
+}
+
+func (c *CSVSink) WriteReorg(r *core.Reorg) error {
+	outFiles, err := c.store.GetCSVFile(r.Timestamp.Unix())
+	if err != nil {
+		return err
+	}
+
+	outFiles.Lock()
+	defer outFiles.Unlock()
+
+	file, err := outFiles.File(state.ReorgsPrefix)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(file, "%d,%d,%d,%s,%s,%s\n",
+		r.Timestamp.UnixMilli(),
+		r.Depth,
+		r.AncestorNumber,
+		hashString(r.AncestorHash.Hex()),
+		hashList(r.OldHashes),
+		hashList(r.NewHashes),
+	)
+	return err
+}
+
+func (c *CSVSink) WriteRetraction(r *core.Retraction) error {
+	outFiles, err := c.store.GetCSVFile(r.Timestamp.Unix())
+	if err != nil {
+		return err
+	}
+
+	outFiles.Lock()
+	defer outFiles.Unlock()
+
+	file, err := outFiles.File(state.RetractionsPrefix)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(file, "%d,%s,%d,%s,%d\n",
+		r.Timestamp.UnixMilli(),
+		hashString(r.Hash.Hex()),
+		r.BlockNumber,
+		hashString(r.BlockHash.Hex()),
+		r.FirstSeen.UnixMilli(),
+	)
+	return err
+}
+
+// Close ... Bucket files are owned and closed by the file store
+func (c *CSVSink) Close() error {
+	return nil
+}
+
+func hashString(hex string) string {
+	return strings.ToLower(hex)
+}
+
+func hashList(hashes []common.Hash) string {
+	items := make([]string, 0, len(hashes))
+	for _, h := range hashes {
+		items = append(items, hashString(h.Hex()))
+	}
+	return strings.Join(items, state.HashListSep)
+}
+
+func bigString(n *big.Int) string {
+	if n == nil {
+		return ""
+	}
+	return n.String()
+}
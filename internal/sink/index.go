@@ -0,0 +1,40 @@
+package sink
+
+import (
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+)
+
+const (
+	Index = "index"
+)
+
+// IndexSink ... Feeds recorded txs into the in-memory index served by the
+// api. The index is shared by all pipelines, sightings carry the pipeline
+type IndexSink struct {
+	index    *state.TxIndex
+	pipeline string
+}
+
+func NewIndex(index *state.TxIndex, pipeline string) *IndexSink {
+	return &IndexSink{index: index, pipeline: pipeline}
+}
+
+func (i *IndexSink) Name() string {
+	return Index
+}
+
+func (i *IndexSink) WriteSighting(s *core.Sighting) error {
+	i.index.AddSighting(s.Hash, i.pipeline, s.Source, s.Timestamp)
+	return nil
+}
+
+func (i *IndexSink) WriteTx(r *core.TxRecord) error {
+	i.index.AddTx(i.pipeline, r)
+	return nil
+}
+
+// Close ... The index outlives the process and is owned by the app
+func (i *IndexSink) Close() error {
+	return nil
+}
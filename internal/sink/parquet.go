@@ -0,0 +1,253 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/xitongsys/parquet-go/parquet"
+	"github.com/xitongsys/parquet-go/writer"
+)
+
+const (
+	parquetExt = ".parquet"
+
+	// keep row groups small, buckets are written by a long running process
+	parquetRowGroupSize = 8 * 1024 * 1024
+
+	// schemaVersionKey ... Footer metadata key holding the schema version
+	schemaVersionKey       = "magic_chain.schema_version"
+	sourcelogSchemaVersion = 1
+)
+
+// parquetTx ... Typed schema of the transactions bucket
+type parquetTx struct {
+	Timestamp int64  `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Hash      string `parquet:"name=hash, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Source    string `parquet:"name=source, type=BYTE_ARRAY, convertedtype=UTF8"`
+	From      string `parquet:"name=from, type=BYTE_ARRAY, convertedtype=UTF8"`
+	// To is nil for contract creations
+	To        *string `parquet:"name=to, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	Nonce     int64   `parquet:"name=nonce, type=INT64, convertedtype=UINT_64"`
+	Value     string  `parquet:"name=value, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Gas       int64   `parquet:"name=gas, type=INT64, convertedtype=UINT_64"`
+	GasPrice  string  `parquet:"name=gas_price, type=BYTE_ARRAY, convertedtype=UTF8"`
+	GasFeeCap string  `parquet:"name=gas_fee_cap, type=BYTE_ARRAY, convertedtype=UTF8"`
+	GasTipCap string  `parquet:"name=gas_tip_cap, type=BYTE_ARRAY, convertedtype=UTF8"`
+	TxType    int32   `parquet:"name=tx_type, type=INT32, convertedtype=UINT_8"`
+	ChainID   string  `parquet:"name=chain_id, type=BYTE_ARRAY, convertedtype=UTF8"`
+	InputSize int32   `parquet:"name=input_size, type=INT32"`
+	// Selector is nil when the input is shorter than a method selector
+	Selector       *string `parquet:"name=selector, type=BYTE_ARRAY, convertedtype=UTF8, repetitiontype=OPTIONAL"`
+	AccessListSize int32   `parquet:"name=access_list_size, type=INT32"`
+	BlobCount      int32   `parquet:"name=blob_count, type=INT32"`
+	RLP            string  `parquet:"name=rlp, type=BYTE_ARRAY"`
+}
+
+// parquetSighting ... Typed schema of the sourcelog bucket
+type parquetSighting struct {
+	Timestamp int64  `parquet:"name=timestamp, type=INT64, convertedtype=TIMESTAMP_MILLIS"`
+	Hash      string `parquet:"name=hash, type=BYTE_ARRAY, convertedtype=UTF8"`
+	Source    string `parquet:"name=source, type=BYTE_ARRAY, convertedtype=UTF8"`
+}
+
+type parquetFile struct {
+	f  *os.File
+	pw *writer.ParquetWriter
+}
+
+func newParquetFile(path string, schema interface{}, version int) (*parquetFile, error) {
+	f, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, err
+	}
+
+	pw, err := writer.NewParquetWriterFromWriter(f, schema, 1)
+	if err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	pw.RowGroupSize = parquetRowGroupSize
+
+	versionStr := strconv.Itoa(version)
+	pw.Footer.KeyValueMetadata = append(pw.Footer.KeyValueMetadata, &parquet.KeyValue{
+		Key:   schemaVersionKey,
+		Value: &versionStr,
+	})
+
+	return &parquetFile{f: f, pw: pw}, nil
+}
+
+// close ... Flushes the remaining rows and writes the footer
+func (p *parquetFile) close() error {
+	return errors.Join(p.pw.WriteStop(), p.f.Close())
+}
+
+// parquetBucket ... Open parquet files of a single bucket
+type parquetBucket struct {
+	txs *parquetFile
+	src *parquetFile
+}
+
+// ParquetSink ... Writes the transactions and sourcelog buckets as parquet files
+// next to the csv buckets. Files are finalized when the file store closes the bucket
+type ParquetSink struct {
+	store *state.FileStore
+
+	buckets map[int64]*parquetBucket
+	lock    sync.Mutex
+}
+
+func NewParquet(store *state.FileStore) *ParquetSink {
+	return &ParquetSink{
+		store:   store,
+		buckets: make(map[int64]*parquetBucket),
+	}
+}
+
+func (p *ParquetSink) Name() string {
+	return Parquet
+}
+
+func (p *ParquetSink) WriteSighting(s *core.Sighting) error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	b, err := p.bucket(s.Timestamp.Unix())
+	if err != nil {
+		return err
+	}
+
+	return b.src.pw.Write(&parquetSighting{
+		Timestamp: s.Timestamp.UnixMilli(),
+		Hash:      hashString(s.Hash.Hex()),
+		Source:    s.Source,
+	})
+}
+
+func (p *ParquetSink) WriteTx(r *core.TxRecord) error {
+	raw, err := r.Tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	f := core.NewTxFields(r.Tx, r.Sender)
+
+	row := &parquetTx{
+		Timestamp:      r.Timestamp.UnixMilli(),
+		Hash:           hashString(r.Tx.Hash().Hex()),
+		Source:         r.Source,
+		From:           hashString(f.Sender.Hex()),
+		Nonce:          int64(f.Nonce), //nolint:gosec // stored as UINT_64
+		Value:          bigString(f.Value),
+		Gas:            int64(f.Gas), //nolint:gosec // stored as UINT_64
+		GasPrice:       bigString(f.GasPrice),
+		GasFeeCap:      bigString(f.GasFeeCap),
+		GasTipCap:      bigString(f.GasTipCap),
+		TxType:         int32(f.Type),
+		ChainID:        bigString(f.ChainID),
+		InputSize:      int32(f.InputSize),      //nolint:gosec // tx input is bounded by the tx size limit
+		AccessListSize: int32(f.AccessListSize), //nolint:gosec // bounded by the tx size limit
+		BlobCount:      int32(f.BlobCount),      //nolint:gosec // bounded by the blob limit
+		RLP:            string(raw),
+	}
+	if f.To != nil {
+		toHex := hashString(f.To.Hex())
+		row.To = &toHex
+	}
+	if f.Selector != nil {
+		selector := hexutil.Encode(f.Selector)
+		row.Selector = &selector
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	b, err := p.bucket(r.Timestamp.Unix())
+	if err != nil {
+		return err
+	}
+
+	return b.txs.pw.Write(row)
+}
+
+// Close ... Finalizes every open bucket
+func (p *ParquetSink) Close() error {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	var errs []error
+	for ts := range p.buckets {
+		errs = append(errs, p.closeBucket(ts))
+	}
+	return errors.Join(errs...)
+}
+
+// bucket ... Returns the open bucket for the timestamp. Must be called with the lock held
+func (p *ParquetSink) bucket(timestamp int64) (*parquetBucket, error) {
+	bucketTS := p.store.BucketTS(timestamp)
+	if b, ok := p.buckets[bucketTS]; ok {
+		return b, nil
+	}
+
+	txs, err := p.openFile(bucketTS, "transactions", state.TxsPrefix, new(parquetTx), state.TxsSchemaVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := p.openFile(bucketTS, "sourcelog", state.SourcelogPrefix, new(parquetSighting),
+		sourcelogSchemaVersion)
+	if err != nil {
+		_ = txs.close()
+		return nil, err
+	}
+
+	b := &parquetBucket{txs: txs, src: src}
+	p.buckets[bucketTS] = b
+
+	p.store.OnBucketClose(bucketTS, func() error {
+		p.lock.Lock()
+		defer p.lock.Unlock()
+		return p.closeBucket(bucketTS)
+	})
+
+	return b, nil
+}
+
+// closeBucket ... Must be called with the lock held
+func (p *ParquetSink) closeBucket(bucketTS int64) error {
+	b, ok := p.buckets[bucketTS]
+	if !ok {
+		return nil
+	}
+	delete(p.buckets, bucketTS)
+
+	return errors.Join(b.txs.close(), b.src.close())
+}
+
+// openFile ... Parquet files can not be appended to, a bucket reopened after
+// a restart gets a numbered sibling file
+func (p *ParquetSink) openFile(bucketTS int64, kind, prefix string, schema interface{},
+	version int) (*parquetFile, error) {
+	path, err := p.store.BucketPath(bucketTS, kind, prefix, parquetExt)
+	if err != nil {
+		return nil, err
+	}
+
+	base := strings.TrimSuffix(path, parquetExt)
+	for i := 1; ; i++ {
+		if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+			break
+		}
+		path = fmt.Sprintf("%s_%d%s", base, i, parquetExt)
+	}
+
+	return newParquetFile(path, schema, version)
+}
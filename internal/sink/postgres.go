@@ -0,0 +1,378 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/logging"
+	"github.com/denzelpenzel/magic-chain/internal/utils"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgtype"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+const (
+	// postgresTimeout bounds connecting, migrating and every batch
+	postgresTimeout = 30 * time.Second
+	// postgresMaxPending caps the rows kept for a retry while the database is unreachable
+	postgresMaxPending = 100_000
+	// postgresCloseRetries is the number of final flush attempts on close
+	postgresCloseRetries = 3
+
+	// migrationLockID ... Advisory lock serialising the migrations of concurrent app instances
+	migrationLockID = 0x6d616769635f63
+)
+
+// migrations ... Applied in order on startup, each one exactly once. Hashes and
+// addresses are lowercase 0x prefixed hex, the same as in the csv buckets
+var migrations = []string{
+	`CREATE TABLE pending_txs (
+		hash             TEXT PRIMARY KEY,
+		first_seen       TIMESTAMPTZ NOT NULL,
+		source           TEXT NOT NULL,
+		sender           TEXT NOT NULL,
+		to_address       TEXT,
+		nonce            NUMERIC(20) NOT NULL,
+		value            NUMERIC NOT NULL,
+		gas              NUMERIC(20) NOT NULL,
+		gas_price        NUMERIC,
+		gas_fee_cap      NUMERIC,
+		gas_tip_cap      NUMERIC,
+		tx_type          SMALLINT NOT NULL,
+		chain_id         NUMERIC,
+		input_size       INTEGER NOT NULL,
+		selector         TEXT,
+		access_list_size INTEGER NOT NULL,
+		blob_count       INTEGER NOT NULL,
+		rlp              BYTEA NOT NULL
+	);
+	CREATE INDEX pending_txs_first_seen_idx ON pending_txs (first_seen);
+	CREATE INDEX pending_txs_sender_nonce_idx ON pending_txs (sender, nonce);
+
+	CREATE TABLE tx_sightings (
+		hash       TEXT NOT NULL,
+		source     TEXT NOT NULL,
+		first_seen TIMESTAMPTZ NOT NULL,
+		PRIMARY KEY (hash, source)
+	);
+	CREATE INDEX tx_sightings_first_seen_idx ON tx_sightings (first_seen);`,
+}
+
+var (
+	pendingTxColumns = []string{
+		"hash", "first_seen", "source", "sender", "to_address", "nonce", "value", "gas",
+		"gas_price", "gas_fee_cap", "gas_tip_cap", "tx_type", "chain_id", "input_size",
+		"selector", "access_list_size", "blob_count", "rlp",
+	}
+	sightingColumns = []string{"hash", "source", "first_seen"}
+)
+
+// batches are copied into a staging table first, COPY itself cannot skip conflicts
+const (
+	stagePendingTxs = `CREATE TEMP TABLE pending_txs_stage (LIKE pending_txs) ON COMMIT DROP`
+	mergePendingTxs = `INSERT INTO pending_txs SELECT * FROM pending_txs_stage
+		ON CONFLICT (hash) DO NOTHING`
+
+	stageSightings = `CREATE TEMP TABLE tx_sightings_stage (LIKE tx_sightings) ON COMMIT DROP`
+	mergeSightings = `INSERT INTO tx_sightings
+		SELECT DISTINCT ON (hash, source) * FROM tx_sightings_stage ORDER BY hash, source, first_seen
+		ON CONFLICT (hash, source) DO UPDATE SET first_seen = LEAST(tx_sightings.first_seen, EXCLUDED.first_seen)`
+)
+
+// PostgresSink ... Writes the pending txs and their sightings per source to
+// PostgreSQL in batches. The app creates a single sink shared by all
+// pipelines and closes it after them. Txs recorded twice, e.g. by concurrent
+// pipelines or after a restart, are deduplicated by hash
+type PostgresSink struct {
+	pool      *pgxpool.Pool
+	batchSize int
+
+	lock      sync.Mutex
+	txs       [][]any
+	sightings [][]any
+
+	// flush asks the flush loop for a batch ahead of the interval
+	flush chan struct{}
+	close chan struct{}
+	wg    sync.WaitGroup
+}
+
+// NewPostgres ... Connects to the database and applies the pending migrations
+func NewPostgres(cfg *config.PostgresConfig) (*PostgresSink, error) {
+	if cfg == nil || cfg.URL == "" {
+		return nil, fmt.Errorf("postgres sink requires a database url")
+	}
+
+	if cfg.BatchSize < 1 || cfg.FlushInterval <= 0 {
+		return nil, fmt.Errorf("postgres sink requires a positive batch size and flush interval")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	pool, err := pgxpool.New(ctx, cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := migrate(ctx, pool); err != nil {
+		pool.Close()
+		return nil, err
+	}
+
+	p := &PostgresSink{
+		pool:      pool,
+		batchSize: cfg.BatchSize,
+		flush:     make(chan struct{}, 1),
+		close:     make(chan struct{}),
+	}
+
+	p.wg.Add(1)
+	go p.flushLoop(cfg.FlushInterval)
+
+	return p, nil
+}
+
+// WithPostgres ... Returns a copy of ctx carrying the sink shared by the pipelines
+func WithPostgres(ctx context.Context, p *PostgresSink) context.Context {
+	return context.WithValue(ctx, core.Sinks, p)
+}
+
+func PostgresFromContext(ctx context.Context) (*PostgresSink, error) {
+	p, ok := ctx.Value(core.Sinks).(*PostgresSink)
+	if !ok {
+		return nil, fmt.Errorf("failed to retrieve postgres sink from context")
+	}
+	return p, nil
+}
+
+// migrate ... Applies the migrations missing from schema_migrations
+func migrate(ctx context.Context, pool *pgxpool.Pool) error {
+	tx, err := pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1)`, migrationLockID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version    INTEGER PRIMARY KEY,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+	)`)
+	if err != nil {
+		return err
+	}
+
+	var current int
+	if err := tx.QueryRow(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return err
+	}
+
+	for i := current; i < len(migrations); i++ {
+		if _, err := tx.Exec(ctx, migrations[i]); err != nil {
+			return fmt.Errorf("migration %d: %w", i+1, err)
+		}
+		if _, err := tx.Exec(ctx, `INSERT INTO schema_migrations (version) VALUES ($1)`, i+1); err != nil {
+			return err
+		}
+		logging.NoContext().Info("Applied postgres migration", zap.Int("version", i+1))
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (p *PostgresSink) Name() string {
+	return Postgres
+}
+
+func (p *PostgresSink) WriteSighting(s *core.Sighting) error {
+	return p.add(&p.sightings, []any{hashString(s.Hash.Hex()), s.Source, s.Timestamp})
+}
+
+func (p *PostgresSink) WriteTx(r *core.TxRecord) error {
+	raw, err := r.Tx.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	f := core.NewTxFields(r.Tx, r.Sender)
+
+	var to, selector *string
+	if f.To != nil {
+		s := hashString(f.To.Hex())
+		to = &s
+	}
+	if f.Selector != nil {
+		s := hexutil.Encode(f.Selector)
+		selector = &s
+	}
+
+	// columns follow pendingTxColumns
+	return p.add(&p.txs, []any{
+		hashString(r.Tx.Hash().Hex()),
+		r.Timestamp,
+		r.Source,
+		hashString(f.Sender.Hex()),
+		to,
+		numeric(new(big.Int).SetUint64(f.Nonce)),
+		numeric(f.Value),
+		numeric(new(big.Int).SetUint64(f.Gas)),
+		numeric(f.GasPrice),
+		numeric(f.GasFeeCap),
+		numeric(f.GasTipCap),
+		int16(f.Type),
+		numeric(f.ChainID),
+		int32(f.InputSize), //nolint:gosec // bounded by the tx size limit
+		selector,
+		int32(f.AccessListSize), //nolint:gosec // bounded by the tx size limit
+		int32(f.BlobCount),      //nolint:gosec // bounded by the tx size limit
+		raw,
+	})
+}
+
+// add ... Buffers a row without blocking, a full batch wakes up the flush
+// loop. Write errors surface in the flush loop logs
+func (p *PostgresSink) add(buf *[][]any, row []any) error {
+	p.lock.Lock()
+	*buf = trim(append(*buf, row))
+	full := len(*buf) >= p.batchSize
+	p.lock.Unlock()
+
+	if full {
+		select {
+		case p.flush <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// flushLoop ... Writes the buffered rows every interval and once a batch is
+// full. After a failed flush the rows wait for the next interval
+func (p *PostgresSink) flushLoop(interval time.Duration) {
+	defer p.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failed := false
+	for {
+		select {
+		case <-ticker.C:
+		case <-p.flush:
+			if failed {
+				continue
+			}
+		case <-p.close:
+			return
+		}
+
+		err := p.write()
+		if failed = err != nil; failed {
+			logging.NoContext().Error("Failed to flush postgres batch", zap.Error(err))
+		}
+	}
+}
+
+// write ... Writes the buffered rows in a single transaction. Failed rows
+// are kept for the next flush up to postgresMaxPending. Only called by the
+// flush loop, or by Close once it stopped
+func (p *PostgresSink) write() error {
+	p.lock.Lock()
+	txs, sightings := p.txs, p.sightings
+	p.txs, p.sightings = nil, nil
+	p.lock.Unlock()
+
+	if len(txs) == 0 && len(sightings) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+
+	err := pgx.BeginFunc(ctx, p.pool, func(tx pgx.Tx) error {
+		if err := copyMerge(ctx, tx, stagePendingTxs, "pending_txs_stage", mergePendingTxs,
+			pendingTxColumns, txs); err != nil {
+			return err
+		}
+		return copyMerge(ctx, tx, stageSightings, "tx_sightings_stage", mergeSightings,
+			sightingColumns, sightings)
+	})
+	if err == nil {
+		return nil
+	}
+
+	p.lock.Lock()
+	p.txs = requeue(txs, p.txs)
+	p.sightings = requeue(sightings, p.sightings)
+	p.lock.Unlock()
+
+	return err
+}
+
+// copyMerge ... Copies rows into a fresh staging table and merges them into the target
+func copyMerge(ctx context.Context, tx pgx.Tx, stage, stageTable, merge string, columns []string,
+	rows [][]any) error {
+	if len(rows) == 0 {
+		return nil
+	}
+
+	if _, err := tx.Exec(ctx, stage); err != nil {
+		return err
+	}
+
+	if _, err := tx.CopyFrom(ctx, pgx.Identifier{stageTable}, columns, pgx.CopyFromRows(rows)); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec(ctx, merge)
+	return err
+}
+
+// requeue ... Puts failed rows in front of the rows buffered meanwhile
+func requeue(failed, buffered [][]any) [][]any {
+	return trim(append(failed, buffered...))
+}
+
+// trim ... Drops the oldest rows beyond postgresMaxPending
+func trim(rows [][]any) [][]any {
+	if dropped := len(rows) - postgresMaxPending; dropped > 0 {
+		logging.NoContext().Error("Dropping postgres rows", zap.Int("rows", dropped))
+		rows = rows[dropped:]
+	}
+	return rows
+}
+
+// Close ... Stops the flush loop, writes the remaining rows and closes the
+// connections. Called by the app once every pipeline stopped
+func (p *PostgresSink) Close() error {
+	close(p.close)
+	p.wg.Wait()
+
+	err := p.write()
+	for attempt := 1; err != nil && attempt < postgresCloseRetries; attempt++ {
+		time.Sleep(utils.Backoff(attempt, core.MinBackoffMs*time.Millisecond, core.MaxBackoffSec*time.Second))
+		err = p.write()
+	}
+
+	p.pool.Close()
+	if err != nil {
+		return errors.Join(fmt.Errorf("postgres sink closed with unflushed rows"), err)
+	}
+	return nil
+}
+
+func numeric(n *big.Int) pgtype.Numeric {
+	return pgtype.Numeric{Int: n, Valid: n != nil}
+}
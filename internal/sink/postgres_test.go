@@ -0,0 +1,46 @@
+package sink
+
+import (
+	"testing"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresAddSignalsFullBatch(t *testing.T) {
+	p := &PostgresSink{batchSize: 2, flush: make(chan struct{}, 1)}
+
+	sighting := &core.Sighting{Hash: common.Hash{1}, Source: "a", Timestamp: time.Now()}
+
+	require.NoError(t, p.WriteSighting(sighting))
+	require.Len(t, p.flush, 0)
+
+	require.NoError(t, p.WriteSighting(sighting))
+	require.Len(t, p.flush, 1)
+
+	// a pending signal is not doubled, writers never wait for the flush loop
+	require.NoError(t, p.WriteSighting(sighting))
+	require.Len(t, p.flush, 1)
+	require.Len(t, p.sightings, 3)
+}
+
+func TestPostgresRequeue(t *testing.T) {
+	rows := func(from, to int) [][]any {
+		res := make([][]any, 0, to-from)
+		for i := from; i < to; i++ {
+			res = append(res, []any{i})
+		}
+		return res
+	}
+
+	// failed rows go first
+	require.Equal(t, rows(0, 4), requeue(rows(0, 2), rows(2, 4)))
+
+	// the oldest rows are dropped beyond the cap
+	kept := requeue(rows(0, 10), rows(10, postgresMaxPending+10))
+	require.Len(t, kept, postgresMaxPending)
+	require.Equal(t, []any{10}, kept[0])
+	require.Equal(t, []any{postgresMaxPending + 9}, kept[len(kept)-1])
+}
@@ -0,0 +1,247 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/logging"
+	"github.com/denzelpenzel/magic-chain/internal/metrics"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"go.uber.org/zap"
+)
+
+const (
+	CSV      = "csv"
+	Parquet  = "parquet"
+	Postgres = "postgres"
+
+	unknownSinkErr = "unknown sink %s provided"
+)
+
+// Sink ... Output backend for recorded pending txs
+type Sink interface {
+	Name() string
+	WriteSighting(s *core.Sighting) error
+	WriteTx(r *core.TxRecord) error
+	Close() error
+}
+
+// InclusionWriter ... Implemented by sinks that also store tx inclusions
+type InclusionWriter interface {
+	WriteInclusion(i *core.Inclusion) error
+}
+
+// ReplacementWriter ... Implemented by sinks that also store tx replacements
+type ReplacementWriter interface {
+	WriteReplacement(r *core.Replacement) error
+}
+
+// LogWriter ... Implemented by sinks that also store contract event logs
+type LogWriter interface {
+	WriteLog(l *core.LogRecord) error
+}
+
+// HeaderWriter ... Implemented by sinks that also store canonical headers
+type HeaderWriter interface {
+	WriteHeader(h *core.Header) error
+}
+
+// ReorgWriter ... Implemented by sinks that also store chain reorgs and the
+// inclusions they retracted
+type ReorgWriter interface {
+	WriteReorg(r *core.Reorg) error
+	WriteRetraction(r *core.Retraction) error
+}
+
+// New ... Builds the sinks listed in the config, followed by the extra
+// sinks, behind a single fan out sink. The postgres sink is shared by the
+// pipelines, it is taken from ctx and left open by Close. Only the configured
+// sinks count as durable, a record stored by the extra ones alone, like the
+// in memory index and stream, is not written
+func New(ctx context.Context, cfg *config.Config, store *state.FileStore, extra ...Sink) (*Multi, error) {
+	sinks := make([]Sink, 0, len(cfg.SystemConfig.Sinks)+len(extra))
+
+	for _, name := range cfg.SystemConfig.Sinks {
+		switch strings.ToLower(name) {
+		case CSV:
+			sinks = append(sinks, NewCSV(store))
+
+		case Parquet:
+			sinks = append(sinks, NewParquet(store))
+
+		case Postgres:
+			pg, err := PostgresFromContext(ctx)
+			if err != nil {
+				return nil, errors.Join(err, NewMulti(sinks...).Close())
+			}
+			sinks = append(sinks, &shared{pg})
+
+		default:
+			return nil, errors.Join(fmt.Errorf(unknownSinkErr, name), NewMulti(sinks...).Close())
+		}
+	}
+
+	m := NewMulti(append(sinks, extra...)...)
+	m.durable = len(sinks)
+	m.pipeline = cfg.SystemConfig.Pipeline
+	return m, nil
+}
+
+// shared ... Sink owned by the app, closing a pipeline leaves it open
+type shared struct {
+	Sink
+}
+
+func (s *shared) Close() error {
+	return nil
+}
+
+// PartialWriteError ... Returned by Multi when some sinks failed while the
+// others stored the record, retrying the write would duplicate it there
+type PartialWriteError struct {
+	Failed []string
+	Err    error
+}
+
+func (e *PartialWriteError) Error() string {
+	return fmt.Sprintf("sinks %s failed: %s", strings.Join(e.Failed, ","), e.Err)
+}
+
+func (e *PartialWriteError) Unwrap() error {
+	return e.Err
+}
+
+// Multi ... Fans every record out to all sinks. A failing sink is logged
+// and does not prevent the record from reaching the others
+type Multi struct {
+	sinks []Sink
+	// durable is the number of leading sinks that store records durably, a
+	// write failing on all of them failed as a whole
+	durable int
+	// pipeline labels the write error metrics
+	pipeline string
+}
+
+func NewMulti(sinks ...Sink) *Multi {
+	return &Multi{sinks: sinks, durable: len(sinks)}
+}
+
+func (m *Multi) Name() string {
+	names := make([]string, 0, len(m.sinks))
+	for _, s := range m.sinks {
+		names = append(names, s.Name())
+	}
+	return strings.Join(names, ",")
+}
+
+func (m *Multi) WriteSighting(s *core.Sighting) error {
+	return m.each("sighting", func(sk Sink) error {
+		return sk.WriteSighting(s)
+	})
+}
+
+func (m *Multi) WriteTx(r *core.TxRecord) error {
+	return m.each("tx", func(sk Sink) error {
+		return sk.WriteTx(r)
+	})
+}
+
+func (m *Multi) WriteInclusion(i *core.Inclusion) error {
+	return m.each("inclusion", func(sk Sink) error {
+		if w, ok := sk.(InclusionWriter); ok {
+			return w.WriteInclusion(i)
+		}
+		return nil
+	})
+}
+
+func (m *Multi) WriteReplacement(r *core.Replacement) error {
+	return m.each("replacement", func(sk Sink) error {
+		if w, ok := sk.(ReplacementWriter); ok {
+			return w.WriteReplacement(r)
+		}
+		return nil
+	})
+}
+
+func (m *Multi) WriteLog(l *core.LogRecord) error {
+	return m.each("log", func(sk Sink) error {
+		if w, ok := sk.(LogWriter); ok {
+			return w.WriteLog(l)
+		}
+		return nil
+	})
+}
+
+func (m *Multi) WriteHeader(h *core.Header) error {
+	return m.each("header", func(sk Sink) error {
+		if w, ok := sk.(HeaderWriter); ok {
+			return w.WriteHeader(h)
+		}
+		return nil
+	})
+}
+
+func (m *Multi) WriteReorg(r *core.Reorg) error {
+	return m.each("reorg", func(sk Sink) error {
+		if w, ok := sk.(ReorgWriter); ok {
+			return w.WriteReorg(r)
+		}
+		return nil
+	})
+}
+
+func (m *Multi) WriteRetraction(r *core.Retraction) error {
+	return m.each("retraction", func(sk Sink) error {
+		if w, ok := sk.(ReorgWriter); ok {
+			return w.WriteRetraction(r)
+		}
+		return nil
+	})
+}
+
+func (m *Multi) Close() error {
+	return m.each("close", func(sk Sink) error {
+		return sk.Close()
+	})
+}
+
+// each ... Runs fn on every sink, returns a PartialWriteError when only some
+// of them failed. A write failing on every durable sink fails as a whole,
+// whatever the other sinks did
+func (m *Multi) each(op string, fn func(Sink) error) error {
+	var (
+		errs          []error
+		failed        []string
+		failedDurable int
+	)
+
+	for i, sk := range m.sinks {
+		if err := fn(sk); err != nil {
+			logging.NoContext().Error("Sink write failed",
+				zap.String("sink", sk.Name()),
+				zap.String("op", op),
+				zap.Error(err))
+			metrics.SinkWriteErrors.WithLabelValues(m.pipeline, sk.Name(), op).Inc()
+			errs = append(errs, fmt.Errorf("%s: %w", sk.Name(), err))
+			failed = append(failed, sk.Name())
+			if i < m.durable {
+				failedDurable++
+			}
+		}
+	}
+
+	total := len(errs) == len(m.sinks)
+	if m.durable > 0 {
+		total = failedDurable == m.durable
+	}
+
+	if len(errs) > 0 && !total {
+		return &PartialWriteError{Failed: failed, Err: errors.Join(errs...)}
+	}
+	return errors.Join(errs...)
+}
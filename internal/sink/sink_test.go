@@ -0,0 +1,141 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeSink struct {
+	name string
+	err  error
+	txs  int
+}
+
+func (f *fakeSink) Name() string                       { return f.name }
+func (f *fakeSink) WriteSighting(*core.Sighting) error { return f.err }
+func (f *fakeSink) Close() error                       { return nil }
+
+func (f *fakeSink) WriteTx(*core.TxRecord) error {
+	if f.err == nil {
+		f.txs++
+	}
+	return f.err
+}
+
+func TestMultiWriteErrors(t *testing.T) {
+	errDown := errors.New("down")
+
+	t.Run("all sinks succeed", func(t *testing.T) {
+		a, b := &fakeSink{name: "a"}, &fakeSink{name: "b"}
+		require.NoError(t, NewMulti(a, b).WriteTx(&core.TxRecord{}))
+		require.Equal(t, 1, a.txs)
+		require.Equal(t, 1, b.txs)
+	})
+
+	t.Run("some sinks fail", func(t *testing.T) {
+		a, b := &fakeSink{name: "a"}, &fakeSink{name: "b", err: errDown}
+		err := NewMulti(a, b).WriteTx(&core.TxRecord{})
+
+		var partial *PartialWriteError
+		require.ErrorAs(t, err, &partial)
+		require.Equal(t, []string{"b"}, partial.Failed)
+		require.ErrorIs(t, err, errDown)
+		require.Equal(t, 1, a.txs)
+	})
+
+	t.Run("every sink fails", func(t *testing.T) {
+		a, b := &fakeSink{name: "a", err: errDown}, &fakeSink{name: "b", err: errDown}
+		err := NewMulti(a, b).WriteTx(&core.TxRecord{})
+
+		var partial *PartialWriteError
+		require.ErrorIs(t, err, errDown)
+		require.False(t, errors.As(err, &partial))
+	})
+}
+
+func TestMultiDurableSinks(t *testing.T) {
+	store := state.NewFileStore(t.TempDir())
+	require.NoError(t, store.Close())
+
+	// the csv sink fails on the closed store while the in memory sinks succeed
+	cfg := &config.Config{SystemConfig: &config.SystemConfig{Sinks: []string{CSV}}}
+	index, stream := &fakeSink{name: "index"}, &fakeSink{name: "stream"}
+	m, err := New(context.Background(), cfg, store, index, stream)
+	require.NoError(t, err)
+
+	err = m.WriteTx(&core.TxRecord{Tx: types.NewTx(&types.LegacyTx{}), Timestamp: time.Now()})
+	require.ErrorIs(t, err, state.ErrStoreClosed)
+
+	var partial *PartialWriteError
+	require.False(t, errors.As(err, &partial))
+	require.Equal(t, 1, index.txs)
+	require.Equal(t, 1, stream.txs)
+
+	// a failing in memory sink next to a working durable one is a partial write
+	stream.err = errors.New("down")
+	m = NewMulti(&fakeSink{name: "csv"}, stream)
+	m.durable = 1
+	require.ErrorAs(t, m.WriteTx(&core.TxRecord{}), &partial)
+}
+
+func TestNewSharesPostgres(t *testing.T) {
+	cfg := &config.Config{SystemConfig: &config.SystemConfig{Sinks: []string{Postgres}}}
+
+	_, err := New(context.Background(), cfg, nil)
+	require.Error(t, err)
+
+	// the zero sink panics when closed, the pipeline must leave it to the app
+	pg := &PostgresSink{}
+	m, err := New(WithPostgres(context.Background(), pg), cfg, nil)
+	require.NoError(t, err)
+	require.Equal(t, Postgres, m.Name())
+	require.NoError(t, m.Close())
+}
+
+func TestCSVReplacementColumns(t *testing.T) {
+	dir := t.TempDir()
+	store := state.NewFileStore(dir)
+	c := NewCSV(store)
+
+	to := common.HexToAddress("0x2000000000000000000000000000000000000002")
+	old := types.NewTx(&types.DynamicFeeTx{Nonce: 1, GasTipCap: big.NewInt(1), GasFeeCap: big.NewInt(10), To: &to})
+	bump := types.NewTx(&types.DynamicFeeTx{Nonce: 1, GasTipCap: big.NewInt(2), GasFeeCap: big.NewInt(11), To: &to})
+	ts := time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC)
+
+	for _, r := range []*core.Replacement{
+		{Timestamp: ts, Kind: core.FeeBump, Nonce: 1, Old: old, New: bump},
+		{Timestamp: ts, Kind: core.Dropped, Nonce: 1, Old: bump},
+	} {
+		require.NoError(t, c.WriteReplacement(r))
+	}
+	require.NoError(t, store.Close())
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*", "replacements", state.ReplacementsPrefix+"*.csv"))
+	require.NoError(t, err)
+	require.Len(t, paths, 1)
+
+	raw, err := os.ReadFile(paths[0])
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(raw), "\n"), "\n")
+	require.Len(t, lines, 4)
+
+	require.Equal(t, fmt.Sprintf("#schema=%s/v%d", state.ReplacementsPrefix, state.ReplacementsSchemaVersion), lines[0])
+	require.Equal(t, strings.Join(state.ReplacementsColumns, ","), lines[1])
+	for _, row := range lines[2:] {
+		require.Len(t, strings.Split(row, ","), len(state.ReplacementsColumns), row)
+	}
+}
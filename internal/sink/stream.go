@@ -0,0 +1,38 @@
+package sink
+
+import (
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/stream"
+)
+
+const (
+	Stream = "stream"
+)
+
+// StreamSink ... Publishes the recorded txs to the live stream subscribers
+type StreamSink struct {
+	hub *stream.Hub
+}
+
+func NewStream(hub *stream.Hub) *StreamSink {
+	return &StreamSink{hub: hub}
+}
+
+func (s *StreamSink) Name() string {
+	return Stream
+}
+
+// WriteSighting ... Only deduplicated and validated txs are streamed
+func (s *StreamSink) WriteSighting(_ *core.Sighting) error {
+	return nil
+}
+
+func (s *StreamSink) WriteTx(r *core.TxRecord) error {
+	s.hub.Publish(r)
+	return nil
+}
+
+// Close ... The hub outlives the process and is owned by the app
+func (s *StreamSink) Close() error {
+	return nil
+}
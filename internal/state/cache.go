@@ -0,0 +1,141 @@
+package state
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cockroachdb/pebble"
+)
+
+// TxCache ... Dedup index of already recorded txs keyed by hash
+type TxCache interface {
+	Get(key string) (time.Time, bool, error)
+	Set(key string, value time.Time) error
+	// Expire ... Removes all entries with a value before the cutoff
+	Expire(cutoff time.Time) error
+	Close() error
+}
+
+// memoryCache ... In-process dedup index, lost on restart
+type memoryCache struct {
+	knownTxs     map[string]time.Time
+	knownTxsLock sync.RWMutex
+}
+
+func NewMemoryCache() TxCache {
+	return &memoryCache{
+		knownTxs: make(map[string]time.Time),
+	}
+}
+
+func (m *memoryCache) Get(key string) (time.Time, bool, error) {
+	m.knownTxsLock.RLock()
+	defer m.knownTxsLock.RUnlock()
+
+	val, exists := m.knownTxs[key]
+	return val, exists, nil
+}
+
+func (m *memoryCache) Set(key string, value time.Time) error {
+	m.knownTxsLock.Lock()
+	defer m.knownTxsLock.Unlock()
+
+	m.knownTxs[key] = value
+	return nil
+}
+
+func (m *memoryCache) Expire(cutoff time.Time) error {
+	m.knownTxsLock.Lock()
+	defer m.knownTxsLock.Unlock()
+
+	for k, v := range m.knownTxs {
+		if v.Before(cutoff) {
+			delete(m.knownTxs, k)
+		}
+	}
+	return nil
+}
+
+func (m *memoryCache) Close() error {
+	return nil
+}
+
+// pebbleCache ... On-disk dedup index surviving restarts
+type pebbleCache struct {
+	db *pebble.DB
+}
+
+// NewPebbleCache ... Opens or creates the dedup index stored in dirname
+func NewPebbleCache(dirname string) (TxCache, error) {
+	db, err := pebble.Open(dirname, &pebble.Options{})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open dedup index %s: %w", dirname, err)
+	}
+	return &pebbleCache{db: db}, nil
+}
+
+func (p *pebbleCache) Get(key string) (time.Time, bool, error) {
+	val, closer, err := p.db.Get([]byte(key))
+	if errors.Is(err, pebble.ErrNotFound) {
+		return time.Time{}, false, nil
+	}
+	if err != nil {
+		return time.Time{}, false, err
+	}
+	defer closer.Close()
+
+	return decodeTime(val), true, nil
+}
+
+func (p *pebbleCache) Set(key string, value time.Time) error {
+	// losing the last writes on a crash only causes duplicates, skip the fsync
+	return p.db.Set([]byte(key), encodeTime(value), pebble.NoSync)
+}
+
+func (p *pebbleCache) Expire(cutoff time.Time) error {
+	iter, err := p.db.NewIter(nil)
+	if err != nil {
+		return err
+	}
+
+	batch := p.db.NewBatch()
+	defer batch.Close()
+
+	for iter.First(); iter.Valid(); iter.Next() {
+		if decodeTime(iter.Value()).Before(cutoff) {
+			if err := batch.Delete(iter.Key(), nil); err != nil {
+				_ = iter.Close()
+				return err
+			}
+		}
+	}
+
+	if err := iter.Close(); err != nil {
+		return err
+	}
+
+	if batch.Count() == 0 {
+		return nil
+	}
+	return batch.Commit(pebble.NoSync)
+}
+
+func (p *pebbleCache) Close() error {
+	return p.db.Close()
+}
+
+func encodeTime(t time.Time) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, uint64(t.UnixNano())) //nolint:gosec // post 1970 timestamps only
+	return buf
+}
+
+func decodeTime(buf []byte) time.Time {
+	if len(buf) != 8 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(binary.BigEndian.Uint64(buf))).UTC() //nolint:gosec // post 1970 timestamps only
+}
@@ -1,50 +1,298 @@
 package state
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/logging"
+	"go.uber.org/zap"
 )
 
+// OutFiles ... Csv files of a bucket, each kind is opened by its first row.
+// Writers must hold the lock so concurrent rows are neither interleaved nor
+// reordered within a file
 type OutFiles struct {
-	FTxs       *os.File
-	FSourcelog *os.File
+	sync.Mutex
+
+	open  func(prefix string) (*BucketFile, error)
+	files map[string]*BucketFile
+	// detached buckets are being closed and open no more files
+	detached bool
+}
+
+// File ... Returns the bucket file of the kind named by its prefix, opening it
+// on first use. Must be called with the lock held
+func (o *OutFiles) File(prefix string) (*BucketFile, error) {
+	if o.detached {
+		return nil, os.ErrClosed
+	}
+
+	if file, ok := o.files[prefix]; ok {
+		return file, nil
+	}
+
+	file, err := o.open(prefix)
+	if err != nil {
+		return nil, err
+	}
+	o.files[prefix] = file
+	return file, nil
+}
+
+// all ... Returns the files opened so far
+func (o *OutFiles) all() []*BucketFile {
+	o.Lock()
+	defer o.Unlock()
+
+	return o.opened()
+}
+
+// detach ... Stops opening files and returns the files opened so far
+func (o *OutFiles) detach() []*BucketFile {
+	o.Lock()
+	defer o.Unlock()
+
+	o.detached = true
+	return o.opened()
+}
+
+// opened ... Must be called with the lock held
+func (o *OutFiles) opened() []*BucketFile {
+	files := make([]*BucketFile, 0, len(o.files))
+	for _, file := range o.files {
+		files = append(files, file)
+	}
+	return files
 }
 
 const (
 	notFoundError = "could not find state store value for key %s"
+
+	csvExt = ".csv"
+)
+
+// Bucket file prefixes
+const (
+	TxsPrefix          = "txs"
+	SourcelogPrefix    = "src"
+	InclusionsPrefix   = "inc"
+	ReplacementsPrefix = "rpl"
+	LogsPrefix         = "log"
+	HeadersPrefix      = "hdr"
+	ReorgsPrefix       = "reo"
+	RetractionsPrefix  = "ret"
 )
 
+// bucketKinds ... Layout kind and header of the bucket files per prefix
+var bucketKinds = map[string]struct {
+	dir    string
+	header func() string
+}{
+	TxsPrefix:          {dir: "transactions", header: txsHeader},
+	SourcelogPrefix:    {dir: "sourcelog"},
+	InclusionsPrefix:   {dir: "inclusions", header: inclusionsHeader},
+	ReplacementsPrefix: {dir: "replacements", header: replacementsHeader},
+	LogsPrefix:         {dir: "logs", header: logsHeader},
+	HeadersPrefix:      {dir: "headers"},
+	ReorgsPrefix:       {dir: "reorgs"},
+	RetractionsPrefix:  {dir: "retractions"},
+}
+
+// TxsSchemaVersion ... Version of the transactions bucket columns, written
+// as a comment line at the top of every new transactions file
+const TxsSchemaVersion = 2
+
+// Transactions bucket columns, the first three are shared with schema v1
+const (
+	TxsTimestampCol = iota
+	TxsHashCol
+	TxsRLPCol
+	TxsSenderCol
+	TxsToCol
+	TxsNonceCol
+	TxsValueCol
+	TxsGasCol
+	TxsGasPriceCol
+	TxsGasFeeCapCol
+	TxsGasTipCapCol
+	TxsTypeCol
+	TxsChainIDCol
+	TxsInputSizeCol
+	TxsSelectorCol
+	TxsAccessListSizeCol
+	TxsBlobCountCol
+)
+
+// TxsColumns ... Header row of the transactions bucket
+var TxsColumns = []string{
+	"timestamp", "hash", "rlp", "sender", "to", "nonce", "value", "gas",
+	"gas_price", "gas_fee_cap", "gas_tip_cap", "type", "chain_id",
+	"input_size", "selector", "access_list_size", "blob_count",
+}
+
+// LogsSchemaVersion ... Version of the logs bucket columns
+const LogsSchemaVersion = 1
+
+// Logs bucket columns, topics are joined by LogsTopicSep
+const (
+	LogsTimestampCol = iota
+	LogsBlockNumberCol
+	LogsBlockHashCol
+	LogsTxHashCol
+	LogsTxIndexCol
+	LogsIndexCol
+	LogsAddressCol
+	LogsTopicsCol
+	LogsDataCol
+	LogsRemovedCol
+	LogsSourceCol
+)
+
+// LogsColumns ... Header row of the logs bucket
+var LogsColumns = []string{
+	"timestamp", "block_number", "block_hash", "tx_hash", "tx_index",
+	"log_index", "address", "topics", "data", "removed", "source",
+}
+
+const LogsTopicSep = ";"
+
+// InclusionsSchemaVersion ... Version of the inclusions bucket columns, v1
+// files have no header and lack the block hash
+const InclusionsSchemaVersion = 2
+
+// Inclusions bucket columns, the first eight are shared with schema v1
+const (
+	InclusionsTimestampCol = iota
+	InclusionsHashCol
+	InclusionsBlockNumberCol
+	InclusionsTxIndexCol
+	InclusionsEffectiveGasPriceCol
+	InclusionsStatusCol
+	InclusionsFirstSeenCol
+	InclusionsLatencyCol
+	InclusionsBlockHashCol
+)
+
+// InclusionsColumns ... Header row of the inclusions bucket
+var InclusionsColumns = []string{
+	"block_time", "hash", "block_number", "tx_index", "effective_gas_price",
+	"status", "first_seen", "inclusion_latency_ms", "block_hash",
+}
+
+// ReplacementsSchemaVersion ... Version of the replacements bucket columns,
+// files written before the header was added have the same columns
+const ReplacementsSchemaVersion = 1
+
+// ReplacementsColumns ... Header row of the replacements bucket, the new_*
+// columns are empty for dropped txs
+var ReplacementsColumns = []string{
+	"timestamp", "old_hash", "new_hash", "sender", "nonce", "kind",
+	"old_gas_fee_cap", "new_gas_fee_cap", "old_gas_tip_cap", "new_gas_tip_cap",
+}
+
+// HashListSep ... Separator of the hash lists in the reorgs bucket
+const HashListSep = ";"
+
+// schemaMarker ... Prefix of the comment line holding the schema version
+const schemaMarker = "#schema="
+
+// ErrStoreClosed ... Returned when a bucket is requested after Close
+var ErrStoreClosed = errors.New("file store is closed")
+
 type FileStore struct {
 	uid       core.UUID
 	dirname   string
 	filesLock *sync.RWMutex
 	files     map[int64]*OutFiles
-
-	knownTxs     map[string]time.Time
-	knownTxsLock sync.RWMutex
+	closers   map[int64][]func() error
+	// sealing holds the buckets being sealed, closed once they are done
+	sealing     map[int64]chan struct{}
+	compression Compression
+	// bucketDuration is the time span covered by a bucket, layout places its files
+	bucketDuration time.Duration
+	layout         *Layout
+	// open buckets are synced every syncInterval and after syncRows rows per
+	// file, zero disables either trigger
+	syncInterval time.Duration
+	syncRows     int
+	// eventTime ages buckets and dedup entries by the newest written
+	// timestamp, kept in watermark, instead of the wall clock
+	eventTime bool
+	watermark atomic.Int64
+
+	knownTxs TxCache
+	done     chan struct{}
+	// closed is guarded by the files lock, cleaner tracks the running Cleaner
+	closed  bool
+	cleaner sync.WaitGroup
 }
 
-func NewFileStore(dirname string) *FileStore {
-	return &FileStore{
+func NewFileStore(dirname string, opts ...Option) *FileStore {
+	f := &FileStore{
 		dirname:   dirname,
 		filesLock: &sync.RWMutex{},
 		files:     make(map[int64]*OutFiles),
-		knownTxs:  make(map[string]time.Time),
+		closers:   make(map[int64][]func() error),
+		sealing:   make(map[int64]chan struct{}),
+		knownTxs:  NewMemoryCache(),
+
+		compression:    NoCompression,
+		bucketDuration: core.DefaultBucketDuration,
+		layout:         &Layout{tmpl: core.DefaultBucketLayout},
+		syncInterval:   core.DefaultSyncInterval,
+		syncRows:       core.DefaultSyncRows,
+		done:           make(chan struct{}),
+	}
+
+	for _, opt := range opts {
+		opt(f)
 	}
+
+	return f
 }
 
-func (f *FileStore) GetCSVFile(timestamp int64) (*OutFiles, error) {
-	sec := int64(core.BucketMinutes * 60)
-	bucketTS := timestamp / sec * sec
+// BucketTS ... Returns the start of the bucket the unix timestamp belongs to
+func (f *FileStore) BucketTS(timestamp int64) int64 {
+	sec := int64(f.bucketDuration / time.Second)
+	return timestamp / sec * sec
+}
 
+// BucketPath ... Returns the path of a bucket file, creating its directory
+func (f *FileStore) BucketPath(bucketTS int64, kind, prefix, ext string) (string, error) {
 	t := time.Unix(bucketTS, 0).UTC()
 
+	dir := filepath.Join(f.dirname, f.layout.Dir(t, kind, prefix))
+	err := os.MkdirAll(dir, os.FileMode(0755))
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, f.getFilename(prefix, bucketTS, ext)), nil
+}
+
+// OnBucketClose ... Registers a callback invoked when the cleaner closes the bucket
+func (f *FileStore) OnBucketClose(bucketTS int64, fn func() error) {
+	f.filesLock.Lock()
+	defer f.filesLock.Unlock()
+	f.closers[bucketTS] = append(f.closers[bucketTS], fn)
+}
+
+func (f *FileStore) GetCSVFile(timestamp int64) (*OutFiles, error) {
+	bucketTS := f.BucketTS(timestamp)
+
+	if f.eventTime {
+		f.advance(timestamp)
+	}
+
 	f.filesLock.RLock()
 	files, ok := f.files[bucketTS]
 	f.filesLock.RUnlock()
@@ -53,48 +301,192 @@ func (f *FileStore) GetCSVFile(timestamp int64) (*OutFiles, error) {
 		return files, nil
 	}
 
-	dir := filepath.Join(f.dirname, t.Format(time.DateOnly), "transactions")
-	err := os.MkdirAll(dir, os.FileMode(0755))
+	f.filesLock.Lock()
+	defer f.filesLock.Unlock()
+
+	for {
+		if f.closed {
+			return nil, ErrStoreClosed
+		}
+
+		// bucket could have been opened while waiting for the lock
+		if files, ok = f.files[bucketTS]; ok {
+			return files, nil
+		}
+
+		// a late write must not reopen a file the cleaner is about to remove
+		sealed, ok := f.sealing[bucketTS]
+		if !ok {
+			break
+		}
+
+		f.filesLock.Unlock()
+		<-sealed
+		f.filesLock.Lock()
+	}
+
+	outFiles := &OutFiles{
+		open: func(prefix string) (*BucketFile, error) {
+			return f.openKind(bucketTS, prefix)
+		},
+		files: make(map[string]*BucketFile),
+	}
+
+	f.files[bucketTS] = outFiles
+
+	return outFiles, nil
+}
+
+// openKind ... Opens the bucket file of the kind named by its prefix
+func (f *FileStore) openKind(bucketTS int64, prefix string) (*BucketFile, error) {
+	kind, ok := bucketKinds[prefix]
+	if !ok {
+		return nil, fmt.Errorf("unknown bucket kind %s", prefix)
+	}
+
+	header := ""
+	if kind.header != nil {
+		header = kind.header()
+	}
+	return f.openBucketFile(bucketTS, kind.dir, prefix, header)
+}
+
+// openBucketFile ... Opens the bucket file for appending and writes the
+// header to a new file. A row cut short by a crash is removed first. A file
+// left by a previous run with another header, e.g. an older schema version,
+// is kept and the rows go to a file suffixed with the schema version instead
+func (f *FileStore) openBucketFile(bucketTS int64, kind, prefix, header string) (*BucketFile, error) {
+	p, err := f.BucketPath(bucketTS, kind, prefix, csvExt)
 	if err != nil {
 		return nil, err
 	}
 
-	p := filepath.Join(dir, f.getFilename("txs", bucketTS))
-	ftxs, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
-	if err != nil {
+	if header != "" {
+		if p, err = headerPath(p, header); err != nil {
+			return nil, err
+		}
+	}
+
+	if n, err := repairTail(p); err != nil {
 		return nil, err
+	} else if n > 0 {
+		logging.NoContext().Warn("Removed truncated row from bucket",
+			zap.String("file", p), zap.Int64("bytes", n))
 	}
 
-	dir = filepath.Join(f.dirname, t.Format(time.DateOnly), "sourcelog")
-	err = os.MkdirAll(dir, os.FileMode(0755))
+	file, err := os.OpenFile(filepath.Clean(p), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
 	if err != nil {
 		return nil, err
 	}
 
-	p = filepath.Join(dir, f.getFilename("src", bucketTS))
-	fsourcelog, err := os.OpenFile(p, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if header == "" {
+		return newBucketFile(file, f.syncRows), nil
+	}
+
+	info, err := file.Stat()
 	if err != nil {
+		_ = file.Close()
 		return nil, err
 	}
 
-	outFiles := &OutFiles{
-		FTxs:       ftxs,
-		FSourcelog: fsourcelog,
+	if info.Size() == 0 {
+		if _, err := file.WriteString(header); err != nil {
+			_ = file.Close()
+			return nil, err
+		}
 	}
 
-	f.filesLock.Lock()
-	f.files[bucketTS] = outFiles
-	f.filesLock.Unlock()
+	return newBucketFile(file, f.syncRows), nil
+}
+
+// headerPath ... First of path and its versioned variants that is missing,
+// empty or starts with header
+func headerPath(path, header string) (string, error) {
+	base := strings.TrimSuffix(path, csvExt)
+
+	tag := "h"
+	if line, _, _ := strings.Cut(header, "\n"); strings.HasPrefix(line, schemaMarker) {
+		_, tag, _ = strings.Cut(line, "/")
+	}
+
+	for n := 0; ; n++ {
+		candidate := path
+		switch {
+		case n == 1:
+			candidate = fmt.Sprintf("%s-%s%s", base, tag, csvExt)
+		case n > 1:
+			candidate = fmt.Sprintf("%s-%s-%d%s", base, tag, n-1, csvExt)
+		}
+
+		// sealed files of rotated buckets share the numbered names
+		sealed, err := isSealed(candidate)
+		if err != nil {
+			return "", err
+		}
+		if sealed {
+			continue
+		}
+
+		ok, err := hasHeader(candidate, header)
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return candidate, nil
+		}
 
-	return outFiles, err
+		logging.NoContext().Warn("Bucket file has another header, rotating",
+			zap.String("file", candidate))
+	}
 }
 
-func (f *FileStore) GetTx(key string) (time.Time, error) {
-	defer f.knownTxsLock.RUnlock()
+// hasHeader ... Whether the file is missing, empty or starts with header
+func hasHeader(path, header string) (bool, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	defer file.Close()
+
+	buf := make([]byte, len(header))
+	n, err := io.ReadFull(file, buf)
+	if n == 0 && errors.Is(err, io.EOF) {
+		return true, nil
+	}
+	if err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return false, err
+	}
+
+	return string(buf[:n]) == header, nil
+}
+
+func txsHeader() string {
+	return fmt.Sprintf("%s%s/v%d\n%s\n", schemaMarker, TxsPrefix, TxsSchemaVersion, strings.Join(TxsColumns, ","))
+}
+
+func logsHeader() string {
+	return fmt.Sprintf("%s%s/v%d\n%s\n", schemaMarker, LogsPrefix, LogsSchemaVersion, strings.Join(LogsColumns, ","))
+}
 
-	f.knownTxsLock.RLock()
+func inclusionsHeader() string {
+	return fmt.Sprintf("%s%s/v%d\n%s\n", schemaMarker, InclusionsPrefix, InclusionsSchemaVersion,
+		strings.Join(InclusionsColumns, ","))
+}
+
+func replacementsHeader() string {
+	return fmt.Sprintf("%s%s/v%d\n%s\n", schemaMarker, ReplacementsPrefix, ReplacementsSchemaVersion,
+		strings.Join(ReplacementsColumns, ","))
+}
+
+func (f *FileStore) GetTx(key string) (time.Time, error) {
+	val, exists, err := f.knownTxs.Get(key)
+	if err != nil {
+		return time.Time{}, err
+	}
 
-	val, exists := f.knownTxs[key]
 	if !exists {
 		return time.Time{}, fmt.Errorf(notFoundError, key)
 	}
@@ -103,50 +495,233 @@ func (f *FileStore) GetTx(key string) (time.Time, error) {
 }
 
 func (f *FileStore) SetTx(key string, value time.Time) (time.Time, error) {
-	f.knownTxsLock.Lock()
-	defer f.knownTxsLock.Unlock()
-	f.knownTxs[key] = value
+	if err := f.knownTxs.Set(key, value); err != nil {
+		return time.Time{}, err
+	}
 	return value, nil
 }
 
-func (f *FileStore) getFilename(prefix string, timestamp int64) string {
+// Close ... Stops the cleaner and waits for its pass in progress, then
+// flushes and closes the open buckets and closes the dedup index. Open
+// buckets stay plain and the next run appends to them, unless the store runs
+// on event time and seals them right away
+func (f *FileStore) Close() error {
+	f.filesLock.Lock()
+	if f.closed {
+		f.filesLock.Unlock()
+		return ErrStoreClosed
+	}
+	f.closed = true
+	f.filesLock.Unlock()
+
+	close(f.done)
+	f.cleaner.Wait()
+
+	f.filesLock.Lock()
+	defer f.filesLock.Unlock()
+
+	var (
+		errs   []error
+		closed []string
+	)
+	for ts, files := range f.files {
+		delete(f.files, ts)
+		for _, file := range files.detach() {
+			errs = append(errs, file.Close())
+			closed = append(closed, file.Name())
+		}
+	}
+
+	if f.eventTime {
+		f.sealFiles(closed)
+	}
+
+	return errors.Join(append(errs, f.knownTxs.Close())...)
+}
+
+// advance ... Moves the event time watermark forward to timestamp
+func (f *FileStore) advance(timestamp int64) {
+	for {
+		current := f.watermark.Load()
+		if timestamp <= current || f.watermark.CompareAndSwap(current, timestamp) {
+			return
+		}
+	}
+}
+
+// now ... Current time of the store, the watermark when running on event time
+func (f *FileStore) now() time.Time {
+	if f.eventTime {
+		return time.Unix(f.watermark.Load(), 0).UTC()
+	}
+	return time.Now().UTC()
+}
+
+// SyncAll ... Commits the buffered rows of every open bucket to disk
+func (f *FileStore) SyncAll() error {
+	f.filesLock.RLock()
+	defer f.filesLock.RUnlock()
+
+	var errs []error
+	for _, files := range f.files {
+		for _, file := range files.all() {
+			errs = append(errs, file.Sync())
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (f *FileStore) getFilename(prefix string, timestamp int64, ext string) string {
 	t := time.Unix(timestamp, 0).UTC()
 	if prefix != "" {
 		prefix += "_"
 	}
-	return fmt.Sprintf("%s%s_%s.csv", prefix, t.Format("2020-01-01_12-01"), f.uid)
+	return fmt.Sprintf("%s%s_%s%s", prefix, t.Format(filenameTimeLayout), f.uid, ext)
 }
 
 func (f *FileStore) Cleaner() {
-	for {
-		time.Sleep(time.Minute)
+	// registered under the lock so Close either waits for it or it never runs
+	f.filesLock.Lock()
+	if f.closed {
+		f.filesLock.Unlock()
+		return
+	}
+	f.cleaner.Add(1)
+	f.filesLock.Unlock()
+	defer f.cleaner.Done()
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
 
-		f.knownTxsLock.Lock()
+	var syncTick <-chan time.Time
+	if f.syncInterval > 0 {
+		syncTicker := time.NewTicker(f.syncInterval)
+		defer syncTicker.Stop()
+		syncTick = syncTicker.C
+	}
 
-		for k, v := range f.knownTxs {
-			if time.Since(v) > core.TXCacheTime {
-				delete(f.knownTxs, k)
+	f.sealLeftovers()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-syncTick:
+			if err := f.SyncAll(); err != nil {
+				logging.NoContext().Error("Failed to sync buckets", zap.Error(err))
 			}
+			continue
+		case <-f.done:
+			return
+		}
+
+		now := f.now()
+
+		if err := f.knownTxs.Expire(now.Add(-core.TXCacheTime)); err != nil {
+			logging.NoContext().Error("Failed to expire known txs", zap.Error(err))
 		}
 
-		f.knownTxsLock.Unlock()
+		usageSec := int64(f.bucketDuration / time.Second * 2)
+
+		closed := make(map[int64][]string)
 
 		f.filesLock.Lock()
 		for ts, files := range f.files {
-			usageSec := core.BucketMinutes * 60 * 2
-			if time.Now().UTC().Unix()-ts > int64(usageSec) {
+			if now.Unix()-ts > usageSec {
 				delete(f.files, ts)
-				_ = files.FTxs.Close()
-				_ = files.FSourcelog.Close()
+				for _, file := range files.detach() {
+					if err := file.Close(); err != nil {
+						logging.NoContext().Error("Failed to close bucket file",
+							zap.String("file", file.Name()), zap.Error(err))
+					}
+					closed[ts] = append(closed[ts], file.Name())
+				}
+				f.sealing[ts] = make(chan struct{})
+			}
+		}
+
+		var closers []func() error
+		for ts, fns := range f.closers {
+			if now.Unix()-ts > usageSec {
+				delete(f.closers, ts)
+				closers = append(closers, fns...)
 			}
 		}
 		f.filesLock.Unlock()
 
+		for _, fn := range closers {
+			if err := fn(); err != nil {
+				logging.NoContext().Error("Failed to close bucket", zap.Error(err))
+			}
+		}
+
+		for ts, paths := range closed {
+			f.sealFiles(paths)
+
+			f.filesLock.Lock()
+			close(f.sealing[ts])
+			delete(f.sealing, ts)
+			f.filesLock.Unlock()
+		}
+
 		var m runtime.MemStats
 		runtime.ReadMemStats(&m)
 	}
 }
 
+// sealFiles ... Seals closed bucket files, a failed file stays plain and is
+// retried by the next start
+func (f *FileStore) sealFiles(paths []string) {
+	for _, p := range paths {
+		if _, err := SealBucket(p, f.compression); err != nil {
+			logging.NoContext().Error("Failed to seal bucket",
+				zap.String("file", p), zap.Error(err))
+		}
+	}
+}
+
+// sealLeftovers ... Seals the plain bucket files left behind by a previous
+// run, e.g. after a crash or a restart before the cleaner closed them
+func (f *FileStore) sealLeftovers() {
+	cutoff := time.Now().Add(-f.bucketDuration * 2)
+
+	var paths []string
+	err := filepath.WalkDir(f.dirname, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, csvExt) {
+			return nil
+		}
+
+		// buckets sealed without compression keep the csv extension
+		if sealed, err := isSealed(p); err != nil || sealed {
+			return err
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if info.ModTime().Before(cutoff) {
+			paths = append(paths, p)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		logging.NoContext().Error("Failed to list bucket files", zap.Error(err))
+		return
+	}
+
+	for _, p := range paths {
+		if _, err := repairTail(p); err != nil {
+			logging.NoContext().Error("Failed to repair bucket", zap.String("file", p), zap.Error(err))
+		}
+	}
+
+	f.sealFiles(paths)
+}
+
 type Option = func(*FileStore)
 
 func WithID(uid core.UUID) Option {
@@ -160,3 +735,50 @@ func WithDirName(dirname string) Option {
 		f.dirname = dirname
 	}
 }
+
+// WithCompression ... Sets the codec used to seal closed buckets
+func WithCompression(c Compression) Option {
+	return func(f *FileStore) {
+		f.compression = c
+	}
+}
+
+// WithBucketDuration ... Sets the time span of a bucket, see CheckBucketDuration
+func WithBucketDuration(d time.Duration) Option {
+	return func(f *FileStore) {
+		f.bucketDuration = d
+	}
+}
+
+// WithLayout ... Sets the directory template of the bucket files
+func WithLayout(l *Layout) Option {
+	return func(f *FileStore) {
+		f.layout = l
+	}
+}
+
+// WithSync ... Sets how often open buckets are synced to disk, by interval
+// and by rows written to a file. Zero disables the trigger
+func WithSync(interval time.Duration, rows int) Option {
+	return func(f *FileStore) {
+		f.syncInterval = interval
+		f.syncRows = rows
+	}
+}
+
+// WithEventTime ... Closes buckets and expires dedup entries by the newest
+// written timestamp instead of the wall clock. Meant for writers of
+// historical data such as backfills and replays, whose buckets would
+// otherwise be closed and sealed right after opening. Close seals the
+// buckets still open
+func WithEventTime() Option {
+	return func(f *FileStore) {
+		f.eventTime = true
+	}
+}
+
+func WithTxCache(c TxCache) Option {
+	return func(f *FileStore) {
+		f.knownTxs = c
+	}
+}
@@ -0,0 +1,193 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func bucketFile(t *testing.T, files *OutFiles, prefix string) *BucketFile {
+	t.Helper()
+
+	files.Lock()
+	defer files.Unlock()
+
+	file, err := files.File(prefix)
+	require.NoError(t, err)
+	return file
+}
+
+func TestEventTimeStore(t *testing.T) {
+	store := NewFileStore(t.TempDir(), WithEventTime())
+
+	historical := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	files, err := store.GetCSVFile(historical.Unix())
+	require.NoError(t, err)
+
+	// the store clock follows the written rows, not the wall clock
+	require.Equal(t, historical, store.now())
+
+	_, err = store.GetCSVFile(historical.Add(-time.Hour).Unix())
+	require.NoError(t, err)
+	require.Equal(t, historical, store.now(), "older rows must not move the clock back")
+
+	txs := bucketFile(t, files, TxsPrefix)
+	_, err = txs.Write([]byte("row\n"))
+	require.NoError(t, err)
+
+	// buckets still open on close are sealed right away
+	require.NoError(t, store.Close())
+	require.NoFileExists(t, txs.Name())
+	_, err = ReadManifest(strings.TrimSuffix(txs.Name(), csvExt) + "-1" + csvExt + ManifestExt)
+	require.NoError(t, err)
+}
+
+func TestWallClockStore(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+	defer store.Close()
+
+	_, err := store.GetCSVFile(time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC).Unix())
+	require.NoError(t, err)
+	require.WithinDuration(t, time.Now(), store.now(), time.Minute)
+}
+
+func TestCloseStopsCleaner(t *testing.T) {
+	store := NewFileStore(t.TempDir(), WithSync(time.Millisecond, 0))
+
+	exited := make(chan struct{})
+	go func() {
+		store.Cleaner()
+		close(exited)
+	}()
+
+	ts := time.Now().Unix()
+	files, err := store.GetCSVFile(ts)
+	require.NoError(t, err)
+	_, err = bucketFile(t, files, TxsPrefix).Write([]byte("row\n"))
+	require.NoError(t, err)
+
+	// let the cleaner sync the open bucket a few times
+	time.Sleep(5 * time.Millisecond)
+
+	require.NoError(t, store.Close())
+	select {
+	case <-exited:
+	default:
+		t.Fatal("close returned while the cleaner was still running")
+	}
+
+	_, err = store.GetCSVFile(ts)
+	require.ErrorIs(t, err, ErrStoreClosed)
+	require.ErrorIs(t, store.Close(), ErrStoreClosed)
+
+	// a cleaner started after close returns right away
+	store.Cleaner()
+}
+
+func TestHeaderPath(t *testing.T) {
+	header := "#schema=txs/v2\na,b,c\n"
+
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{name: "new file", want: "b.csv"},
+		{name: "empty file", files: map[string]string{"b.csv": ""}, want: "b.csv"},
+		{name: "same header", files: map[string]string{"b.csv": header + "1,2,3\n"}, want: "b.csv"},
+		{name: "older version rotates", files: map[string]string{"b.csv": "a,b\n1,2\n"}, want: "b-v2.csv"},
+		{
+			name:  "rotated file is reused",
+			files: map[string]string{"b.csv": "a,b\n1,2\n", "b-v2.csv": header},
+			want:  "b-v2.csv",
+		},
+		{
+			name:  "rotated file with another header",
+			files: map[string]string{"b.csv": "a,b\n", "b-v2.csv": "#schema=txs/v3\n"},
+			want:  "b-v2-1.csv",
+		},
+		{name: "truncated header", files: map[string]string{"b.csv": "#schema=tx"}, want: "b-v2.csv"},
+		{
+			name: "sealed files are skipped",
+			files: map[string]string{
+				"b.csv":                    "a,b\n",
+				"b-v2.csv":                 "#schema=txs/v3\n",
+				"b-v2-1.csv":               header,
+				"b-v2-1.csv" + ManifestExt: "{}",
+			},
+			want: "b-v2-2.csv",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, content := range tt.files {
+				require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o600))
+			}
+
+			got, err := headerPath(filepath.Join(dir, "b.csv"), header)
+			require.NoError(t, err)
+			require.Equal(t, filepath.Join(dir, tt.want), got)
+		})
+	}
+}
+
+func TestOpenBucketFileRotatesOldSchema(t *testing.T) {
+	store := NewFileStore(t.TempDir())
+	defer store.Close()
+
+	ts := time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC).Unix()
+	path, err := store.BucketPath(store.BucketTS(ts), "transactions", TxsPrefix, csvExt)
+	require.NoError(t, err)
+	v1 := "timestamp,hash,rlp\n1,0x01,0x02\n"
+	require.NoError(t, os.WriteFile(path, []byte(v1), 0o600))
+
+	files, err := store.GetCSVFile(ts)
+	require.NoError(t, err)
+	require.Equal(t, strings.TrimSuffix(path, csvExt)+"-v2"+csvExt, bucketFile(t, files, TxsPrefix).Name())
+
+	// the old file is left untouched
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, v1, string(content))
+}
+
+func TestBucketFilesOpenLazily(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileStore(dir)
+	defer store.Close()
+
+	ts := time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC).Unix()
+	files, err := store.GetCSVFile(ts)
+	require.NoError(t, err)
+
+	logs := bucketFile(t, files, LogsPrefix)
+	require.Same(t, logs, bucketFile(t, files, LogsPrefix))
+
+	// only the kinds written to exist on disk
+	var names []string
+	require.NoError(t, filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			names = append(names, filepath.Base(path))
+		}
+		return err
+	}))
+	require.Equal(t, []string{filepath.Base(logs.Name())}, names)
+
+	files.Lock()
+	_, err = files.File("nope")
+	files.Unlock()
+	require.Error(t, err)
+
+	// a detached bucket opens no more files
+	require.Len(t, files.detach(), 1)
+	files.Lock()
+	_, err = files.File(TxsPrefix)
+	files.Unlock()
+	require.ErrorIs(t, err, os.ErrClosed)
+}
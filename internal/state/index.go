@@ -0,0 +1,169 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+)
+
+const (
+	indexCleanInterval = time.Minute
+)
+
+// SourceSighting ... First time a single source of a pipeline delivered a tx
+type SourceSighting struct {
+	Pipeline string
+	Source   string
+	SeenAt   time.Time
+}
+
+// IndexedTx ... Recently recorded tx held in memory for lookups. Tx is nil
+// until the tx itself has been recorded
+type IndexedTx struct {
+	Hash      common.Hash
+	FirstSeen time.Time
+	Sources   []SourceSighting
+	Sender    common.Address
+	Tx        *types.Transaction
+}
+
+// TxIndex ... In-memory index of the txs recorded within the ttl, shared by
+// all pipelines of the app and queried by the api. A tx has a single entry,
+// its sightings tell the pipelines apart
+type TxIndex struct {
+	ttl time.Duration
+
+	txs  map[common.Hash]*IndexedTx
+	lock sync.RWMutex
+}
+
+func NewTxIndex(ttl time.Duration) *TxIndex {
+	return &TxIndex{
+		ttl: ttl,
+		txs: make(map[common.Hash]*IndexedTx),
+	}
+}
+
+// WithIndex ... Returns a copy of ctx carrying the index
+func WithIndex(ctx context.Context, idx *TxIndex) context.Context {
+	return context.WithValue(ctx, core.State, idx)
+}
+
+func IndexFromContext(ctx context.Context) (*TxIndex, error) {
+	idx, ok := ctx.Value(core.State).(*TxIndex)
+	if !ok {
+		return nil, fmt.Errorf("failed to retrieve tx index from context")
+	}
+	return idx, nil
+}
+
+// AddSighting ... Records the first sighting of the tx by the source of the pipeline
+func (i *TxIndex) AddSighting(hash common.Hash, pipeline, source string, ts time.Time) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	i.sighting(hash, pipeline, source, ts)
+}
+
+// AddTx ... Attaches the tx recorded by the pipeline to its index entry
+func (i *TxIndex) AddTx(pipeline string, r *core.TxRecord) {
+	i.lock.Lock()
+	defer i.lock.Unlock()
+
+	e := i.sighting(r.Tx.Hash(), pipeline, r.Source, r.Timestamp)
+	e.Tx = r.Tx
+	e.Sender = r.Sender
+}
+
+// sighting ... Must be called with the lock held
+func (i *TxIndex) sighting(hash common.Hash, pipeline, source string, ts time.Time) *IndexedTx {
+	e, ok := i.txs[hash]
+	if !ok {
+		e = &IndexedTx{Hash: hash, FirstSeen: ts}
+		i.txs[hash] = e
+	}
+
+	if ts.Before(e.FirstSeen) {
+		e.FirstSeen = ts
+	}
+
+	for idx, s := range e.Sources {
+		if s.Pipeline != pipeline || s.Source != source {
+			continue
+		}
+		if ts.Before(s.SeenAt) {
+			e.Sources[idx].SeenAt = ts
+		}
+		return e
+	}
+
+	e.Sources = append(e.Sources, SourceSighting{Pipeline: pipeline, Source: source, SeenAt: ts})
+	return e
+}
+
+// Get ... Returns a copy of the index entry of the tx
+func (i *TxIndex) Get(hash common.Hash) (*IndexedTx, bool) {
+	i.lock.RLock()
+	defer i.lock.RUnlock()
+
+	e, ok := i.txs[hash]
+	if !ok {
+		return nil, false
+	}
+	return e.copy(), true
+}
+
+// Range ... Returns copies of the recorded txs first seen within [from, to],
+// ordered by first sighting
+func (i *TxIndex) Range(from, to time.Time) []*IndexedTx {
+	i.lock.RLock()
+	res := make([]*IndexedTx, 0)
+	for _, e := range i.txs {
+		if e.Tx == nil || e.FirstSeen.Before(from) || e.FirstSeen.After(to) {
+			continue
+		}
+		res = append(res, e.copy())
+	}
+	i.lock.RUnlock()
+
+	sort.Slice(res, func(a, b int) bool {
+		return res[a].FirstSeen.Before(res[b].FirstSeen)
+	})
+	return res
+}
+
+// Cleaner ... Drops entries older than the ttl until ctx is done
+func (i *TxIndex) Cleaner(ctx context.Context) {
+	ticker := time.NewTicker(indexCleanInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			cutoff := time.Now().UTC().Add(-i.ttl)
+
+			i.lock.Lock()
+			for hash, e := range i.txs {
+				if e.FirstSeen.Before(cutoff) {
+					delete(i.txs, hash)
+				}
+			}
+			i.lock.Unlock()
+
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (e *IndexedTx) copy() *IndexedTx {
+	c := *e
+	c.Sources = append([]SourceSighting(nil), e.Sources...)
+	return &c
+}
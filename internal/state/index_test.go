@@ -0,0 +1,41 @@
+package state
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxIndexSightings(t *testing.T) {
+	idx := NewTxIndex(time.Hour)
+	tx := types.NewTx(&types.LegacyTx{Nonce: 1, GasPrice: big.NewInt(1)})
+	at := time.Unix(1_700_000_000, 0)
+
+	idx.AddSighting(tx.Hash(), "pending", "geth", at.Add(2*time.Second))
+	// an earlier sighting of the same source moves its first sighting back
+	idx.AddSighting(tx.Hash(), "pending", "geth", at.Add(time.Second))
+	idx.AddSighting(tx.Hash(), "pending", "geth", at.Add(3*time.Second))
+	// the same source in another pipeline is a sighting of its own
+	idx.AddTx("blocks", &core.TxRecord{Timestamp: at, Source: "geth", Tx: tx})
+
+	e, ok := idx.Get(tx.Hash())
+	require.True(t, ok)
+	require.Equal(t, at, e.FirstSeen)
+	require.Equal(t, tx.Hash(), e.Tx.Hash())
+	require.Equal(t, []SourceSighting{
+		{Pipeline: "pending", Source: "geth", SeenAt: at.Add(time.Second)},
+		{Pipeline: "blocks", Source: "geth", SeenAt: at},
+	}, e.Sources)
+
+	// entries handed out are copies
+	e.Sources[0].Source = "changed"
+	e, _ = idx.Get(tx.Hash())
+	require.Equal(t, "geth", e.Sources[0].Source)
+
+	require.Len(t, idx.Range(at, at.Add(time.Second)), 1)
+	require.Empty(t, idx.Range(at.Add(time.Second), at.Add(time.Minute)))
+}
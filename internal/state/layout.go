@@ -0,0 +1,132 @@
+package state
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+)
+
+const (
+	MinBucketDuration = time.Minute
+	MaxBucketDuration = 24 * time.Hour
+
+	// filenameTimeLayout ... Bucket start as written in bucket filenames
+	filenameTimeLayout = "2006-01-02_15-04"
+)
+
+// Layout placeholders
+const (
+	ChainVar  = "chain"
+	KindVar   = "kind"
+	PrefixVar = "prefix"
+	DateVar   = "date"
+	YearVar   = "year"
+	MonthVar  = "month"
+	DayVar    = "day"
+	HourVar   = "hour"
+	MinuteVar = "minute"
+)
+
+var placeholderRe = regexp.MustCompile(`\{([^{}]*)\}`)
+
+// Layout ... Directory template of the bucket files relative to the data dir,
+// e.g. chain={chain}/date={date}/hour={hour}/{kind}. Placeholders are
+// replaced with the bucket start in UTC
+type Layout struct {
+	tmpl  string
+	chain string
+}
+
+// ParseLayout ... Validates the placeholders of a layout template, an empty
+// template falls back to core.DefaultBucketLayout. The chain name has to be a
+// single path element
+func ParseLayout(tmpl, chain string) (*Layout, error) {
+	if tmpl == "" {
+		tmpl = core.DefaultBucketLayout
+	}
+
+	if filepath.IsAbs(tmpl) {
+		return nil, fmt.Errorf("bucket layout %s must be relative to the data dir", tmpl)
+	}
+
+	for _, m := range placeholderRe.FindAllStringSubmatch(tmpl, -1) {
+		switch m[1] {
+		case ChainVar, KindVar, PrefixVar, DateVar, YearVar, MonthVar, DayVar, HourVar, MinuteVar:
+		default:
+			return nil, fmt.Errorf("unknown bucket layout placeholder %s", m[0])
+		}
+	}
+
+	for _, elem := range strings.Split(filepath.ToSlash(tmpl), "/") {
+		if elem == ".." {
+			return nil, fmt.Errorf("bucket layout %s must stay inside the data dir", tmpl)
+		}
+	}
+
+	if strings.Contains(tmpl, "{"+ChainVar+"}") {
+		if chain == "" {
+			return nil, fmt.Errorf("bucket layout %s requires a chain name", tmpl)
+		}
+		if chain == "." || chain == ".." || strings.ContainsAny(chain, `/\`) {
+			return nil, fmt.Errorf("invalid chain name %s, it must not contain path separators", chain)
+		}
+	}
+
+	return &Layout{tmpl: tmpl, chain: chain}, nil
+}
+
+// Dir ... Returns the directory of a bucket file relative to the data dir
+func (l *Layout) Dir(bucketStart time.Time, kind, prefix string) string {
+	t := bucketStart.UTC()
+
+	r := strings.NewReplacer(
+		"{"+ChainVar+"}", l.chain,
+		"{"+KindVar+"}", kind,
+		"{"+PrefixVar+"}", prefix,
+		"{"+DateVar+"}", t.Format(time.DateOnly),
+		"{"+YearVar+"}", t.Format("2006"),
+		"{"+MonthVar+"}", t.Format("01"),
+		"{"+DayVar+"}", t.Format("02"),
+		"{"+HourVar+"}", t.Format("15"),
+		"{"+MinuteVar+"}", t.Format("04"),
+	)
+
+	return filepath.FromSlash(r.Replace(l.tmpl))
+}
+
+func (l *Layout) String() string {
+	return l.tmpl
+}
+
+// CheckBucketDuration ... Buckets have to fit a day evenly so no bucket
+// spans two date partitions
+func CheckBucketDuration(d time.Duration) error {
+	if d < MinBucketDuration || d > MaxBucketDuration {
+		return fmt.Errorf("bucket duration %s must be between %s and %s", d, MinBucketDuration, MaxBucketDuration)
+	}
+
+	if d%time.Minute != 0 || MaxBucketDuration%d != 0 {
+		return fmt.Errorf("bucket duration %s must divide a day into whole minute buckets", d)
+	}
+
+	return nil
+}
+
+// bucketStart ... Parses the bucket start of a bucket filename, files written
+// with an unknown naming report false
+func bucketStart(name, prefix string) (time.Time, bool) {
+	rest := strings.TrimPrefix(name, prefix+"_")
+	if len(rest) < len(filenameTimeLayout) {
+		return time.Time{}, false
+	}
+
+	t, err := time.Parse(filenameTimeLayout, rest[:len(filenameTimeLayout)])
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
@@ -0,0 +1,96 @@
+package state
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLayout(t *testing.T) {
+	l, err := ParseLayout("", "")
+	require.NoError(t, err)
+	require.Equal(t, core.DefaultBucketLayout, l.String())
+
+	for _, tt := range []struct {
+		tmpl  string
+		chain string
+	}{
+		{tmpl: "chain={chain}/date={date}/hour={hour}/{kind}", chain: "mainnet"},
+		{tmpl: "{year}/{month}/{day}/{hour}-{minute}/{prefix}", chain: ""},
+		{tmpl: "{chain}/{kind}", chain: "op-mainnet.v2"},
+		// the chain name is only checked where it is used
+		{tmpl: "{date}/{kind}", chain: "../x"},
+	} {
+		_, err := ParseLayout(tt.tmpl, tt.chain)
+		require.NoError(t, err, tt.tmpl)
+	}
+
+	for _, tt := range []struct {
+		name  string
+		tmpl  string
+		chain string
+	}{
+		{name: "absolute", tmpl: "/data/{kind}"},
+		{name: "unknown placeholder", tmpl: "{date}/{network}/{kind}"},
+		{name: "parent dir", tmpl: "../{date}/{kind}"},
+		{name: "nested parent dir", tmpl: "{date}/../../{kind}"},
+		{name: "missing chain", tmpl: "{chain}/{kind}"},
+		{name: "chain escapes", tmpl: "{chain}/{kind}", chain: "../x"},
+		{name: "chain is parent", tmpl: "{chain}/{kind}", chain: ".."},
+		{name: "chain is current", tmpl: "{chain}/{kind}", chain: "."},
+		{name: "chain with slash", tmpl: "{chain}/{kind}", chain: "main/net"},
+		{name: "chain with backslash", tmpl: "{chain}/{kind}", chain: `main\net`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseLayout(tt.tmpl, tt.chain)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestLayoutDir(t *testing.T) {
+	start := time.Date(2024, 3, 7, 9, 30, 0, 0, time.FixedZone("CET", 3600))
+
+	tests := []struct {
+		tmpl string
+		dir  string
+	}{
+		{tmpl: core.DefaultBucketLayout, dir: "2024-03-07/transactions"},
+		{tmpl: "chain={chain}/date={date}/hour={hour}/{kind}", dir: "chain=mainnet/date=2024-03-07/hour=08/transactions"},
+		{tmpl: "{year}/{month}/{day}/{hour}{minute}/{prefix}", dir: "2024/03/07/0830/txs"},
+	}
+
+	for _, tt := range tests {
+		l, err := ParseLayout(tt.tmpl, "mainnet")
+		require.NoError(t, err)
+		require.Equal(t, filepath.FromSlash(tt.dir), l.Dir(start, "transactions", TxsPrefix), tt.tmpl)
+	}
+}
+
+func TestCheckBucketDuration(t *testing.T) {
+	for _, d := range []time.Duration{
+		time.Minute,
+		5 * time.Minute,
+		90 * time.Minute,
+		time.Hour,
+		8 * time.Hour,
+		24 * time.Hour,
+	} {
+		require.NoError(t, CheckBucketDuration(d), d.String())
+	}
+
+	for _, d := range []time.Duration{
+		0,
+		-time.Hour,
+		30 * time.Second,
+		90 * time.Second,
+		7 * time.Minute,
+		5 * time.Hour,
+		48 * time.Hour,
+	} {
+		require.Error(t, CheckBucketDuration(d), d.String())
+	}
+}
@@ -0,0 +1,137 @@
+package state
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RowFunc ... Callback invoked for every bucket row within the requested time range
+type RowFunc = func(ts time.Time, cols []string) error
+
+// BucketFiles ... Returns all plain and sealed bucket files with the given prefix
+// under dirname, skipping date directories that fall outside of [from, to]
+func BucketFiles(dirname, prefix string, from, to time.Time) ([]string, error) {
+	fromDay := from.UTC().Truncate(24 * time.Hour)
+	toDay := to.UTC().Truncate(24 * time.Hour)
+
+	var files []string
+	err := filepath.WalkDir(dirname, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() {
+			// date directories of hive style layouts are named date=<day>
+			name := d.Name()
+			if i := strings.IndexByte(name, '='); i >= 0 {
+				name = name[i+1:]
+			}
+
+			day, parseErr := time.Parse(time.DateOnly, name)
+			if parseErr == nil && (day.Before(fromDay) || day.After(toDay)) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		name := d.Name()
+		if !strings.HasPrefix(name, prefix+"_") || !isBucketFile(name) {
+			return nil
+		}
+
+		if start, ok := bucketStart(name, prefix); ok && start.After(to) {
+			return nil
+		}
+
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// layouts such as {day}/{month} do not sort by time, the bucket start does.
+	// Files without a parsable start come first
+	sort.Slice(files, func(i, j int) bool {
+		ti, okI := bucketStart(filepath.Base(files[i]), prefix)
+		tj, okJ := bucketStart(filepath.Base(files[j]), prefix)
+		if okI != okJ {
+			return okJ
+		}
+		if !ti.Equal(tj) {
+			return ti.Before(tj)
+		}
+		return files[i] < files[j]
+	})
+	return files, nil
+}
+
+// WalkRows ... Iterates over every row of the bucket files with the given prefix
+// whose leading millisecond timestamp is within [from, to]
+func WalkRows(dirname, prefix string, from, to time.Time, fn RowFunc) error {
+	files, err := BucketFiles(dirname, prefix, from, to)
+	if err != nil {
+		return err
+	}
+
+	for _, path := range files {
+		if err := WalkFile(path, from, to, fn); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WalkFile ... Iterates over the rows of a single bucket file whose leading
+// millisecond timestamp is within [from, to]. Sealed buckets are decompressed,
+// cols is reused between rows
+func WalkFile(path string, from, to time.Time, fn RowFunc) error {
+	f, err := openBucket(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+	// schema version lines are comments, header rows fail the timestamp parse below
+	r.Comment = '#'
+
+	for {
+		cols, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			// partially written rows are skipped
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		ms, err := strconv.ParseInt(cols[0], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		ts := time.UnixMilli(ms).UTC()
+		if ts.Before(from) || ts.After(to) {
+			continue
+		}
+
+		if err := fn(ts, cols); err != nil {
+			return err
+		}
+	}
+}
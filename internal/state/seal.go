@@ -0,0 +1,342 @@
+package state
+
+import (
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Compression ... Codec of sealed buckets
+type Compression string
+
+const (
+	NoCompression Compression = "none"
+	Gzip          Compression = "gzip"
+	Zstd          Compression = "zstd"
+
+	gzipExt = ".gz"
+	zstdExt = ".zst"
+	// ManifestExt ... Appended to the sealed file name to get its manifest
+	ManifestExt = ".manifest.json"
+	// MarkerExt ... Appended to a sealed file name once it is uploaded. The
+	// marker outlives the uploaded file, its name is never sealed again
+	MarkerExt = ".uploaded"
+
+	hashHexLen = 66
+)
+
+func ParseCompression(val string) (Compression, error) {
+	switch c := Compression(strings.ToLower(val)); c {
+	case NoCompression, Gzip, Zstd:
+		return c, nil
+	}
+	return "", fmt.Errorf("unknown bucket compression %s", val)
+}
+
+// Ext ... Extension appended to the csv extension of sealed buckets
+func (c Compression) Ext() string {
+	switch c {
+	case Gzip:
+		return gzipExt
+	case Zstd:
+		return zstdExt
+	}
+	return ""
+}
+
+// Manifest ... Summary of a sealed bucket file, written next to it
+type Manifest struct {
+	File        string      `json:"file"`
+	Compression Compression `json:"compression"`
+	Rows        int         `json:"rows"`
+	// FirstTimestamp and LastTimestamp are unix milliseconds, zero without rows
+	FirstTimestamp int64 `json:"first_timestamp"`
+	LastTimestamp  int64 `json:"last_timestamp"`
+	// MinHash and MaxHash cover the hash column, empty when the bucket has none
+	MinHash string `json:"min_hash,omitempty"`
+	MaxHash string `json:"max_hash,omitempty"`
+	// SHA256 is the checksum of the sealed file as stored on disk
+	SHA256   string    `json:"sha256"`
+	SealedAt time.Time `json:"sealed_at"`
+}
+
+// SealBucket ... Moves a closed bucket file to an immutable sealed file, next
+// to its manifest. The sealed file is compressed, or renamed without
+// compression, so rows written to the bucket later go to a new plain file
+func SealBucket(path string, c Compression) (*Manifest, error) {
+	target, err := sealedPath(path, c)
+	if err != nil {
+		return nil, err
+	}
+
+	src, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+
+	m := &Manifest{File: filepath.Base(target), Compression: c}
+	sum := sha256.New()
+
+	if c == NoCompression {
+		if err := m.scan(io.TeeReader(src, sum)); err != nil {
+			return nil, err
+		}
+	} else if err := compressTo(target, src, c, m, sum); err != nil {
+		return nil, err
+	}
+
+	m.SHA256 = hex.EncodeToString(sum.Sum(nil))
+	m.SealedAt = time.Now().UTC()
+
+	if err := writeManifest(target+ManifestExt, m); err != nil {
+		return nil, err
+	}
+
+	if c == NoCompression {
+		// the manifest comes first, a seal cut short keeps the plain file and
+		// the next try seals it under the same name
+		_ = src.Close()
+		if err := os.Rename(path, target); err != nil {
+			return nil, err
+		}
+		return m, nil
+	}
+
+	if err := os.Remove(path); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// compressTo ... Writes the compressed copy of src to target through a
+// temporary file, so readers never see a partial sealed bucket
+func compressTo(target string, src io.Reader, c Compression, m *Manifest, sum io.Writer) error {
+	tmp := target + ".tmp"
+
+	dst, err := os.OpenFile(filepath.Clean(tmp), os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+
+	err = func() error {
+		w, err := newCompressor(io.MultiWriter(dst, sum), c)
+		if err != nil {
+			return err
+		}
+
+		if err := m.scan(io.TeeReader(src, w)); err != nil {
+			_ = w.Close()
+			return err
+		}
+
+		if err := w.Close(); err != nil {
+			return err
+		}
+		return dst.Sync()
+	}()
+
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	return os.Rename(tmp, target)
+}
+
+// scan ... Reads r to the end while collecting the manifest stats
+func (m *Manifest) scan(r io.Reader) error {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+	cr.Comment = '#'
+
+	for {
+		cols, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		ms, err := strconv.ParseInt(cols[0], 10, 64)
+		if err != nil {
+			// header row
+			continue
+		}
+
+		m.Rows++
+		if m.FirstTimestamp == 0 || ms < m.FirstTimestamp {
+			m.FirstTimestamp = ms
+		}
+		if ms > m.LastTimestamp {
+			m.LastTimestamp = ms
+		}
+
+		if len(cols) > 1 && len(cols[1]) == hashHexLen && strings.HasPrefix(cols[1], "0x") {
+			if m.MinHash == "" || cols[1] < m.MinHash {
+				m.MinHash = cols[1]
+			}
+			if cols[1] > m.MaxHash {
+				m.MaxHash = cols[1]
+			}
+		}
+	}
+
+	// a malformed tail still belongs to the sealed copy
+	_, err := io.Copy(io.Discard, r)
+	return err
+}
+
+// ReadManifest ... Loads the manifest written next to a sealed bucket
+func ReadManifest(path string) (*Manifest, error) {
+	raw, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Manifest{}
+	if err := json.Unmarshal(raw, m); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	return m, nil
+}
+
+func writeManifest(path string, m *Manifest) error {
+	raw, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(filepath.Clean(tmp), raw, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// sealedPath ... Returns a free sealed file name, never path itself. A bucket
+// written again after it got sealed, e.g. after a restart, is sealed under a
+// numbered name. Names whose file was uploaded and removed stay taken
+func sealedPath(path string, c Compression) (string, error) {
+	base := strings.TrimSuffix(path, csvExt)
+
+	for n := 0; ; n++ {
+		candidate := base + csvExt + c.Ext()
+		if n > 0 {
+			candidate = fmt.Sprintf("%s-%d%s%s", base, n, csvExt, c.Ext())
+		}
+
+		taken, err := exists(candidate, candidate+MarkerExt)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return candidate, nil
+		}
+	}
+}
+
+// isSealed ... Reports whether path is a sealed bucket file
+func isSealed(path string) (bool, error) {
+	return exists(path + ManifestExt)
+}
+
+// exists ... Reports whether any of the paths exists
+func exists(paths ...string) (bool, error) {
+	for _, p := range paths {
+		_, err := os.Stat(p)
+		if err == nil {
+			return true, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+func newCompressor(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	}
+	return nil, fmt.Errorf("unknown bucket compression %s", c)
+}
+
+// isBucketFile ... Reports whether name is a plain or sealed csv bucket file
+func isBucketFile(name string) bool {
+	for _, ext := range []string{csvExt, csvExt + gzipExt, csvExt + zstdExt} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// openBucket ... Opens a bucket file, decompressing sealed buckets
+func openBucket(path string) (io.ReadCloser, error) {
+	f, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case strings.HasSuffix(path, gzipExt):
+		zr, err := gzip.NewReader(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		return &bucketReader{Reader: zr, closers: []func() error{zr.Close, f.Close}}, nil
+
+	case strings.HasSuffix(path, zstdExt):
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			_ = f.Close()
+			return nil, err
+		}
+		return &bucketReader{Reader: zr, closers: []func() error{
+			func() error { zr.Close(); return nil },
+			f.Close,
+		}}, nil
+	}
+
+	return f, nil
+}
+
+type bucketReader struct {
+	io.Reader
+	closers []func() error
+}
+
+func (r *bucketReader) Close() error {
+	var errs []error
+	for _, fn := range r.closers {
+		errs = append(errs, fn())
+	}
+	return errors.Join(errs...)
+}
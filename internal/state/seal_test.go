@@ -0,0 +1,240 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	sealHashLow  = "0x1111111111111111111111111111111111111111111111111111111111111111"
+	sealHashHigh = "0xffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff"
+)
+
+// sealContent ... Bucket with a schema marker, a header and rows out of
+// timestamp and hash order
+var sealContent = "#schema=txs/v2\ntimestamp,hash,rlp\n" +
+	"1700000002000," + sealHashHigh + ",0x02\n" +
+	"1700000001000," + sealHashLow + ",0x01\n" +
+	"1700000003000," + sealHashLow + ",0x03\n"
+
+func writeBucket(t *testing.T, dir, content string) string {
+	path := filepath.Join(dir, "txs_2023-11-14T22-00-00Z_test.csv")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func readBucket(t *testing.T, path string) string {
+	r, err := openBucket(path)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, r.Close()) }()
+
+	raw, err := io.ReadAll(r)
+	require.NoError(t, err)
+	return string(raw)
+}
+
+func fileSHA256(t *testing.T, path string) string {
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestSealBucketRoundTrip(t *testing.T) {
+	tests := []struct {
+		c    Compression
+		file string
+	}{
+		// the plain name stays free for the next rows of the bucket
+		{c: NoCompression, file: "txs_2023-11-14T22-00-00Z_test-1.csv"},
+		{c: Gzip, file: "txs_2023-11-14T22-00-00Z_test.csv.gz"},
+		{c: Zstd, file: "txs_2023-11-14T22-00-00Z_test.csv.zst"},
+	}
+
+	for _, tt := range tests {
+		c := tt.c
+		t.Run(string(c), func(t *testing.T) {
+			dir := t.TempDir()
+			path := writeBucket(t, dir, sealContent)
+
+			m, err := SealBucket(path, c)
+			require.NoError(t, err)
+
+			sealed := filepath.Join(dir, m.File)
+			require.Equal(t, tt.file, m.File)
+			require.True(t, isBucketFile(sealed))
+			require.NoFileExists(t, path)
+
+			require.Equal(t, sealContent, readBucket(t, sealed))
+
+			require.Equal(t, c, m.Compression)
+			require.Equal(t, 3, m.Rows)
+			require.Equal(t, int64(1700000001000), m.FirstTimestamp)
+			require.Equal(t, int64(1700000003000), m.LastTimestamp)
+			require.Equal(t, sealHashLow, m.MinHash)
+			require.Equal(t, sealHashHigh, m.MaxHash)
+			require.Equal(t, fileSHA256(t, sealed), m.SHA256)
+
+			stored, err := ReadManifest(sealed + ManifestExt)
+			require.NoError(t, err)
+			require.True(t, m.SealedAt.Equal(stored.SealedAt))
+			stored.SealedAt = m.SealedAt
+			require.Equal(t, m, stored)
+		})
+	}
+}
+
+func TestSealBucketNumbersResealedBuckets(t *testing.T) {
+	dir := t.TempDir()
+
+	first, err := SealBucket(writeBucket(t, dir, sealContent), Gzip)
+	require.NoError(t, err)
+
+	// the bucket is written again after a restart
+	path := writeBucket(t, dir, "1700000004000,"+sealHashLow+",0x04\n")
+	second, err := SealBucket(path, Gzip)
+	require.NoError(t, err)
+
+	require.NotEqual(t, first.File, second.File)
+	require.Equal(t, "txs_2023-11-14T22-00-00Z_test-1.csv.gz", second.File)
+	require.Equal(t, 1, second.Rows)
+
+	require.Equal(t, sealContent, readBucket(t, filepath.Join(dir, first.File)))
+	require.Equal(t, "1700000004000,"+sealHashLow+",0x04\n", readBucket(t, filepath.Join(dir, second.File)))
+}
+
+func TestSealBucketSkipsUploadedNames(t *testing.T) {
+	dir := t.TempDir()
+
+	// the first seal was uploaded and removed locally
+	uploaded := filepath.Join(dir, "txs_2023-11-14T22-00-00Z_test.csv.gz")
+	require.NoError(t, os.WriteFile(uploaded+MarkerExt, []byte("key\n"), 0o600))
+
+	m, err := SealBucket(writeBucket(t, dir, sealContent), Gzip)
+	require.NoError(t, err)
+	require.Equal(t, "txs_2023-11-14T22-00-00Z_test-1.csv.gz", m.File)
+}
+
+func TestSealBucketResumesUnfinishedSeal(t *testing.T) {
+	dir := t.TempDir()
+	path := writeBucket(t, dir, sealContent)
+
+	// a seal without compression cut short after the manifest
+	sealed := filepath.Join(dir, "txs_2023-11-14T22-00-00Z_test-1.csv")
+	require.NoError(t, writeManifest(sealed+ManifestExt, &Manifest{File: filepath.Base(sealed)}))
+
+	m, err := SealBucket(path, NoCompression)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Base(sealed), m.File)
+	require.Equal(t, sealContent, readBucket(t, sealed))
+
+	stored, err := ReadManifest(sealed + ManifestExt)
+	require.NoError(t, err)
+	require.Equal(t, fileSHA256(t, sealed), stored.SHA256)
+}
+
+func TestSealedBucketIsNotReopened(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileStore(dir)
+	defer store.Close()
+
+	ts := time.Date(2024, 1, 2, 3, 4, 0, 0, time.UTC).Unix()
+
+	write := func(row string) string {
+		files, err := store.GetCSVFile(ts)
+		require.NoError(t, err)
+
+		file := bucketFile(t, files, SourcelogPrefix)
+		_, err = file.Write([]byte(row))
+		require.NoError(t, err)
+		return file.Name()
+	}
+
+	closeBucket := func() {
+		store.filesLock.Lock()
+		files := store.files[store.BucketTS(ts)]
+		delete(store.files, store.BucketTS(ts))
+		store.filesLock.Unlock()
+
+		for _, file := range files.detach() {
+			require.NoError(t, file.Close())
+		}
+	}
+
+	path := write("1,a\n")
+	closeBucket()
+	first, err := SealBucket(path, NoCompression)
+	require.NoError(t, err)
+
+	// rows written to the bucket after it got sealed go to a new file
+	require.Equal(t, path, write("2,b\n"))
+	closeBucket()
+	second, err := SealBucket(path, NoCompression)
+	require.NoError(t, err)
+
+	base := strings.TrimSuffix(filepath.Base(path), csvExt)
+	require.Equal(t, base+"-1"+csvExt, first.File)
+	require.Equal(t, base+"-2"+csvExt, second.File)
+
+	sealedDir := filepath.Dir(path)
+	require.Equal(t, "1,a\n", readBucket(t, filepath.Join(sealedDir, first.File)))
+	require.Equal(t, "2,b\n", readBucket(t, filepath.Join(sealedDir, second.File)))
+	require.Equal(t, fileSHA256(t, filepath.Join(sealedDir, first.File)), first.SHA256)
+}
+
+func TestSealLeftovers(t *testing.T) {
+	dir := t.TempDir()
+	store := NewFileStore(dir)
+	defer store.Close()
+
+	old := time.Now().Add(-3 * store.bucketDuration)
+
+	sealed, err := SealBucket(writeBucket(t, dir, "1,a\n"), NoCompression)
+	require.NoError(t, err)
+	sealedPath := filepath.Join(dir, sealed.File)
+	require.NoError(t, os.Chtimes(sealedPath, old, old))
+
+	// a plain file left behind by a crash, its last row cut short
+	leftover := writeBucket(t, dir, "2,b\n3,")
+	require.NoError(t, os.Chtimes(leftover, old, old))
+
+	store.sealLeftovers()
+
+	require.NoFileExists(t, leftover)
+	require.Equal(t, "1,a\n", readBucket(t, sealedPath))
+
+	resealed := filepath.Join(dir, "txs_2023-11-14T22-00-00Z_test-2.csv")
+	require.Equal(t, "2,b\n", readBucket(t, resealed))
+	require.FileExists(t, resealed+ManifestExt)
+}
+
+func TestSealBucketEmpty(t *testing.T) {
+	m, err := SealBucket(writeBucket(t, t.TempDir(), ""), Zstd)
+	require.NoError(t, err)
+
+	require.Zero(t, m.Rows)
+	require.Zero(t, m.FirstTimestamp)
+	require.Empty(t, m.MinHash)
+}
+
+func TestIsBucketFile(t *testing.T) {
+	for name, want := range map[string]bool{
+		"txs.csv":               true,
+		"txs.csv.gz":            true,
+		"txs.csv.zst":           true,
+		"txs-1.csv.gz":          true,
+		"txs.csv.manifest.json": false,
+		"txs.csv.gz.tmp":        false,
+		"txs.parquet":           false,
+	} {
+		require.Equal(t, want, isBucketFile(name), name)
+	}
+}
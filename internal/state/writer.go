@@ -0,0 +1,152 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	writeBufferSize = 64 * 1024
+	// repairChunkSize is the window read backwards while looking for the last row end
+	repairChunkSize = 4096
+)
+
+// BucketFile ... Buffered append only bucket file. The buffer is flushed
+// before a row that does not fit, so the file only ever holds whole rows
+// unless the process dies within a write
+type BucketFile struct {
+	mu   sync.Mutex
+	file *os.File
+	buf  *bufio.Writer
+
+	// syncRows is the number of rows after which the file is synced, zero disables it
+	syncRows int
+	// pending counts the rows written since the last sync
+	pending int
+	closed  bool
+}
+
+func newBucketFile(file *os.File, syncRows int) *BucketFile {
+	return &BucketFile{
+		file:     file,
+		buf:      bufio.NewWriterSize(file, writeBufferSize),
+		syncRows: syncRows,
+	}
+}
+
+// Write ... Buffers a single row, callers pass one complete row per call
+func (b *BucketFile) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return 0, os.ErrClosed
+	}
+
+	if len(p) > b.buf.Available() && b.buf.Buffered() > 0 {
+		if err := b.buf.Flush(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := b.buf.Write(p)
+	if err != nil {
+		return n, err
+	}
+
+	b.pending++
+	if b.syncRows > 0 && b.pending >= b.syncRows {
+		return n, b.sync()
+	}
+	return n, nil
+}
+
+// Sync ... Flushes the buffered rows and commits them to disk
+func (b *BucketFile) Sync() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed || b.pending == 0 {
+		return nil
+	}
+	return b.sync()
+}
+
+func (b *BucketFile) sync() error {
+	if err := b.buf.Flush(); err != nil {
+		return err
+	}
+	b.pending = 0
+	return b.file.Sync()
+}
+
+// Close ... Syncs the pending rows and closes the file
+func (b *BucketFile) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil
+	}
+	b.closed = true
+
+	return errors.Join(b.sync(), b.file.Close())
+}
+
+func (b *BucketFile) Name() string {
+	return b.file.Name()
+}
+
+// repairTail ... Cuts a partially written last row left by a crash. Returns
+// the number of bytes removed
+func repairTail(path string) (int64, error) {
+	file, err := os.OpenFile(filepath.Clean(path), os.O_RDWR, 0o600)
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, err
+	}
+
+	size := info.Size()
+	end := size
+	chunk := make([]byte, repairChunkSize)
+
+	for end > 0 {
+		start := end - repairChunkSize
+		if start < 0 {
+			start = 0
+		}
+
+		n, err := file.ReadAt(chunk[:end-start], start)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return 0, err
+		}
+
+		if i := bytes.LastIndexByte(chunk[:n], '\n'); i >= 0 {
+			end = start + int64(i) + 1
+			break
+		}
+		end = start
+	}
+
+	if end == size {
+		return 0, nil
+	}
+
+	if err := file.Truncate(end); err != nil {
+		return 0, err
+	}
+	return size - end, file.Sync()
+}
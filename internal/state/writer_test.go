@@ -0,0 +1,132 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRepairTail(t *testing.T) {
+	header := "#schema=txs/v2\ntimestamp,hash,rlp\n"
+	row := "1700000000000,0x01,0x02\n"
+	long := "1700000000000,0x01,0x" + strings.Repeat("ab", repairChunkSize) + "\n"
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{name: "empty", content: "", want: ""},
+		{name: "header only", content: header, want: header},
+		{name: "complete rows", content: header + row + row, want: header + row + row},
+		{name: "partial row", content: header + row + "1700000001000,0x0", want: header + row},
+		{name: "partial header", content: "#schema=txs/v2\ntimest", want: "#schema=txs/v2\n"},
+		{name: "single partial row", content: "1700000001000,0x0", want: ""},
+		{name: "complete long row", content: header + long, want: header + long},
+		{name: "partial long row", content: header + row + strings.TrimSuffix(long, "\n"), want: header + row},
+		{name: "only a partial long row", content: strings.TrimSuffix(long, "\n"), want: ""},
+		{
+			name:    "partial row after a long row",
+			content: header + long + strings.Repeat("f", repairChunkSize-1),
+			want:    header + long,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "bucket.csv")
+			require.NoError(t, os.WriteFile(path, []byte(tt.content), 0o600))
+
+			cut, err := repairTail(path)
+			require.NoError(t, err)
+			require.Equal(t, int64(len(tt.content)-len(tt.want)), cut)
+
+			raw, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, string(raw))
+		})
+	}
+
+	cut, err := repairTail(filepath.Join(t.TempDir(), "missing.csv"))
+	require.NoError(t, err)
+	require.Zero(t, cut)
+}
+
+func openTestBucketFile(t *testing.T, syncRows int) (*BucketFile, string) {
+	path := filepath.Join(t.TempDir(), "bucket.csv")
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	return newBucketFile(file, syncRows), path
+}
+
+func readFile(t *testing.T, path string) string {
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(raw)
+}
+
+func TestBucketFile(t *testing.T) {
+	t.Run("buffers until sync", func(t *testing.T) {
+		b, path := openTestBucketFile(t, 0)
+
+		_, err := b.Write([]byte("1,a\n"))
+		require.NoError(t, err)
+		require.Empty(t, readFile(t, path))
+
+		require.NoError(t, b.Sync())
+		require.Equal(t, "1,a\n", readFile(t, path))
+		require.NoError(t, b.Close())
+	})
+
+	t.Run("syncs after sync rows", func(t *testing.T) {
+		b, path := openTestBucketFile(t, 2)
+
+		_, err := b.Write([]byte("1,a\n"))
+		require.NoError(t, err)
+		require.Empty(t, readFile(t, path))
+
+		_, err = b.Write([]byte("2,b\n"))
+		require.NoError(t, err)
+		require.Equal(t, "1,a\n2,b\n", readFile(t, path))
+		require.NoError(t, b.Close())
+	})
+
+	t.Run("flushes whole rows only", func(t *testing.T) {
+		b, path := openTestBucketFile(t, 0)
+
+		row := strings.Repeat("r", writeBufferSize/3-1) + "\n"
+		for i := 0; i < 4; i++ {
+			_, err := b.Write([]byte(row))
+			require.NoError(t, err)
+
+			content := readFile(t, path)
+			require.Zero(t, len(content)%len(row))
+		}
+
+		// a row larger than the buffer is written as a whole
+		huge := strings.Repeat("h", 2*writeBufferSize) + "\n"
+		_, err := b.Write([]byte(huge))
+		require.NoError(t, err)
+		require.True(t, strings.HasSuffix(readFile(t, path), huge))
+
+		require.NoError(t, b.Close())
+		require.Equal(t, strings.Repeat(row, 4)+huge, readFile(t, path))
+	})
+
+	t.Run("refuses writes after close", func(t *testing.T) {
+		b, path := openTestBucketFile(t, 0)
+
+		_, err := b.Write([]byte("1,a\n"))
+		require.NoError(t, err)
+		require.NoError(t, b.Close())
+		require.Equal(t, "1,a\n", readFile(t, path))
+
+		_, err = b.Write([]byte("2,b\n"))
+		require.ErrorIs(t, err, os.ErrClosed)
+		require.NoError(t, b.Sync())
+		require.NoError(t, b.Close())
+	})
+}
@@ -0,0 +1,59 @@
+package stream
+
+import (
+	"bytes"
+	"math/big"
+	"slices"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Filter ... Server side criteria of a stream subscription. Empty fields match
+// every tx, list fields match any of their values
+type Filter struct {
+	From []common.Address
+	// To does not match contract creations
+	To        []common.Address
+	Selectors [][core.SelectorLength]byte
+	MinValue  *big.Int
+	Types     []uint8
+}
+
+func (f *Filter) Match(r *core.TxRecord) bool {
+	if f == nil {
+		return true
+	}
+
+	if len(f.From) > 0 && !slices.Contains(f.From, r.Sender) {
+		return false
+	}
+
+	if len(f.To) > 0 && (r.Tx.To() == nil || !slices.Contains(f.To, *r.Tx.To())) {
+		return false
+	}
+
+	if len(f.Selectors) > 0 {
+		data := r.Tx.Data()
+		if len(data) < core.SelectorLength {
+			return false
+		}
+
+		matched := slices.ContainsFunc(f.Selectors, func(sel [core.SelectorLength]byte) bool {
+			return bytes.Equal(sel[:], data[:core.SelectorLength])
+		})
+		if !matched {
+			return false
+		}
+	}
+
+	if f.MinValue != nil && r.Tx.Value().Cmp(f.MinValue) < 0 {
+		return false
+	}
+
+	if len(f.Types) > 0 && !slices.Contains(f.Types, r.Tx.Type()) {
+		return false
+	}
+
+	return true
+}
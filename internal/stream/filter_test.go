@@ -0,0 +1,71 @@
+package stream
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFilterMatch(t *testing.T) {
+	sender := common.HexToAddress("0x1000000000000000000000000000000000000001")
+	to := common.HexToAddress("0x2000000000000000000000000000000000000002")
+	other := common.HexToAddress("0x3000000000000000000000000000000000000003")
+	transfer := [core.SelectorLength]byte{0xa9, 0x05, 0x9c, 0xbb}
+
+	call := &core.TxRecord{
+		Sender: sender,
+		Tx: types.NewTx(&types.DynamicFeeTx{
+			To:    &to,
+			Value: big.NewInt(100),
+			Data:  append(transfer[:], 0x01, 0x02),
+		}),
+	}
+	creation := &core.TxRecord{
+		Sender: sender,
+		Tx:     types.NewTx(&types.LegacyTx{Value: big.NewInt(0), Data: []byte{0x60}}),
+	}
+
+	tests := []struct {
+		name   string
+		filter *Filter
+		record *core.TxRecord
+		want   bool
+	}{
+		{name: "nil filter matches everything", filter: nil, record: call, want: true},
+		{name: "empty filter matches everything", filter: &Filter{}, record: creation, want: true},
+		{name: "from matches any listed sender", filter: &Filter{From: []common.Address{other, sender}}, record: call,
+			want: true},
+		{name: "from rejects other senders", filter: &Filter{From: []common.Address{other}}, record: call, want: false},
+		{name: "to matches the recipient", filter: &Filter{To: []common.Address{to}}, record: call, want: true},
+		{name: "to rejects other recipients", filter: &Filter{To: []common.Address{other}}, record: call, want: false},
+		{name: "to never matches contract creations", filter: &Filter{To: []common.Address{to}}, record: creation,
+			want: false},
+		{name: "selector matches the calldata prefix",
+			filter: &Filter{Selectors: [][core.SelectorLength]byte{transfer}}, record: call, want: true},
+		{name: "selector rejects other calldata",
+			filter: &Filter{Selectors: [][core.SelectorLength]byte{{0x01, 0x02, 0x03, 0x04}}}, record: call,
+			want: false},
+		{name: "selector rejects calldata shorter than a selector",
+			filter: &Filter{Selectors: [][core.SelectorLength]byte{transfer}}, record: creation, want: false},
+		{name: "min value is inclusive", filter: &Filter{MinValue: big.NewInt(100)}, record: call, want: true},
+		{name: "min value rejects smaller values", filter: &Filter{MinValue: big.NewInt(101)}, record: call,
+			want: false},
+		{name: "types match the tx type", filter: &Filter{Types: []uint8{types.LegacyTxType}}, record: creation,
+			want: true},
+		{name: "types reject other tx types", filter: &Filter{Types: []uint8{types.LegacyTxType}}, record: call,
+			want: false},
+		{name: "every criterion must match",
+			filter: &Filter{From: []common.Address{sender}, To: []common.Address{to}, MinValue: big.NewInt(101)},
+			record: call, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, tt.filter.Match(tt.record))
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/metrics"
+)
+
+// DropPolicy ... What happens to a tx published to a client whose buffer is full
+type DropPolicy string
+
+const (
+	// DropOldest discards the oldest buffered tx to make room for the new one
+	DropOldest DropPolicy = "drop_oldest"
+	// DropNewest discards the new tx
+	DropNewest DropPolicy = "drop_newest"
+	// Disconnect closes the subscription of the client
+	Disconnect DropPolicy = "disconnect"
+)
+
+func ParseDropPolicy(val string) (DropPolicy, error) {
+	switch p := DropPolicy(strings.ToLower(val)); p {
+	case DropOldest, DropNewest, Disconnect:
+		return p, nil
+	}
+	return "", fmt.Errorf("unknown drop policy %s", val)
+}
+
+// Hub ... Fans the recorded txs out to the live stream subscribers. Publishing
+// never blocks, slow subscribers lose txs according to their drop policy. A
+// single hub is shared by all pipelines, subscribers see the txs of every one
+type Hub struct {
+	subs map[*Subscription]struct{}
+	lock sync.RWMutex
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subs: make(map[*Subscription]struct{}),
+	}
+}
+
+// WithHub ... Returns a copy of ctx carrying the hub
+func WithHub(ctx context.Context, h *Hub) context.Context {
+	return context.WithValue(ctx, core.Stream, h)
+}
+
+func HubFromContext(ctx context.Context) (*Hub, error) {
+	h, ok := ctx.Value(core.Stream).(*Hub)
+	if !ok {
+		return nil, fmt.Errorf("failed to retrieve stream hub from context")
+	}
+	return h, nil
+}
+
+// Subscribe ... Registers a subscriber with a buffer of the given size
+func (h *Hub) Subscribe(f *Filter, size int, policy DropPolicy) *Subscription {
+	s := &Subscription{
+		c:      make(chan *core.TxRecord, max(size, 1)),
+		done:   make(chan struct{}),
+		policy: policy,
+		hub:    h,
+	}
+	s.filter.Store(f)
+
+	h.lock.Lock()
+	h.subs[s] = struct{}{}
+	h.lock.Unlock()
+
+	metrics.StreamClients.Inc()
+	return s
+}
+
+// Publish ... Offers the tx to every subscriber whose filter matches
+func (h *Hub) Publish(r *core.TxRecord) {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	for s := range h.subs {
+		if s.filter.Load().Match(r) {
+			s.offer(r)
+		}
+	}
+}
+
+// Close ... Ends all subscriptions
+func (h *Hub) Close() {
+	h.lock.Lock()
+	subs := h.subs
+	h.subs = make(map[*Subscription]struct{})
+	h.lock.Unlock()
+
+	for s := range subs {
+		s.stop()
+	}
+}
+
+func (h *Hub) remove(s *Subscription) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	delete(h.subs, s)
+}
+
+// Subscription ... Bounded buffer of txs for a single client
+type Subscription struct {
+	c      chan *core.TxRecord
+	done   chan struct{}
+	once   sync.Once
+	policy DropPolicy
+	filter atomic.Pointer[Filter]
+
+	dropped atomic.Uint64
+	hub     *Hub
+}
+
+// C ... Delivers the matching txs. Never closed, select on Done as well
+func (s *Subscription) C() <-chan *core.TxRecord {
+	return s.c
+}
+
+// Done ... Closed once the subscription ended
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Dropped ... Number of txs not delivered because the buffer was full
+func (s *Subscription) Dropped() uint64 {
+	return s.dropped.Load()
+}
+
+// SetFilter ... Replaces the filter applied to txs published from now on
+func (s *Subscription) SetFilter(f *Filter) {
+	s.filter.Store(f)
+}
+
+// Close ... Ends the subscription
+func (s *Subscription) Close() {
+	s.hub.remove(s)
+	s.stop()
+}
+
+func (s *Subscription) stop() {
+	s.once.Do(func() {
+		close(s.done)
+		metrics.StreamClients.Dec()
+	})
+}
+
+func (s *Subscription) offer(r *core.TxRecord) {
+	select {
+	case <-s.done:
+		return
+	case s.c <- r:
+		return
+	default:
+	}
+
+	switch s.policy {
+	case Disconnect:
+		// removal from the hub is left to the client, the hub lock is held here
+		s.stop()
+
+	case DropOldest:
+		select {
+		case <-s.c:
+		default:
+		}
+
+		select {
+		case s.c <- r:
+		default:
+		}
+
+	default:
+	}
+
+	s.dropped.Add(1)
+	metrics.StreamDropped.WithLabelValues(string(s.policy)).Inc()
+}
@@ -0,0 +1,489 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec // part checksums are what the S3 api verifies
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/core"
+	"github.com/denzelpenzel/magic-chain/internal/logging"
+	"github.com/denzelpenzel/magic-chain/internal/metrics"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"github.com/denzelpenzel/magic-chain/internal/utils"
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"go.uber.org/zap"
+)
+
+const (
+	// MinPartSize ... Smallest part accepted by S3 for all but the last part
+	MinPartSize = 5 << 20
+
+	// checksumMeta is the user metadata key holding the sealed file sha256
+	checksumMeta = "Sha256"
+	noSuchKey    = "NoSuchKey"
+	maxListItems = 1000
+
+	manifestContentType = "application/json"
+	bucketContentType   = "application/octet-stream"
+)
+
+// ObjectStore ... S3 api used by the uploader, satisfied by minio.Core
+type ObjectStore interface {
+	StatObject(ctx context.Context, bucket, object string, opts minio.StatObjectOptions) (minio.ObjectInfo, error)
+	PutObject(ctx context.Context, bucket, object string, data io.Reader, size int64,
+		md5Base64, sha256Hex string, opts minio.PutObjectOptions) (minio.UploadInfo, error)
+	NewMultipartUpload(ctx context.Context, bucket, object string, opts minio.PutObjectOptions) (string, error)
+	ListMultipartUploads(ctx context.Context, bucket, prefix, keyMarker, uploadIDMarker, delimiter string,
+		maxUploads int) (minio.ListMultipartUploadsResult, error)
+	ListObjectParts(ctx context.Context, bucket, object, uploadID string, partNumberMarker,
+		maxParts int) (minio.ListObjectPartsResult, error)
+	PutObjectPart(ctx context.Context, bucket, object, uploadID string, partID int, data io.Reader, size int64,
+		opts minio.PutObjectPartOptions) (minio.ObjectPart, error)
+	CompleteMultipartUpload(ctx context.Context, bucket, object, uploadID string, parts []minio.CompletePart,
+		opts minio.PutObjectOptions) (minio.UploadInfo, error)
+}
+
+// NewObjectStore ... Connects to an S3 compatible endpoint such as MinIO
+func NewObjectStore(cfg *config.UploadConfig) (ObjectStore, error) {
+	c, err := minio.NewCore(cfg.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(cfg.AccessKey, cfg.SecretKey, ""),
+		Secure: cfg.UseSSL,
+		Region: cfg.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Uploader ... Ships the buckets sealed by the file store cleaner to object storage
+type Uploader struct {
+	cfg   *config.UploadConfig
+	store ObjectStore
+	dirs  []string
+}
+
+func New(cfg *config.UploadConfig, store ObjectStore, dirs ...string) (*Uploader, error) {
+	if cfg.PartSize < MinPartSize {
+		return nil, fmt.Errorf("upload part size %d is below the S3 minimum of %d", cfg.PartSize, MinPartSize)
+	}
+
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("upload bucket is not set")
+	}
+
+	return &Uploader{cfg: cfg, store: store, dirs: dirs}, nil
+}
+
+// Run ... Scans the data dirs every interval until ctx is done
+func (u *Uploader) Run(ctx context.Context) {
+	logger := logging.WithContext(ctx)
+	logger.Info("Starting bucket uploader",
+		zap.String("endpoint", u.cfg.Endpoint),
+		zap.String("bucket", u.cfg.Bucket),
+		zap.Strings("dirs", u.dirs))
+
+	ticker := time.NewTicker(u.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := u.Scan(ctx); err != nil && ctx.Err() == nil {
+			logger.Error("Failed to scan for sealed buckets", zap.Error(err))
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			logger.Debug("Stopping bucket uploader")
+			return
+		}
+	}
+}
+
+// Scan ... Uploads every sealed bucket not uploaded yet. A failed file is
+// logged and left for the next scan, which resumes its multipart upload
+func (u *Uploader) Scan(ctx context.Context) error {
+	logger := logging.WithContext(ctx)
+
+	for _, dir := range u.dirs {
+		manifests, err := pendingManifests(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, mp := range manifests {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+
+			if err := u.upload(ctx, dir, mp); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				logger.Error("Failed to upload sealed bucket", zap.String("manifest", mp), zap.Error(err))
+				metrics.UploadFailures.Inc()
+			}
+		}
+	}
+
+	return nil
+}
+
+// pendingManifests ... Returns the manifests of the sealed buckets under dir
+// without an upload marker. A seal without compression writes the manifest
+// before it renames the bucket, manifests without their file are left for a
+// later scan
+func pendingManifests(dir string) ([]string, error) {
+	var manifests []string
+
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(p, state.ManifestExt) {
+			return nil
+		}
+
+		sealed := strings.TrimSuffix(p, state.ManifestExt)
+		if _, err := os.Stat(sealed + state.MarkerExt); err == nil {
+			return nil
+		}
+		if _, err := os.Stat(sealed); errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		manifests = append(manifests, p)
+		return nil
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	sort.Strings(manifests)
+	return manifests, err
+}
+
+// upload ... Uploads a sealed bucket followed by its manifest
+func (u *Uploader) upload(ctx context.Context, dir, manifestPath string) error {
+	m, err := state.ReadManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	sealed := strings.TrimSuffix(manifestPath, state.ManifestExt)
+
+	rel, err := filepath.Rel(dir, sealed)
+	if err != nil {
+		return err
+	}
+	key := path.Join(u.cfg.Prefix, filepath.ToSlash(rel))
+
+	file, err := os.Open(filepath.Clean(sealed))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	// the manifest checksum guards against a file changed after sealing
+	sum, err := fileSHA256(file, info.Size())
+	if err != nil {
+		return err
+	}
+	if sum != m.SHA256 {
+		return fmt.Errorf("sealed bucket %s does not match its manifest checksum", sealed)
+	}
+
+	uploaded, err := u.isUploaded(ctx, key, info.Size(), m.SHA256)
+	if err != nil {
+		return err
+	}
+
+	if !uploaded {
+		if info.Size() <= u.cfg.PartSize {
+			err = u.putObject(ctx, key, file, info.Size(), m.SHA256)
+		} else {
+			err = u.putMultipart(ctx, key, file, info.Size(), m.SHA256)
+		}
+		if err != nil {
+			return err
+		}
+
+		if ok, err := u.isUploaded(ctx, key, info.Size(), m.SHA256); err != nil {
+			return err
+		} else if !ok {
+			return fmt.Errorf("uploaded object %s does not match %s", key, sealed)
+		}
+	}
+
+	if err := u.putManifest(ctx, key+state.ManifestExt, manifestPath); err != nil {
+		return err
+	}
+
+	metrics.UploadedFiles.Inc()
+	logging.WithContext(ctx).Info("Uploaded sealed bucket",
+		zap.String("file", sealed),
+		zap.String("key", key),
+		zap.Int64("size", info.Size()))
+
+	// the marker is written first and kept when the local files are removed,
+	// a later seal of the bucket never reuses the uploaded name
+	if err := os.WriteFile(sealed+state.MarkerExt, []byte(key+"\n"), 0o600); err != nil {
+		return err
+	}
+
+	if u.cfg.DeleteLocal {
+		return errors.Join(os.Remove(sealed), os.Remove(manifestPath))
+	}
+	return nil
+}
+
+// isUploaded ... Reports whether the object exists with the expected size and checksum
+func (u *Uploader) isUploaded(ctx context.Context, key string, size int64, sum string) (bool, error) {
+	var info minio.ObjectInfo
+
+	err := u.retry(ctx, func() error {
+		var err error
+		info, err = u.store.StatObject(ctx, u.cfg.Bucket, key, minio.StatObjectOptions{})
+		if minio.ToErrorResponse(err).Code == noSuchKey {
+			return nil
+		}
+		return err
+	})
+	if err != nil || info.Key == "" {
+		return false, err
+	}
+
+	return info.Size == size && userMeta(info.UserMetadata, checksumMeta) == sum, nil
+}
+
+func (u *Uploader) putObject(ctx context.Context, key string, file *os.File, size int64, sum string) error {
+	md5sum, err := sectionMD5(file, 0, size)
+	if err != nil {
+		return err
+	}
+
+	return u.retry(ctx, func() error {
+		_, err := u.store.PutObject(ctx, u.cfg.Bucket, key, io.NewSectionReader(file, 0, size), size,
+			base64.StdEncoding.EncodeToString(md5sum), sum, u.putOptions(bucketContentType, sum))
+		if err == nil {
+			metrics.UploadedBytes.Add(float64(size))
+		}
+		return err
+	})
+}
+
+// putMultipart ... Uploads the file in parts, resuming an incomplete upload
+// of the same key. Parts already stored with a matching checksum are kept
+func (u *Uploader) putMultipart(ctx context.Context, key string, file *os.File, size int64, sum string) error {
+	uploadID, err := u.findUpload(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	if uploadID == "" {
+		err = u.retry(ctx, func() error {
+			uploadID, err = u.store.NewMultipartUpload(ctx, u.cfg.Bucket, key, u.putOptions(bucketContentType, sum))
+			return err
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	stored, err := u.listParts(ctx, key, uploadID)
+	if err != nil {
+		return err
+	}
+
+	var parts []minio.CompletePart
+	for number, offset := 1, int64(0); offset < size; number, offset = number+1, offset+u.cfg.PartSize {
+		partSize := u.cfg.PartSize
+		if offset+partSize > size {
+			partSize = size - offset
+		}
+
+		md5sum, err := sectionMD5(file, offset, partSize)
+		if err != nil {
+			return err
+		}
+		etag := hex.EncodeToString(md5sum)
+
+		if p, ok := stored[number]; ok && p.Size == partSize && strings.Trim(p.ETag, `"`) == etag {
+			parts = append(parts, minio.CompletePart{PartNumber: number, ETag: p.ETag})
+			continue
+		}
+
+		err = u.retry(ctx, func() error {
+			p, err := u.store.PutObjectPart(ctx, u.cfg.Bucket, key, uploadID, number,
+				io.NewSectionReader(file, offset, partSize), partSize,
+				minio.PutObjectPartOptions{Md5Base64: base64.StdEncoding.EncodeToString(md5sum)})
+			if err != nil {
+				return err
+			}
+
+			metrics.UploadedBytes.Add(float64(partSize))
+			if strings.Trim(p.ETag, `"`) != etag {
+				return fmt.Errorf("part %d of %s stored with etag %s, expected %s", number, key, p.ETag, etag)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		parts = append(parts, minio.CompletePart{PartNumber: number, ETag: etag})
+	}
+
+	return u.retry(ctx, func() error {
+		_, err := u.store.CompleteMultipartUpload(ctx, u.cfg.Bucket, key, uploadID, parts, minio.PutObjectOptions{})
+		return err
+	})
+}
+
+// findUpload ... Returns the most recent incomplete upload of key, if any
+func (u *Uploader) findUpload(ctx context.Context, key string) (string, error) {
+	var res minio.ListMultipartUploadsResult
+
+	err := u.retry(ctx, func() error {
+		var err error
+		res, err = u.store.ListMultipartUploads(ctx, u.cfg.Bucket, key, "", "", "", maxListItems)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var latest minio.ObjectMultipartInfo
+	for _, up := range res.Uploads {
+		if up.Key == key && (latest.UploadID == "" || up.Initiated.After(latest.Initiated)) {
+			latest = up
+		}
+	}
+	return latest.UploadID, nil
+}
+
+func (u *Uploader) listParts(ctx context.Context, key, uploadID string) (map[int]minio.ObjectPart, error) {
+	parts := make(map[int]minio.ObjectPart)
+
+	marker := 0
+	for {
+		var res minio.ListObjectPartsResult
+		err := u.retry(ctx, func() error {
+			var err error
+			res, err = u.store.ListObjectParts(ctx, u.cfg.Bucket, key, uploadID, marker, maxListItems)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, p := range res.ObjectParts {
+			parts[p.PartNumber] = p
+		}
+
+		if !res.IsTruncated {
+			return parts, nil
+		}
+		marker = res.NextPartNumberMarker
+	}
+}
+
+func (u *Uploader) putManifest(ctx context.Context, key, manifestPath string) error {
+	raw, err := os.ReadFile(filepath.Clean(manifestPath))
+	if err != nil {
+		return err
+	}
+
+	md5sum := md5.Sum(raw) //nolint:gosec // see import
+	sum := sha256.Sum256(raw)
+
+	return u.retry(ctx, func() error {
+		_, err := u.store.PutObject(ctx, u.cfg.Bucket, key, bytes.NewReader(raw), int64(len(raw)),
+			base64.StdEncoding.EncodeToString(md5sum[:]), hex.EncodeToString(sum[:]),
+			minio.PutObjectOptions{ContentType: manifestContentType})
+		return err
+	})
+}
+
+func (u *Uploader) putOptions(contentType, sum string) minio.PutObjectOptions {
+	return minio.PutObjectOptions{
+		ContentType:  contentType,
+		UserMetadata: map[string]string{checksumMeta: sum},
+	}
+}
+
+// retry ... Runs fn until it succeeds, the retry budget is spent or ctx is done
+func (u *Uploader) retry(ctx context.Context, fn func() error) error {
+	var err error
+
+	for attempt := 1; ; attempt++ {
+		if err = fn(); err == nil || !retryable(err) || attempt >= u.cfg.Retries {
+			return err
+		}
+
+		timer := time.NewTimer(utils.Backoff(attempt, core.MinBackoffMs*time.Millisecond,
+			core.MaxBackoffSec*time.Second))
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		}
+	}
+}
+
+// retryable ... Client errors other than throttling are not retried
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	status := minio.ToErrorResponse(err).StatusCode
+	return status == 0 || status == http.StatusTooManyRequests || status >= http.StatusInternalServerError
+}
+
+func userMeta(meta minio.StringMap, key string) string {
+	for k, v := range meta {
+		if strings.EqualFold(k, key) {
+			return v
+		}
+	}
+	return ""
+}
+
+func fileSHA256(file *os.File, size int64) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, io.NewSectionReader(file, 0, size)); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+func sectionMD5(file *os.File, offset, size int64) ([]byte, error) {
+	h := md5.New() //nolint:gosec // see import
+	if _, err := io.Copy(h, io.NewSectionReader(file, offset, size)); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
@@ -0,0 +1,252 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5" //nolint:gosec // see upload.go
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/denzelpenzel/magic-chain/internal/config"
+	"github.com/denzelpenzel/magic-chain/internal/state"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeObject struct {
+	data []byte
+	meta minio.StringMap
+}
+
+type fakeUpload struct {
+	key   string
+	meta  minio.StringMap
+	parts map[int][]byte
+}
+
+// fakeStore ... In memory ObjectStore counting the uploaded parts
+type fakeStore struct {
+	objects  map[string]*fakeObject
+	uploads  map[string]*fakeUpload
+	putParts []int
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{objects: make(map[string]*fakeObject), uploads: make(map[string]*fakeUpload)}
+}
+
+func etag(data []byte) string {
+	sum := md5.Sum(data) //nolint:gosec // see upload.go
+	return hex.EncodeToString(sum[:])
+}
+
+func (f *fakeStore) StatObject(_ context.Context, _, object string,
+	_ minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	o, ok := f.objects[object]
+	if !ok {
+		return minio.ObjectInfo{}, minio.ErrorResponse{Code: noSuchKey, StatusCode: 404}
+	}
+	return minio.ObjectInfo{Key: object, Size: int64(len(o.data)), UserMetadata: o.meta}, nil
+}
+
+func (f *fakeStore) PutObject(_ context.Context, _, object string, data io.Reader, _ int64,
+	_, _ string, opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	raw, err := io.ReadAll(data)
+	if err != nil {
+		return minio.UploadInfo{}, err
+	}
+	f.objects[object] = &fakeObject{data: raw, meta: opts.UserMetadata}
+	return minio.UploadInfo{Key: object, Size: int64(len(raw))}, nil
+}
+
+func (f *fakeStore) NewMultipartUpload(_ context.Context, _, object string,
+	opts minio.PutObjectOptions) (string, error) {
+	id := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+	f.uploads[id] = &fakeUpload{key: object, meta: opts.UserMetadata, parts: make(map[int][]byte)}
+	return id, nil
+}
+
+func (f *fakeStore) ListMultipartUploads(_ context.Context, _, prefix, _, _, _ string,
+	_ int) (minio.ListMultipartUploadsResult, error) {
+	var res minio.ListMultipartUploadsResult
+	for id, up := range f.uploads {
+		if strings.HasPrefix(up.key, prefix) {
+			res.Uploads = append(res.Uploads, minio.ObjectMultipartInfo{Key: up.key, UploadID: id, Initiated: time.Now()})
+		}
+	}
+	return res, nil
+}
+
+func (f *fakeStore) ListObjectParts(_ context.Context, _, _, uploadID string, _,
+	_ int) (minio.ListObjectPartsResult, error) {
+	var res minio.ListObjectPartsResult
+	for number, data := range f.uploads[uploadID].parts {
+		res.ObjectParts = append(res.ObjectParts,
+			minio.ObjectPart{PartNumber: number, ETag: `"` + etag(data) + `"`, Size: int64(len(data))})
+	}
+	return res, nil
+}
+
+func (f *fakeStore) PutObjectPart(_ context.Context, _, _, uploadID string, partID int, data io.Reader, _ int64,
+	_ minio.PutObjectPartOptions) (minio.ObjectPart, error) {
+	raw, err := io.ReadAll(data)
+	if err != nil {
+		return minio.ObjectPart{}, err
+	}
+	f.uploads[uploadID].parts[partID] = raw
+	f.putParts = append(f.putParts, partID)
+	return minio.ObjectPart{PartNumber: partID, ETag: etag(raw), Size: int64(len(raw))}, nil
+}
+
+func (f *fakeStore) CompleteMultipartUpload(_ context.Context, _, object, uploadID string,
+	parts []minio.CompletePart, _ minio.PutObjectOptions) (minio.UploadInfo, error) {
+	up := f.uploads[uploadID]
+	sort.Slice(parts, func(i, j int) bool { return parts[i].PartNumber < parts[j].PartNumber })
+
+	var data []byte
+	for _, p := range parts {
+		raw := up.parts[p.PartNumber]
+		if strings.Trim(p.ETag, `"`) != etag(raw) {
+			return minio.UploadInfo{}, fmt.Errorf("part %d etag mismatch", p.PartNumber)
+		}
+		data = append(data, raw...)
+	}
+
+	f.objects[object] = &fakeObject{data: data, meta: up.meta}
+	delete(f.uploads, uploadID)
+	return minio.UploadInfo{Key: object, Size: int64(len(data))}, nil
+}
+
+func newTestUploader(t *testing.T, store ObjectStore, dir string, deleteLocal bool) *Uploader {
+	t.Helper()
+
+	u, err := New(&config.UploadConfig{
+		Bucket:      "buckets",
+		Prefix:      "mainnet",
+		PartSize:    MinPartSize,
+		Retries:     1,
+		DeleteLocal: deleteLocal,
+	}, store, dir)
+	require.NoError(t, err)
+	return u
+}
+
+// sealTestBucket ... Seals a bucket of rows padded to rowSize without compression
+func sealTestBucket(t *testing.T, dir string, rows, rowSize int) string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	for i := 0; i < rows; i++ {
+		fmt.Fprintf(&buf, "%d,0x%064x,0x%s\n", 1700000000000+i, i, strings.Repeat("ab", rowSize/2))
+	}
+
+	path := filepath.Join(dir, "txs_2023-11-14T22-00-00Z_test.csv")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+
+	m, err := state.SealBucket(path, state.NoCompression)
+	require.NoError(t, err)
+	return filepath.Join(dir, m.File)
+}
+
+func TestUploadResumesMultipart(t *testing.T) {
+	dir := t.TempDir()
+	sealed := sealTestBucket(t, dir, 2600, 4096)
+
+	raw, err := os.ReadFile(sealed)
+	require.NoError(t, err)
+	require.Greater(t, len(raw), 2*MinPartSize)
+
+	// a previous scan stored the first part before it failed
+	store := newFakeStore()
+	key := "mainnet/" + filepath.Base(sealed)
+	id, err := store.NewMultipartUpload(context.Background(), "buckets", key, minio.PutObjectOptions{})
+	require.NoError(t, err)
+	store.uploads[id].meta = minio.StringMap{checksumMeta: sha256Hex(raw)}
+	store.uploads[id].parts[1] = raw[:MinPartSize]
+
+	require.NoError(t, newTestUploader(t, store, dir, false).Scan(context.Background()))
+
+	require.Equal(t, []int{2, 3}, store.putParts)
+	require.Equal(t, raw, store.objects[key].data)
+	require.Contains(t, store.objects, key+state.ManifestExt)
+	require.FileExists(t, sealed+state.MarkerExt)
+	require.FileExists(t, sealed)
+}
+
+func TestUploadChecksumMismatch(t *testing.T) {
+	dir := t.TempDir()
+	sealed := sealTestBucket(t, dir, 3, 16)
+
+	// the sealed file changed after its manifest was written
+	f, err := os.OpenFile(sealed, os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	_, err = f.WriteString("1700000009000,0x01,0x02\n")
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	store := newFakeStore()
+	require.NoError(t, newTestUploader(t, store, dir, true).Scan(context.Background()))
+
+	require.Empty(t, store.objects)
+	require.NoFileExists(t, sealed+state.MarkerExt)
+	require.FileExists(t, sealed)
+	require.FileExists(t, sealed+state.ManifestExt)
+}
+
+func TestUploadDeletesLocalAfterMarker(t *testing.T) {
+	dir := t.TempDir()
+	sealed := sealTestBucket(t, dir, 3, 16)
+
+	raw, err := os.ReadFile(sealed)
+	require.NoError(t, err)
+
+	store := newFakeStore()
+	u := newTestUploader(t, store, dir, true)
+	require.NoError(t, u.Scan(context.Background()))
+
+	key := "mainnet/" + filepath.Base(sealed)
+	require.Equal(t, raw, store.objects[key].data)
+	require.Equal(t, sha256Hex(raw), userMeta(store.objects[key].meta, checksumMeta))
+	require.Contains(t, store.objects, key+state.ManifestExt)
+
+	// the marker outlives the local files and keeps the name taken
+	marker, err := os.ReadFile(sealed + state.MarkerExt)
+	require.NoError(t, err)
+	require.Equal(t, key+"\n", string(marker))
+	require.NoFileExists(t, sealed)
+	require.NoFileExists(t, sealed+state.ManifestExt)
+
+	pending, err := pendingManifests(dir)
+	require.NoError(t, err)
+	require.Empty(t, pending)
+}
+
+func TestPendingManifestsSkipsUnfinishedSeals(t *testing.T) {
+	dir := t.TempDir()
+
+	// the manifest of a seal without compression is written before the rename
+	sealed := filepath.Join(dir, "txs_2023-11-14T22-00-00Z_test-1.csv")
+	require.NoError(t, os.WriteFile(sealed+state.ManifestExt, []byte(`{"file":"x"}`), 0o600))
+
+	pending, err := pendingManifests(dir)
+	require.NoError(t, err)
+	require.Empty(t, pending)
+
+	require.NoError(t, os.WriteFile(sealed, []byte("1,a\n"), 0o600))
+	pending, err = pendingManifests(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{sealed + state.ManifestExt}, pending)
+}
+
+func sha256Hex(raw []byte) string {
+	sum := sha256.Sum256(raw)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,23 @@
+package utils
+
+import (
+	"math/rand"
+	"time"
+)
+
+// Backoff ... Capped exponential backoff with equal jitter for the given
+// attempt (starting at 1). The returned delay is within [d/2, d] where
+// d = min(base * 2^(attempt-1), maxDelay)
+func Backoff(attempt int, base, maxDelay time.Duration) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+
+	d := maxDelay
+	if shift := attempt - 1; shift < 32 && base<<shift < maxDelay {
+		d = base << shift
+	}
+
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1)) //nolint:gosec // jitter does not need a secure source
+}
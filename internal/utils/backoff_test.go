@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBackoff(t *testing.T) {
+	const (
+		base     = 500 * time.Millisecond
+		maxDelay = 5 * time.Second
+	)
+
+	tests := []struct {
+		name    string
+		attempt int
+		// want is the delay before jitter, the result is within [want/2, want]
+		want time.Duration
+	}{
+		{name: "attempts below one count as the first", attempt: 0, want: base},
+		{name: "first attempt", attempt: 1, want: base},
+		{name: "doubles per attempt", attempt: 3, want: 4 * base},
+		{name: "capped at the max delay", attempt: 5, want: maxDelay},
+		{name: "large attempts do not overflow", attempt: 80, want: maxDelay},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 100; i++ {
+				d := Backoff(tt.attempt, base, maxDelay)
+				require.GreaterOrEqual(t, d, tt.want/2)
+				require.LessOrEqual(t, d, tt.want)
+			}
+		})
+	}
+}